@@ -0,0 +1,185 @@
+package periodic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/jmuyuyang/periodic/driver"
+)
+
+// Role defined what an identity can do on the funcs
+type Role string
+
+const (
+	// RoleSubmit submit, update, pause, resume and run the jobs, set the webhooks
+	RoleSubmit Role = "submit"
+	// RoleRemove remove the jobs
+	RoleRemove Role = "remove"
+	// RoleDrop drop the funcs
+	RoleDrop Role = "drop"
+	// RoleDump dump and load the data, change the log levels
+	RoleDump Role = "dump"
+	// RoleStatus read the status, the jobs, the history, the webhooks and the events
+	RoleStatus Role = "status"
+	// RoleWork work on the funcs
+	RoleWork Role = "work"
+)
+
+// grant defined the roles on the funcs matched by the glob patterns, the
+// role "*" is all the roles.
+type grant struct {
+	Roles []Role   `json:"roles"`
+	Funcs []string `json:"funcs"`
+
+	// Namespaces the glob patterns of the namespaces, empty is all
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+func (g grant) allowNamespace(ns string) bool {
+	if len(g.Namespaces) == 0 {
+		return true
+	}
+	for _, pattern := range g.Namespaces {
+		if ok, _ := path.Match(pattern, ns); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (g grant) allow(ns string, role Role, Func string) bool {
+	if !g.allowNamespace(ns) {
+		return false
+	}
+	matched := false
+	for _, r := range g.Roles {
+		if r == role || r == "*" {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	for _, pattern := range g.Funcs {
+		if pattern == "*" {
+			return true
+		}
+		// the server wide operations need the pattern "*"
+		if Func == "" {
+			continue
+		}
+		if ok, _ := path.Match(pattern, Func); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// acl defined the grants of the identities, the grants of the identity "*"
+// apply to everyone, include the unauthenticated connections.
+type acl map[string][]grant
+
+// forbiddenError the identity is not granted the role on the func
+type forbiddenError struct {
+	identity  string
+	namespace string
+	role      Role
+	Func      string
+}
+
+func (e forbiddenError) Error() string {
+	if e.Func == "" {
+		return fmt.Sprintf("Permission denied: %q can not %s in namespace %q.", e.identity, e.role, e.namespace)
+	}
+	return fmt.Sprintf("Permission denied: %q can not %s func %q in namespace %q.", e.identity, e.role, e.Func, e.namespace)
+}
+
+// SetACL load the grants of the identities from a json file, eg:
+//
+//	{"billing": [{"roles": ["submit", "remove", "status"], "funcs": ["billing.*"], "namespaces": ["billing"]}],
+//	 "admin": [{"roles": ["*"], "funcs": ["*"]}]}
+//
+// A grant without namespaces apply to all the namespaces. Everything is allowed when no acl is set.
+func (sched *Sched) SetACL(aclFile string) error {
+	data, err := ioutil.ReadFile(aclFile)
+	if err != nil {
+		return err
+	}
+	var rules acl
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+	sched.acl = rules
+	return nil
+}
+
+// allow check the identity is granted the role on the func of the namespace,
+// an empty func is a namespace wide operation.
+func (sched *Sched) allow(identity, ns string, role Role, Func string) bool {
+	if sched.acl == nil {
+		return true
+	}
+	for _, key := range []string{identity, "*"} {
+		for _, g := range sched.acl[key] {
+			if g.allow(ns, role, Func) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorize return a forbiddenError when the role is not granted.
+func (sched *Sched) authorize(identity, ns string, role Role, Func string) error {
+	if sched.allow(identity, ns, role, Func) {
+		return nil
+	}
+	return forbiddenError{identity: identity, namespace: ns, role: role, Func: Func}
+}
+
+// authorizeJob authorize the role on the func of the job, the job addressed by
+// job_id is always looked up for the func, a missing job or a job of the other
+// func need the role on all the funcs. The request without job_id and func is
+// left to the operation.
+func (sched *Sched) authorizeJob(identity, ns string, role Role, jobID int64, Func string) error {
+	if sched.acl == nil {
+		return nil
+	}
+	if jobID > 0 {
+		job, err := sched.getJob(ns, jobID, Func, "")
+		if err != nil {
+			return sched.authorize(identity, ns, role, "")
+		}
+		Func = job.Func
+	}
+	if Func == "" {
+		return nil
+	}
+	return sched.authorize(identity, ns, role, Func)
+}
+
+// authorizeJobs set the error in results for the jobs the role is not granted.
+func (sched *Sched) authorizeJobs(identity, ns string, role Role, jobs []driver.Job, results []batchResult) {
+	for i, job := range jobs {
+		if results[i].Err != "" {
+			continue
+		}
+		if err := sched.authorize(identity, ns, role, job.Func); err != nil {
+			results[i].setError(err)
+		}
+	}
+}
+
+// funcFilter the funcs of the namespace the identity can read, nil when all
+// are allowed.
+func (sched *Sched) funcFilter(identity, ns string) func(string) bool {
+	if sched.acl == nil {
+		return nil
+	}
+	return func(Func string) bool {
+		return sched.allow(identity, ns, RoleStatus, Func)
+	}
+}
@@ -0,0 +1,69 @@
+package periodic
+
+import (
+	"testing"
+)
+
+func TestGrantAllow(t *testing.T) {
+	var g = grant{Roles: []Role{RoleSubmit, RoleStatus}, Funcs: []string{"billing.*"}}
+	var cases = []struct {
+		ns     string
+		role   Role
+		Func   string
+		except bool
+	}{
+		{"default", RoleSubmit, "billing.send", true},
+		{"default", RoleStatus, "billing.send", true},
+		{"default", RoleRemove, "billing.send", false},
+		{"default", RoleSubmit, "report.send", false},
+		// the glob do not match across the "/"
+		{"default", RoleSubmit, "billing.send/retry", false},
+		// the server wide operations need the pattern "*"
+		{"default", RoleStatus, "", false},
+	}
+	for _, c := range cases {
+		if got := g.allow(c.ns, c.role, c.Func); got != c.except {
+			t.Fatalf("allow(%q, %q, %q): except: %v, got: %v", c.ns, c.role, c.Func, c.except, got)
+		}
+	}
+
+	g = grant{Roles: []Role{"*"}, Funcs: []string{"*"}, Namespaces: []string{"billing", "team-*"}}
+	if !g.allow("billing", RoleDrop, "") || !g.allow("team-a", RoleWork, "f") {
+		t.Fatalf("allow: except the namespaces matched allowed")
+	}
+	if g.allow("default", RoleStatus, "f") {
+		t.Fatalf("allow: except the namespace default denied")
+	}
+}
+
+func TestSchedAllow(t *testing.T) {
+	var sched = new(Sched)
+	if !sched.allow("", "default", RoleDrop, "") {
+		t.Fatalf("allow: except everything allowed without acl")
+	}
+
+	sched.acl = acl{
+		"billing": {{Roles: []Role{RoleSubmit}, Funcs: []string{"billing.*"}}},
+		"*":       {{Roles: []Role{RoleStatus}, Funcs: []string{"public.*"}}},
+	}
+	if !sched.allow("billing", "default", RoleSubmit, "billing.send") {
+		t.Fatalf("allow: except billing submit billing.send allowed")
+	}
+	if sched.allow("billing", "default", RoleSubmit, "public.send") {
+		t.Fatalf("allow: except billing submit public.send denied")
+	}
+	// the grants of "*" apply to everyone, include the unauthenticated
+	for _, identity := range []string{"billing", "other", ""} {
+		if !sched.allow(identity, "default", RoleStatus, "public.send") {
+			t.Fatalf("allow: except %q status public.send allowed", identity)
+		}
+	}
+	if sched.allow("other", "default", RoleSubmit, "billing.send") {
+		t.Fatalf("allow: except other submit billing.send denied")
+	}
+
+	var err = sched.authorize("other", "default", RoleSubmit, "billing.send")
+	if _, ok := err.(forbiddenError); !ok {
+		t.Fatalf("authorize: except forbiddenError, got: %v", err)
+	}
+}
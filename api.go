@@ -0,0 +1,797 @@
+package periodic
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmuyuyang/periodic/dashboard"
+	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/protocol"
+	"github.com/jmuyuyang/periodic/stat"
+)
+
+// apiPrefix the path prefix of the versioned REST API
+const apiPrefix = "/api/v1"
+
+// maxBodySize the max size of a request body
+const maxBodySize = 4 << 20
+
+// SetHTTPEntryPoint set the listen address of the REST API, eg:
+// tcp://127.0.0.1:5001, the REST API is disabled when it is empty.
+func (sched *Sched) SetHTTPEntryPoint(entryPoint string) {
+	sched.httpEntryPoint = entryPoint
+}
+
+func (sched *Sched) serveHTTP() {
+	parts := strings.SplitN(sched.httpEntryPoint, "://", 2)
+	if len(parts) != 2 {
+		parts = []string{"tcp", sched.httpEntryPoint}
+	}
+	if parts[0] == "unix" {
+		sockCheck(parts[1])
+	}
+	listen, err := net.Listen(parts[0], parts[1])
+	if err != nil {
+		httpLog.Fatal("Listen failed", "entry_point", sched.httpEntryPoint, "err", err)
+	}
+	if parts[0] != "unix" && sched.tlsConfig != nil {
+		listen = tls.NewListener(listen, sched.tlsConfig)
+	}
+	sched.httpServer = &http.Server{
+		Handler:           apiHandler{sched: sched},
+		ReadHeaderTimeout: 30 * time.Second,
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				sched.conns["http"].Incr()
+				break
+			case http.StateHijacked, http.StateClosed:
+				sched.conns["http"].Decr()
+				break
+			}
+		},
+	}
+	httpLog.Info("REST API started", "entry_point", sched.httpEntryPoint)
+	if err = sched.httpServer.Serve(listen); err != nil && err != http.ErrServerClosed {
+		httpLog.Error("Serve failed", "err", err)
+	}
+}
+
+// apiHandler serve the REST API:
+//
+//	GET    /api/v1/funcs                         the status of all funcs
+//	GET    /api/v1/funcs/{func}                  the status of a func
+//	DELETE /api/v1/funcs/{func}                  drop a func and the jobs
+//	GET    /api/v1/funcs/{func}/results          the execution history of a func
+//	GET    /api/v1/funcs/{func}/webhook          the webhook and the deliveries
+//	PUT    /api/v1/funcs/{func}/webhook          set the webhook
+//	DELETE /api/v1/funcs/{func}/webhook          remove the webhook
+//	GET    /api/v1/funcs/{func}/jobs             list the jobs of a func
+//	POST   /api/v1/funcs/{func}/jobs             submit a job of a func
+//	GET    /api/v1/jobs                          list the jobs
+//	POST   /api/v1/jobs                          submit a job
+//	POST   /api/v1/jobs/batch                    submit a batch of jobs
+//	DELETE /api/v1/jobs/batch                    remove a batch of jobs
+//	GET    /api/v1/workers                       the connected workers
+//	GET    /api/v1/events                        stream the events
+//
+// A job is addressed by /api/v1/jobs/{id} or /api/v1/funcs/{func}/jobs/{name}:
+//
+//	GET    {job}                                 get the job
+//	PUT    {job}                                 submit the job, by name only
+//	PATCH  {job}                                 update some fields of the job
+//	DELETE {job}                                 remove the job
+//	POST   {job}/pause                           pause the job
+//	POST   {job}/resume                          resume the paused job
+//	POST   {job}/run                             run the ready job now
+//	GET    {job}/results                         the execution history of the job
+//
+// The request is served in the namespace of the "X-Periodic-Namespace" header
+// or the namespace query, the default namespace when both are missing.
+//
+// The prometheus metrics is served on /metrics, and the web dashboard on
+// /dashboard/. When the authentication is enabled, all but the dashboard
+// assets require the "Authorization: Bearer [token]" header or the
+// access_token query, or a verified client certificate.
+type apiHandler struct {
+	sched     *Sched
+	identity  string // The authenticated identity of the request
+	namespace string // The namespace of the request
+}
+
+// jobRef the job addressed by id or by func and name
+type jobRef struct {
+	ID   int64
+	Func string
+	Name string
+}
+
+func (api apiHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Server", "periodic/"+Version)
+	httpLog.Debug("Request", "method", req.Method, "path", req.URL.Path)
+	if req.URL.Path == "/" || req.URL.Path == "/dashboard" {
+		http.Redirect(w, req, "/dashboard/", http.StatusFound)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/dashboard/") {
+		http.StripPrefix("/dashboard", dashboard.Handler()).ServeHTTP(w, req)
+		return
+	}
+	api.identity = certIdentity(req.TLS)
+	if api.sched.auth != nil && api.identity == "" {
+		var err error
+		if api.identity, err = api.sched.authenticateRequest(req); err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="periodic"`)
+			writeError(w, err)
+			return
+		}
+	}
+	api.namespace = req.Header.Get("X-Periodic-Namespace")
+	if api.namespace == "" {
+		api.namespace = req.URL.Query().Get("namespace")
+	}
+	if api.namespace == "" {
+		api.namespace = driver.DefaultNamespace
+	}
+	if !validNamespace(api.namespace) {
+		writeError(w, ErrInvalidNamespace)
+		return
+	}
+	if req.URL.Path == "/metrics" {
+		if err := api.authorize(RoleStatus, ""); err != nil {
+			writeError(w, err)
+			return
+		}
+		if allowMethod(w, req, "GET") {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			w.Write(api.sched.metrics())
+		}
+		return
+	}
+	path := req.URL.EscapedPath()
+	if path != apiPrefix && !strings.HasPrefix(path, apiPrefix+"/") {
+		writeErrorStatus(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	var parts = make([]string, 0)
+	for _, part := range strings.Split(strings.Trim(path[len(apiPrefix):], "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part, err := url.PathUnescape(part)
+		if err != nil {
+			writeErrorStatus(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		writeErrorStatus(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	switch parts[0] {
+	case "funcs":
+		api.routeFunc(w, req, parts[1:])
+		break
+	case "jobs":
+		api.routeJobs(w, req, parts[1:])
+		break
+	case "workers":
+		if len(parts) == 1 && allowMethod(w, req, "GET") {
+			writeJSON(w, http.StatusOK, map[string][]workerInfo{"workers": api.listWorkers()})
+		} else if len(parts) > 1 {
+			writeErrorStatus(w, http.StatusNotFound, "Not found.")
+		}
+		break
+	case "events":
+		if len(parts) == 1 && allowMethod(w, req, "GET") {
+			api.handleEvents(w, req)
+		} else if len(parts) > 1 {
+			writeErrorStatus(w, http.StatusNotFound, "Not found.")
+		}
+		break
+	default:
+		writeErrorStatus(w, http.StatusNotFound, "Not found.")
+		break
+	}
+}
+
+func (api apiHandler) routeFunc(w http.ResponseWriter, req *http.Request, parts []string) {
+	if len(parts) == 0 {
+		if allowMethod(w, req, "GET") {
+			stats := api.sched.funcStatus(api.namespace)
+			for Func := range stats {
+				if !api.sched.allow(api.identity, api.namespace, RoleStatus, Func) {
+					delete(stats, Func)
+				}
+			}
+			writeJSON(w, http.StatusOK, stats)
+		}
+		return
+	}
+	Func := parts[0]
+	if len(parts) == 1 {
+		switch req.Method {
+		case "GET":
+			if err := api.authorize(RoleStatus, Func); err != nil {
+				writeError(w, err)
+				return
+			}
+			st, ok := api.sched.funcStatus(api.namespace)[Func]
+			if !ok {
+				writeError(w, ErrFuncNotExists)
+				return
+			}
+			writeJSON(w, http.StatusOK, st)
+			break
+		case "DELETE":
+			if err := api.authorize(RoleDrop, Func); err != nil {
+				writeError(w, err)
+				return
+			}
+			if err := api.sched.dropFunc(api.namespace, Func); err != nil {
+				writeError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			break
+		default:
+			allowMethod(w, req, "GET", "DELETE")
+			break
+		}
+		return
+	}
+	switch {
+	case len(parts) == 2 && parts[1] == "jobs":
+		api.handleJobs(w, req, Func)
+		break
+	case len(parts) == 2 && parts[1] == "results":
+		if err := api.authorize(RoleStatus, Func); err != nil {
+			writeError(w, err)
+			return
+		}
+		if allowMethod(w, req, "GET") {
+			api.handleResults(w, req, historyRequest{Func: Func})
+		}
+		break
+	case len(parts) == 2 && parts[1] == "webhook":
+		api.handleWebhook(w, req, Func)
+		break
+	case len(parts) == 3 && parts[1] == "jobs":
+		api.handleJob(w, req, jobRef{Func: Func, Name: parts[2]})
+		break
+	case len(parts) == 4 && parts[1] == "jobs":
+		api.handleJobAction(w, req, jobRef{Func: Func, Name: parts[2]}, parts[3])
+		break
+	default:
+		writeErrorStatus(w, http.StatusNotFound, "Not found.")
+		break
+	}
+}
+
+func (api apiHandler) routeJobs(w http.ResponseWriter, req *http.Request, parts []string) {
+	if len(parts) == 0 {
+		api.handleJobs(w, req, "")
+		return
+	}
+	if len(parts) == 1 && parts[0] == "batch" {
+		api.handleBatch(w, req)
+		return
+	}
+	jobID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || jobID <= 0 || len(parts) > 2 {
+		writeErrorStatus(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	if len(parts) == 1 {
+		api.handleJob(w, req, jobRef{ID: jobID})
+	} else {
+		api.handleJobAction(w, req, jobRef{ID: jobID}, parts[1])
+	}
+}
+
+// handleJobs list or submit the jobs, the func is from the path or empty.
+func (api apiHandler) handleJobs(w http.ResponseWriter, req *http.Request, Func string) {
+	switch req.Method {
+	case "GET":
+		var lreq listRequest
+		var err error
+		query := req.URL.Query()
+		lreq.Func = query.Get("func")
+		if Func != "" {
+			lreq.Func = Func
+		}
+		lreq.Status = query.Get("status")
+		lreq.Prefix = query.Get("prefix")
+		if v := query.Get("cursor"); v != "" {
+			if lreq.Cursor, err = strconv.ParseInt(v, 10, 64); err != nil {
+				writeErrorStatus(w, http.StatusBadRequest, "invalid cursor: "+v)
+				return
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			if lreq.Limit, err = strconv.Atoi(v); err != nil {
+				writeErrorStatus(w, http.StatusBadRequest, "invalid limit: "+v)
+				return
+			}
+		}
+		lreq.allow = api.sched.funcFilter(api.identity, api.namespace)
+		writeJSON(w, http.StatusOK, api.sched.listJobs(api.namespace, lreq))
+		break
+	case "POST":
+		api.handleSubmitJob(w, req, jobRef{Func: Func})
+		break
+	default:
+		allowMethod(w, req, "GET", "POST")
+		break
+	}
+}
+
+func (api apiHandler) handleJob(w http.ResponseWriter, req *http.Request, ref jobRef) {
+	switch req.Method {
+	case "GET":
+		if err := api.authorizeJob(RoleStatus, ref); err != nil {
+			writeError(w, err)
+			return
+		}
+		job, err := api.sched.getJob(api.namespace, ref.ID, ref.Func, ref.Name)
+		if err == nil {
+			job, err = api.sched.loadArgs(job)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+		break
+	case "PUT":
+		if ref.ID > 0 {
+			allowMethod(w, req, "GET", "PATCH", "DELETE")
+			return
+		}
+		api.handleSubmitJob(w, req, ref)
+		break
+	case "PATCH":
+		api.handleUpdateJob(w, req, ref)
+		break
+	case "DELETE":
+		if err := api.authorizeJob(RoleRemove, ref); err != nil {
+			writeError(w, err)
+			return
+		}
+		if _, err := api.sched.removeJob(api.namespace, ref.ID, ref.Func, ref.Name); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		break
+	default:
+		if ref.ID > 0 {
+			allowMethod(w, req, "GET", "PATCH", "DELETE")
+		} else {
+			allowMethod(w, req, "GET", "PUT", "PATCH", "DELETE")
+		}
+		break
+	}
+}
+
+func (api apiHandler) handleJobAction(w http.ResponseWriter, req *http.Request, ref jobRef, action string) {
+	var job driver.Job
+	var err error
+	var role = RoleSubmit
+	if action == "results" {
+		role = RoleStatus
+	}
+	if err = api.authorizeJob(role, ref); err != nil {
+		writeError(w, err)
+		return
+	}
+	switch action {
+	case "pause":
+		if !allowMethod(w, req, "POST") {
+			return
+		}
+		job, err = api.sched.pauseJob(api.namespace, ref.ID, ref.Func, ref.Name)
+		break
+	case "resume":
+		if !allowMethod(w, req, "POST") {
+			return
+		}
+		job, err = api.sched.resumeJob(api.namespace, ref.ID, ref.Func, ref.Name)
+		break
+	case "run":
+		if !allowMethod(w, req, "POST") {
+			return
+		}
+		job, err = api.sched.runJob(api.namespace, ref.ID, ref.Func, ref.Name)
+		break
+	case "results":
+		if allowMethod(w, req, "GET") {
+			api.handleResults(w, req, historyRequest{ID: ref.ID, Func: ref.Func, Name: ref.Name})
+		}
+		return
+	default:
+		writeErrorStatus(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (api apiHandler) handleSubmitJob(w http.ResponseWriter, req *http.Request, ref jobRef) {
+	body, err := readBody(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	job, err := driver.NewJob(body)
+	if err != nil {
+		writeError(w, validationError{err})
+		return
+	}
+	if ref.Func != "" {
+		job.Func = ref.Func
+	}
+	if ref.Name != "" {
+		job.Name = ref.Name
+	}
+	if job.TraceParent == "" {
+		job.TraceParent = req.Header.Get("traceparent")
+		job.TraceState = req.Header.Get("tracestate")
+	}
+	if job.Func != "" {
+		if err = api.authorize(RoleSubmit, job.Func); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	job, isNew, err := api.sched.saveJob(api.namespace, job)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if isNew {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Location", apiPrefix+"/jobs/"+strconv.FormatInt(job.ID, 10))
+	writeJSON(w, status, job)
+}
+
+func (api apiHandler) handleUpdateJob(w http.ResponseWriter, req *http.Request, ref jobRef) {
+	if err := api.authorizeJob(RoleSubmit, ref); err != nil {
+		writeError(w, err)
+		return
+	}
+	body, err := readBody(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(body, &fields); err != nil {
+		writeError(w, validationError{err})
+		return
+	}
+	if ref.ID > 0 {
+		fields["job_id"] = ref.ID
+	} else {
+		delete(fields, "job_id")
+		fields["func"] = ref.Func
+		fields["name"] = ref.Name
+	}
+	// the revision can be given by If-Match
+	if _, ok := fields["revision"]; !ok {
+		if v := strings.Trim(req.Header.Get("If-Match"), "\" "); v != "" {
+			revision, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				writeErrorStatus(w, http.StatusBadRequest, "invalid If-Match: "+v)
+				return
+			}
+			fields["revision"] = revision
+		}
+	}
+	payload, _ := json.Marshal(fields)
+	job, err := api.sched.updateJob(api.namespace, payload)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (api apiHandler) handleResults(w http.ResponseWriter, req *http.Request, hreq historyRequest) {
+	if v := req.URL.Query().Get("limit"); v != "" {
+		var err error
+		if hreq.Limit, err = strconv.Atoi(v); err != nil {
+			writeErrorStatus(w, http.StatusBadRequest, "invalid limit: "+v)
+			return
+		}
+	}
+	records, err := api.sched.queryHistory(api.namespace, hreq)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]driver.History{"results": records})
+}
+
+func (api apiHandler) handleBatch(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" && req.Method != "DELETE" {
+		allowMethod(w, req, "POST", "DELETE")
+		return
+	}
+	body, err := readBody(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var packed map[string][]json.RawMessage
+	if err = json.Unmarshal(body, &packed); err != nil {
+		writeError(w, validationError{err})
+		return
+	}
+	jobs, results := parseJobList(packed["jobs"])
+	if req.Method == "POST" {
+		api.sched.authorizeJobs(api.identity, api.namespace, RoleSubmit, jobs, results)
+		api.sched.batchSubmitJob(api.namespace, jobs, results)
+	} else {
+		api.sched.authorizeJobs(api.identity, api.namespace, RoleRemove, jobs, results)
+		api.sched.batchRemoveJob(api.namespace, jobs, results)
+	}
+	writeJSON(w, http.StatusOK, map[string][]batchResult{"results": results})
+}
+
+func (api apiHandler) handleWebhook(w http.ResponseWriter, req *http.Request, Func string) {
+	var role = RoleSubmit
+	if req.Method == "GET" {
+		role = RoleStatus
+	}
+	if err := api.authorize(role, Func); err != nil {
+		writeError(w, err)
+		return
+	}
+	switch req.Method {
+	case "GET":
+		var wreq = webhookRequest{Func: Func}
+		if v := req.URL.Query().Get("limit"); v != "" {
+			var err error
+			if wreq.Limit, err = strconv.Atoi(v); err != nil {
+				writeErrorStatus(w, http.StatusBadRequest, "invalid limit: "+v)
+				return
+			}
+		}
+		result, err := api.sched.getWebhook(api.namespace, wreq)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+		break
+	case "PUT":
+		body, err := readBody(req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		hook, err := driver.NewWebhook(body)
+		if err != nil {
+			writeError(w, validationError{err})
+			return
+		}
+		hook.Func = Func
+		if hook.URL == "" {
+			writeError(w, validationError{errors.New("url is required")})
+			return
+		}
+		if err = api.sched.setWebhook(api.namespace, hook); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, hook)
+		break
+	case "DELETE":
+		if err := api.sched.setWebhook(api.namespace, driver.Webhook{Func: Func}); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		break
+	default:
+		allowMethod(w, req, "GET", "PUT", "DELETE")
+		break
+	}
+}
+
+// handleEvents stream the scheduler events as server-sent events.
+func (api apiHandler) handleEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorStatus(w, http.StatusInternalServerError, "Streaming is not supported.")
+		return
+	}
+	var filter eventFilter
+	query := req.URL.Query()
+	filter.Funcs = query["func"]
+	for _, t := range query["type"] {
+		filter.Types = append(filter.Types, EventType(t))
+	}
+	filter.allow = api.sched.funcFilter(api.identity, api.namespace)
+	filter.namespace = api.namespace
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	id, events := api.sched.events.subscribe(eventBufferSize)
+	defer api.sched.events.unsubscribe(id)
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			_, err = io.WriteString(w, ":\n\n")
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if !filter.match(e) {
+				continue
+			}
+			_, err = io.WriteString(w, "event: "+string(e.Type)+"\ndata: "+string(e.Bytes())+"\n\n")
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+type sstat struct {
+	FuncName    string `json:"func_name"`
+	TotalWorker int    `json:"total_worker"`
+	TotalJob    int    `json:"total_job"`
+	Processing  int    `json:"processing"`
+	stat.Report
+}
+
+// funcStatus get the status of all funcs of the namespace
+func (sched *Sched) funcStatus(ns string) map[string]sstat {
+	defer sched.funcLocker.Unlock()
+	sched.funcLocker.Lock()
+	var stats = make(map[string]sstat)
+	now := time.Now()
+	for _, st := range sched.stats {
+		if st.Namespace != ns {
+			continue
+		}
+		stats[st.Name] = sstat{
+			FuncName:    st.Name,
+			TotalWorker: int(st.Worker.Int()),
+			TotalJob:    int(st.Job.Int()),
+			Processing:  int(st.Processing.Int()),
+			Report:      st.Report(now),
+		}
+	}
+	return stats
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+	if err != nil {
+		return nil, validationError{err}
+	}
+	if len(body) > maxBodySize {
+		return nil, validationError{errors.New("request body too large")}
+	}
+	return body, nil
+}
+
+// allowMethod check the request method, reply 405 when it is not allowed.
+func allowMethod(w http.ResponseWriter, req *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if req.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeErrorStatus(w, http.StatusMethodNotAllowed, "Method "+req.Method+" not allowed.")
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func (api apiHandler) authorize(role Role, Func string) error {
+	return api.sched.authorize(api.identity, api.namespace, role, Func)
+}
+
+func (api apiHandler) authorizeJob(role Role, ref jobRef) error {
+	return api.sched.authorizeJob(api.identity, api.namespace, role, ref.ID, ref.Func)
+}
+
+// listWorkers list the workers with the funcs the identity can read, the
+// workers without such func are omitted.
+func (api apiHandler) listWorkers() []workerInfo {
+	workers := api.sched.listWorkers(api.namespace)
+	allow := api.sched.funcFilter(api.identity, api.namespace)
+	if allow == nil {
+		return workers
+	}
+	var allowed = make([]workerInfo, 0, len(workers))
+	for _, info := range workers {
+		var funcs = make([]string, 0, len(info.Funcs))
+		for _, Func := range info.Funcs {
+			if allow(Func) {
+				funcs = append(funcs, Func)
+			}
+		}
+		if len(funcs) > 0 {
+			info.Funcs = funcs
+			allowed = append(allowed, info)
+		}
+	}
+	return allowed
+}
+
+// errorStatus map the error to the http status
+func errorStatus(err error) int {
+	switch err {
+	case ErrUnauthorized:
+		return http.StatusUnauthorized
+	case ErrJobNotExists, ErrFuncNotExists:
+		return http.StatusNotFound
+	case ErrRevisionConflict, ErrJobProcessing, ErrJobNotPaused, ErrJobPaused, ErrFuncHasWorker, ErrHelloRepeated:
+		return http.StatusConflict
+	case protocol.ErrFrameTooLarge:
+		return http.StatusRequestEntityTooLarge
+	}
+	if _, ok := err.(validationError); ok {
+		return http.StatusBadRequest
+	}
+	if _, ok := err.(forbiddenError); ok {
+		return http.StatusForbidden
+	}
+	if _, ok := err.(quotaError); ok {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		httpLog.Error("Request failed", "err", err)
+	}
+	writeErrorStatus(w, status, err.Error())
+}
+
+// writeErrorStatus reply the error body:
+//
+//	{"error": {"code": "not_found", "message": "Job not exists."}}
+func writeErrorStatus(w http.ResponseWriter, status int, message string) {
+	code := strings.Replace(strings.ToLower(http.StatusText(status)), " ", "_", -1)
+	writeJSON(w, status, map[string]map[string]string{
+		"error": {"code": code, "message": message},
+	})
+}
@@ -0,0 +1,147 @@
+package periodic
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmuyuyang/periodic/protocol"
+)
+
+// ErrUnauthorized the token is missing or rejected
+var ErrUnauthorized = errors.New("Unauthorized.")
+
+// authTimeout how long the server wait for the client type and the AUTH packet
+const authTimeout = 10 * time.Second
+
+// staticToken a token configured on the server
+type staticToken struct {
+	identity string
+	token    []byte
+}
+
+// authenticator check the static tokens and the tokens signed by the secret
+type authenticator struct {
+	tokens []staticToken
+	secret []byte
+}
+
+// SetAuth require the connections and the HTTP requests to authenticate by
+// one of the static tokens "[identity:]token" or a token signed by the secret.
+// The authentication is disabled when both are empty.
+func (sched *Sched) SetAuth(tokens []string, secret string) {
+	var auth = new(authenticator)
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		identity := "static"
+		if idx := strings.Index(token, ":"); idx > 0 {
+			identity = token[:idx]
+			token = token[idx+1:]
+		}
+		auth.tokens = append(auth.tokens, staticToken{identity: identity, token: []byte(token)})
+	}
+	if secret != "" {
+		auth.secret = []byte(secret)
+	}
+	if len(auth.tokens) == 0 && auth.secret == nil {
+		auth = nil
+	}
+	sched.auth = auth
+}
+
+// SignToken sign a token "identity.expires_at.signature" by the secret, the
+// token never expire when expiresAt is 0.
+func SignToken(secret, identity string, expiresAt int64) string {
+	payload := identity + "." + strconv.FormatInt(expiresAt, 10)
+	return payload + "." + tokenSignature([]byte(secret), payload)
+}
+
+func tokenSignature(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authenticate check the token and return the identity of it
+func (auth *authenticator) authenticate(token string) (identity string, err error) {
+	if token == "" {
+		return "", ErrUnauthorized
+	}
+	for _, t := range auth.tokens {
+		if subtle.ConstantTimeCompare(t.token, []byte(token)) == 1 {
+			return t.identity, nil
+		}
+	}
+	if auth.secret == nil {
+		return "", ErrUnauthorized
+	}
+	idx := strings.LastIndex(token, ".")
+	if idx <= 0 {
+		return "", ErrUnauthorized
+	}
+	payload, sign := token[:idx], token[idx+1:]
+	if !hmac.Equal([]byte(sign), []byte(tokenSignature(auth.secret, payload))) {
+		return "", ErrUnauthorized
+	}
+	idx = strings.LastIndex(payload, ".")
+	if idx <= 0 {
+		return "", ErrUnauthorized
+	}
+	expiresAt, e := strconv.ParseInt(payload[idx+1:], 10, 64)
+	if e != nil || (expiresAt > 0 && expiresAt < time.Now().Unix()) {
+		return "", ErrUnauthorized
+	}
+	return payload[:idx], nil
+}
+
+// authenticateConn read the AUTH packet right after the client type byte,
+// the connection is closed when it is rejected. The caller set the
+// authTimeout deadline.
+func (sched *Sched) authenticateConn(c protocol.Conn) (identity string, err error) {
+	payload, err := c.Receive()
+	if err != nil {
+		c.Close()
+		return
+	}
+	err = ErrUnauthorized
+	msgID, cmd, token, e := protocol.ParseCommand(payload)
+	if e != nil {
+		protoLog.Warn("Invalid AUTH packet", "err", e)
+	} else if cmd == protocol.AUTH {
+		if identity, err = sched.auth.authenticate(string(token)); err == nil {
+			buf := bytes.NewBuffer(nil)
+			buf.Write(msgID)
+			buf.Write(protocol.NullChar)
+			buf.Write(protocol.SUCCESS.Bytes())
+			err = c.Send(buf.Bytes())
+		}
+	}
+	if err != nil {
+		// the errors is not negotiated yet
+		if err == ErrUnauthorized {
+			c.Send([]byte(err.Error()))
+		}
+		c.Close()
+	}
+	return
+}
+
+// authenticateRequest check the bearer token of the HTTP request, the
+// access_token query is accepted for the EventSource of the browsers.
+func (sched *Sched) authenticateRequest(req *http.Request) (identity string, err error) {
+	token := req.URL.Query().Get("access_token")
+	if h := req.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimSpace(h[len("Bearer "):])
+	}
+	return sched.auth.authenticate(token)
+}
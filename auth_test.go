@@ -0,0 +1,66 @@
+package periodic
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateStatic(t *testing.T) {
+	var sched = new(Sched)
+	sched.SetAuth([]string{"billing:b0", " s3cret ", "", "ops:x:y"}, "")
+	var cases = []struct {
+		token    string
+		identity string
+		err      error
+	}{
+		{"b0", "billing", nil},
+		// the token without identity is the identity "static"
+		{"s3cret", "static", nil},
+		// the identity end at the first ":"
+		{"x:y", "ops", nil},
+		{"billing:b0", "", ErrUnauthorized},
+		{"", "", ErrUnauthorized},
+	}
+	for _, c := range cases {
+		identity, err := sched.auth.authenticate(c.token)
+		if identity != c.identity || err != c.err {
+			t.Fatalf("authenticate(%q): except: %q, %v, got: %q, %v", c.token, c.identity, c.err, identity, err)
+		}
+	}
+
+	sched.SetAuth([]string{" "}, "")
+	if sched.auth != nil {
+		t.Fatalf("SetAuth: except the authentication disabled")
+	}
+}
+
+func TestAuthenticateSigned(t *testing.T) {
+	var sched = new(Sched)
+	sched.SetAuth(nil, "secret")
+	var expiresAt = time.Now().Add(time.Hour).Unix()
+
+	var token = SignToken("secret", "billing", expiresAt)
+	if identity, err := sched.auth.authenticate(token); identity != "billing" || err != nil {
+		t.Fatalf("authenticate: except: billing, got: %q, %v", identity, err)
+	}
+	// the identity may contain "."
+	token = SignToken("secret", "billing.eu", 0)
+	if identity, err := sched.auth.authenticate(token); identity != "billing.eu" || err != nil {
+		t.Fatalf("authenticate: except: billing.eu, got: %q, %v", identity, err)
+	}
+
+	var rejected = []string{
+		SignToken("secret", "billing", time.Now().Add(-time.Second).Unix()),
+		SignToken("other", "billing", expiresAt),
+		strings.Replace(SignToken("secret", "billing", expiresAt), "billing", "admin", 1),
+		SignToken("secret", "billing", expiresAt) + "0",
+		"billing." + strings.Repeat("0", 64),
+		"nosignature",
+	}
+	for _, token := range rejected {
+		if _, err := sched.auth.authenticate(token); err != ErrUnauthorized {
+			t.Fatalf("authenticate(%q): except: %v, got: %v", token, ErrUnauthorized, err)
+		}
+	}
+}
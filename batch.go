@@ -0,0 +1,147 @@
+package periodic
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jmuyuyang/periodic/driver"
+)
+
+// batchResult defined the result of one job in a batch request
+type batchResult struct {
+	ID  int64  `json:"job_id,omitempty"`
+	Err string `json:"err,omitempty"`
+}
+
+func (r *batchResult) setError(e error) {
+	r.ID = 0
+	r.Err = e.Error()
+}
+
+// parseJobList parse a job array, returns the parsed jobs and results.
+// A job fail to parse have the error set in results.
+func parseJobList(data []json.RawMessage) ([]driver.Job, []batchResult) {
+	var jobs = make([]driver.Job, len(data))
+	var results = make([]batchResult, len(data))
+	for i, raw := range data {
+		job, e := driver.NewJob(raw)
+		if e == nil && (job.Name == "" || job.Func == "") {
+			e = ErrJobRequired
+		}
+		if e != nil {
+			results[i].setError(e)
+			continue
+		}
+		jobs[i] = job
+	}
+	return jobs, results
+}
+
+// batchSubmitJob submit a batch of jobs to the namespace with one lock and one
+// driver call. The job with an error in results is skipped.
+func (sched *Sched) batchSubmitJob(ns string, jobs []driver.Job, results []batchResult) {
+	// offload the large args before the jobLocker, the blobs may be large.
+	var blobs = make([]string, len(jobs))
+	for i := range jobs {
+		if results[i].Err != "" {
+			continue
+		}
+		var e error
+		if blobs[i], e = sched.offloadArgs(&jobs[i]); e != nil {
+			results[i].setError(e)
+		}
+	}
+	defer func() {
+		for i, blob := range blobs {
+			if results[i].Err != "" {
+				sched.removeBlob(blob)
+			}
+		}
+	}()
+	defer sched.notifyJobTimer()
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	var saveJobs = make([]*driver.Job, 0, len(jobs))
+	var saveIdx = make([]int, 0, len(jobs))
+	var isNew = make([]bool, len(jobs))
+	var changed = make([]bool, len(jobs))
+	var seen = make(map[string]bool)
+	var now = time.Now().Unix()
+	var added int64
+	for i := range jobs {
+		if results[i].Err != "" {
+			continue
+		}
+		job := &jobs[i]
+		job.Namespace = ns
+		key := job.Func + ":" + job.Name
+		if seen[key] {
+			results[i].setError(errors.New("Duplicate Job name: " + job.Name))
+			continue
+		}
+		seen[key] = true
+		if e := sched.allowSubmit(ns, 1); e != nil {
+			results[i].setError(e)
+			continue
+		}
+		isNew[i], changed[i] = sched.prepareJob(job, now)
+		if isNew[i] {
+			if e := sched.checkMaxJobs(ns, added+1); e != nil {
+				results[i].setError(e)
+				continue
+			}
+			added++
+		}
+		saveJobs = append(saveJobs, job)
+		saveIdx = append(saveIdx, i)
+	}
+
+	errs := sched.driver.SaveBatch(saveJobs)
+	for k, e := range errs {
+		i := saveIdx[k]
+		if e != nil {
+			results[i].setError(e)
+			continue
+		}
+		job := jobs[i]
+		results[i].ID = job.ID
+		sched.queueJob(job, isNew[i], changed[i])
+	}
+}
+
+// batchRemoveJob remove a batch of jobs of the namespace with one lock and one
+// driver call. The job with an error in results is skipped.
+func (sched *Sched) batchRemoveJob(ns string, jobs []driver.Job, results []batchResult) {
+	defer sched.notifyJobTimer()
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	var removeJobs = make([]driver.Job, 0, len(jobs))
+	var removeIDs = make([]int64, 0, len(jobs))
+	var removeIdx = make([]int, 0, len(jobs))
+	for i, job := range jobs {
+		if results[i].Err != "" {
+			continue
+		}
+		job, e := sched.findJob(ns, 0, job.Func, job.Name)
+		if e != nil {
+			results[i].setError(e)
+			continue
+		}
+		removeJobs = append(removeJobs, job)
+		removeIDs = append(removeIDs, job.ID)
+		removeIdx = append(removeIdx, i)
+	}
+
+	errs := sched.driver.DeleteBatch(removeIDs)
+	for k, e := range errs {
+		i := removeIdx[k]
+		if e != nil {
+			results[i].setError(e)
+			continue
+		}
+		job := removeJobs[k]
+		results[i].ID = job.ID
+		sched.forgetJob(job)
+	}
+}
@@ -4,21 +4,31 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
-	"log"
+	"time"
 
 	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/logger"
 	"github.com/jmuyuyang/periodic/protocol"
 )
 
+// eventBufferSize the events buffered for a subscriber
+const eventBufferSize = 100
+
 type client struct {
-	sched *Sched
-	conn  protocol.Conn
+	sched     *Sched
+	conn      protocol.Conn
+	subID     int
+	identity  string // The authenticated identity, empty when anonymous
+	namespace string // The namespace of the connection
+	session
 }
 
 func newClient(sched *Sched, conn protocol.Conn) (c *client) {
 	c = new(client)
 	c.conn = conn
 	c.sched = sched
+	c.namespace = driver.DefaultNamespace
+	c.session = newSession()
 	return
 }
 
@@ -30,31 +40,46 @@ func (c *client) handle() {
 	var conn = c.conn
 	defer func() {
 		if x := recover(); x != nil {
-			log.Printf("[client] painc: %v\n", x)
+			protoLog.Error("Client panic", "panic", x)
 		}
 	}()
 	defer conn.Close()
+	defer c.unsubscribe()
 	for {
-		payload, err = conn.Receive()
+		payload, err = c.receive(conn)
 		if err != nil {
 			if err != io.EOF {
-				log.Printf("clientError: %s\n", err.Error())
+				protoLog.Warn("Client error", "err", err)
 			}
 			return
 		}
 
-		msgID, cmd, payload = protocol.ParseCommand(payload)
+		msgID, cmd, payload, err = protocol.ParseCommand(payload)
+		if err != nil {
+			// the frame is intact, reply the error and keep the connection
+			if err = c.handleError(nil, validationError{err}); err != nil {
+				return
+			}
+			continue
+		}
 
 		switch cmd {
 		case protocol.SUBMITJOB:
 			err = c.handleSubmitJob(msgID, payload)
 			break
 		case protocol.STATUS:
-			err = c.handleStatus(msgID)
+			err = c.handleStatus(msgID, payload)
 			break
 		case protocol.PING:
 			err = c.handleCommand(msgID, protocol.PONG)
 			break
+		case protocol.AUTH:
+			// authenticated on the handshake or the authentication is disabled
+			err = c.handleCommand(msgID, protocol.SUCCESS)
+			break
+		case protocol.HELLO:
+			err = c.handleHello(conn, msgID, payload)
+			break
 		case protocol.DROPFUNC:
 			err = c.handleDropFunc(msgID, payload)
 			break
@@ -67,13 +92,58 @@ func (c *client) handle() {
 		case protocol.LOAD:
 			err = c.handleLoad(msgID, payload)
 			break
+		case protocol.SUBMITJOBS:
+			if !c.enabled(protocol.CapBatch) {
+				err = c.handleCommand(msgID, protocol.UNKNOWN)
+				break
+			}
+			err = c.handleSubmitJobs(msgID, payload)
+			break
+		case protocol.REMOVEJOBS:
+			if !c.enabled(protocol.CapBatch) {
+				err = c.handleCommand(msgID, protocol.UNKNOWN)
+				break
+			}
+			err = c.handleRemoveJobs(msgID, payload)
+			break
+		case protocol.UPDATEJOB:
+			err = c.handleUpdateJob(msgID, payload)
+			break
+		case protocol.HISTORY:
+			err = c.handleHistory(msgID, payload)
+			break
+		case protocol.SUBSCRIBE:
+			err = c.handleSubscribe(msgID, payload)
+			break
+		case protocol.UNSUBSCRIBE:
+			c.unsubscribe()
+			err = c.handleCommand(msgID, protocol.SUCCESS)
+			break
+		case protocol.SETWEBHOOK:
+			err = c.handleSetWebhook(msgID, payload)
+			break
+		case protocol.REMOVEWEBHOOK:
+			err = c.handleRemoveWebhook(msgID, payload)
+			break
+		case protocol.WEBHOOK:
+			err = c.handleWebhook(msgID, payload)
+			break
+		case protocol.LOGLEVEL:
+			err = c.handleLogLevel(msgID, payload)
+			break
+		case protocol.GETJOB:
+			err = c.handleGetJob(msgID, payload)
+			break
+		case protocol.LISTJOBS:
+			err = c.handleListJobs(msgID, payload)
+			break
 		default:
 			err = c.handleCommand(msgID, protocol.UNKNOWN)
 			break
 		}
 		if err != nil {
 			if err != io.EOF {
-				log.Printf("clientError: %s\n", err.Error())
+				protoLog.Warn("Client error", "err", err)
 			}
 			return
 		}
@@ -89,59 +159,321 @@ func (c *client) handleCommand(msgID []byte, cmd protocol.Command) (err error) {
 	return
 }
 
+// handleError reply the error, by an ERROR response when the errors is
+// negotiated.
+func (c *client) handleError(msgID []byte, e error) error {
+	return c.replyError(c.conn, msgID, e)
+}
+
+func (c *client) authorize(role Role, Func string) error {
+	return c.sched.authorize(c.identity, c.namespace, role, Func)
+}
+
 func (c *client) handleSubmitJob(msgID []byte, payload []byte) (err error) {
+	job, e := driver.NewJob(payload)
+	if e != nil {
+		e = validationError{e}
+	} else {
+		e = c.authorize(RoleSubmit, job.Func)
+	}
+	if e == nil {
+		_, _, e = c.sched.saveJob(c.namespace, job)
+	}
+	if e != nil {
+		err = c.handleError(msgID, e)
+		return
+	}
+	err = c.handleCommand(msgID, protocol.SUCCESS)
+	return
+}
+
+func (c *client) handleSubmitJobs(msgID []byte, payload []byte) (err error) {
+	var packed map[string][]json.RawMessage
+	if e := json.Unmarshal(payload, &packed); e != nil {
+		err = c.handleError(msgID, validationError{e})
+		return
+	}
+	jobs, results := parseJobList(packed["jobs"])
+	c.sched.authorizeJobs(c.identity, c.namespace, RoleSubmit, jobs, results)
+	c.sched.batchSubmitJob(c.namespace, jobs, results)
+	err = c.handleResults(msgID, results)
+	return
+}
+
+func (c *client) handleRemoveJobs(msgID []byte, payload []byte) (err error) {
+	var packed map[string][]json.RawMessage
+	if e := json.Unmarshal(payload, &packed); e != nil {
+		err = c.handleError(msgID, validationError{e})
+		return
+	}
+	jobs, results := parseJobList(packed["jobs"])
+	c.sched.authorizeJobs(c.identity, c.namespace, RoleRemove, jobs, results)
+	c.sched.batchRemoveJob(c.namespace, jobs, results)
+	err = c.handleResults(msgID, results)
+	return
+}
+
+func (c *client) handleUpdateJob(msgID []byte, payload []byte) (err error) {
+	var req jobRequest
 	var job driver.Job
-	var e error
-	var conn = c.conn
-	var sched = c.sched
-	defer sched.jobLocker.Unlock()
-	sched.jobLocker.Lock()
-	job, e = driver.NewJob(payload)
+	e := json.Unmarshal(payload, &req)
 	if e != nil {
-		err = conn.Send([]byte(e.Error()))
+		e = validationError{e}
+	} else {
+		e = c.sched.authorizeJob(c.identity, c.namespace, RoleSubmit, req.ID, req.Func)
+	}
+	if e == nil {
+		job, e = c.sched.updateJob(c.namespace, payload)
+	}
+	if e != nil {
+		err = c.handleError(msgID, e)
 		return
 	}
-	isNew := true
-	changed := false
-	job.SetReady()
-	oldJob, e := sched.driver.GetOne(job.Func, job.Name)
-	if e == nil && oldJob.ID > 0 {
-		job.ID = oldJob.ID
-		if oldJob.IsProc() {
-			sched.decrStatProc(oldJob)
-			sched.removeRevertPQ(job)
-			changed = true
-		}
-		isNew = false
+	buffer := bytes.NewBuffer(nil)
+	buffer.Write(msgID)
+	buffer.Write(protocol.NullChar)
+	buffer.Write(job.Bytes())
+	err = c.conn.Send(buffer.Bytes())
+	return
+}
+
+func (c *client) handleGetJob(msgID []byte, payload []byte) (err error) {
+	var req jobRequest
+	var job driver.Job
+	e := json.Unmarshal(payload, &req)
+	if e != nil {
+		e = validationError{e}
+	} else {
+		e = c.sched.authorizeJob(c.identity, c.namespace, RoleStatus, req.ID, req.Func)
+	}
+	if e == nil {
+		job, e = c.sched.getJob(c.namespace, req.ID, req.Func, req.Name)
+	}
+	if e == nil {
+		job, e = c.sched.loadArgs(job)
 	}
-	e = sched.driver.Save(&job)
 	if e != nil {
-		err = conn.Send([]byte(e.Error()))
+		err = c.handleError(msgID, e)
 		return
 	}
+	buffer := bytes.NewBuffer(nil)
+	buffer.Write(msgID)
+	buffer.Write(protocol.NullChar)
+	buffer.Write(job.Bytes())
+	err = c.conn.Send(buffer.Bytes())
+	return
+}
 
-	if isNew {
-		if job.IsPeriod() {
-			job.ResetPeriod()
+func (c *client) handleListJobs(msgID []byte, payload []byte) (err error) {
+	var req listRequest
+	if len(payload) > 0 {
+		if e := json.Unmarshal(payload, &req); e != nil {
+			err = c.handleError(msgID, validationError{e})
+			return
 		}
-		sched.incrStatJob(job)
 	}
-	if isNew || changed {
-		sched.pushJobPQ(job)
+	req.allow = c.sched.funcFilter(c.identity, c.namespace)
+	buffer := bytes.NewBuffer(nil)
+	buffer.Write(msgID)
+	buffer.Write(protocol.NullChar)
+	data, _ := json.Marshal(c.sched.listJobs(c.namespace, req))
+	buffer.Write(data)
+	err = c.conn.Send(buffer.Bytes())
+	return
+}
+
+func (c *client) handleHistory(msgID []byte, payload []byte) (err error) {
+	var req historyRequest
+	var records []driver.History
+	e := json.Unmarshal(payload, &req)
+	if e != nil {
+		e = validationError{e}
+	} else {
+		e = c.sched.authorizeJob(c.identity, c.namespace, RoleStatus, req.ID, req.Func)
+	}
+	if e == nil {
+		records, e = c.sched.queryHistory(c.namespace, req)
+	}
+	if e != nil {
+		err = c.handleError(msgID, e)
+		return
+	}
+	buffer := bytes.NewBuffer(nil)
+	buffer.Write(msgID)
+	buffer.Write(protocol.NullChar)
+	data, _ := json.Marshal(map[string][]driver.History{"history": records})
+	buffer.Write(data)
+	err = c.conn.Send(buffer.Bytes())
+	return
+}
+
+func (c *client) handleSetWebhook(msgID []byte, payload []byte) (err error) {
+	hook, e := driver.NewWebhook(payload)
+	if e != nil {
+		e = validationError{e}
+	} else {
+		e = c.authorize(RoleSubmit, hook.Func)
+	}
+	if e == nil {
+		e = c.sched.setWebhook(c.namespace, hook)
+	}
+	if e != nil {
+		err = c.handleError(msgID, e)
+		return
+	}
+	err = c.handleCommand(msgID, protocol.SUCCESS)
+	return
+}
+
+func (c *client) handleRemoveWebhook(msgID []byte, payload []byte) (err error) {
+	e := c.authorize(RoleSubmit, string(payload))
+	if e == nil {
+		e = c.sched.setWebhook(c.namespace, driver.Webhook{Func: string(payload)})
+	}
+	if e != nil {
+		err = c.handleError(msgID, e)
+		return
 	}
-	sched.notifyJobTimer()
 	err = c.handleCommand(msgID, protocol.SUCCESS)
 	return
 }
 
-func (c *client) handleStatus(msgID []byte) (err error) {
+func (c *client) handleWebhook(msgID []byte, payload []byte) (err error) {
+	var req webhookRequest
+	var result map[string]interface{}
+	e := json.Unmarshal(payload, &req)
+	if e != nil {
+		e = validationError{e}
+	} else if req.Func != "" {
+		e = c.authorize(RoleStatus, req.Func)
+	}
+	if e == nil {
+		result, e = c.sched.getWebhook(c.namespace, req)
+	}
+	if e != nil {
+		err = c.handleError(msgID, e)
+		return
+	}
+	buffer := bytes.NewBuffer(nil)
+	buffer.Write(msgID)
+	buffer.Write(protocol.NullChar)
+	data, _ := json.Marshal(result)
+	buffer.Write(data)
+	err = c.conn.Send(buffer.Bytes())
+	return
+}
+
+func (c *client) handleLogLevel(msgID []byte, payload []byte) (err error) {
+	var role = RoleStatus
+	if len(payload) > 0 {
+		role = RoleDump
+	}
+	if e := c.authorize(role, ""); e != nil {
+		err = c.handleError(msgID, e)
+		return
+	}
+	if len(payload) > 0 {
+		var req struct {
+			Subsystem string `json:"subsystem"`
+			Level     string `json:"level"`
+		}
+		var level logger.Level
+		e := json.Unmarshal(payload, &req)
+		if e == nil {
+			level, e = logger.ParseLevel(req.Level)
+		}
+		if e != nil {
+			err = c.handleError(msgID, validationError{e})
+			return
+		}
+		logger.SetLevel(req.Subsystem, level)
+		protoLog.Info("Log level changed", "target", req.Subsystem, "level", level)
+	}
+	buffer := bytes.NewBuffer(nil)
+	buffer.Write(msgID)
+	buffer.Write(protocol.NullChar)
+	data, _ := json.Marshal(map[string]map[string]string{"levels": logger.Levels()})
+	buffer.Write(data)
+	err = c.conn.Send(buffer.Bytes())
+	return
+}
+
+func (c *client) handleSubscribe(msgID []byte, payload []byte) (err error) {
+	var filter eventFilter
+	if len(payload) > 0 {
+		if e := json.Unmarshal(payload, &filter); e != nil {
+			err = c.handleError(msgID, validationError{e})
+			return
+		}
+	}
+	filter.allow = c.sched.funcFilter(c.identity, c.namespace)
+	filter.namespace = c.namespace
+	c.unsubscribe()
+	if err = c.handleCommand(msgID, protocol.SUCCESS); err != nil {
+		return
+	}
+	id, events := c.sched.events.subscribe(eventBufferSize)
+	c.subID = id
+	go c.pushEvents(msgID, filter, events)
+	return
+}
+
+func (c *client) pushEvents(msgID []byte, filter eventFilter, events <-chan Event) {
+	for e := range events {
+		if !filter.match(e) {
+			continue
+		}
+		buf := bytes.NewBuffer(nil)
+		buf.Write(msgID)
+		buf.Write(protocol.NullChar)
+		buf.Write(protocol.EVENT.Bytes())
+		buf.Write(protocol.NullChar)
+		buf.Write(e.Bytes())
+		if err := c.conn.Send(buf.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func (c *client) unsubscribe() {
+	if c.subID > 0 {
+		c.sched.events.unsubscribe(c.subID)
+		c.subID = 0
+	}
+}
+
+func (c *client) handleResults(msgID []byte, results []batchResult) (err error) {
+	buffer := bytes.NewBuffer(nil)
+	buffer.Write(msgID)
+	buffer.Write(protocol.NullChar)
+	data, _ := json.Marshal(map[string][]batchResult{"results": results})
+	buffer.Write(data)
+	err = c.conn.Send(buffer.Bytes())
+	return
+}
+
+// handleStatus reply the counters of the funcs, the rolling report is
+// appended when the payload is "extended".
+func (c *client) handleStatus(msgID []byte, payload []byte) (err error) {
+	extended := string(payload) == "extended"
 	buf := bytes.NewBuffer(nil)
 	buf.Write(msgID)
 	buf.Write(protocol.NullChar)
 	defer c.sched.funcLocker.Unlock()
 	c.sched.funcLocker.Lock()
+	now := time.Now()
 	for _, stat := range c.sched.stats {
+		if stat.Namespace != c.namespace {
+			continue
+		}
+		if !c.sched.allow(c.identity, c.namespace, RoleStatus, stat.Name) {
+			continue
+		}
 		buf.WriteString(stat.String())
+		if extended {
+			buf.WriteString(",")
+			buf.WriteString(stat.Report(now).String())
+		}
 		buf.WriteString("\n")
 	}
 	err = c.conn.Send(buf.Bytes())
@@ -149,76 +481,48 @@ func (c *client) handleStatus(msgID []byte) (err error) {
 }
 
 func (c *client) handleDropFunc(msgID []byte, payload []byte) (err error) {
-	Func := string(payload)
-	sched := c.sched
-	defer sched.notifyJobTimer()
-	defer sched.jobLocker.Unlock()
-	sched.jobLocker.Lock()
-
-	defer sched.funcLocker.Unlock()
-	sched.funcLocker.Lock()
-	stat, ok := sched.stats[Func]
-	if ok && stat.Worker.Int() == 0 {
-		iter := sched.driver.NewIterator(payload)
-		var deleteJob = make([]int64, 0)
-		for {
-			if !iter.Next() {
-				break
-			}
-			job := iter.Value()
-			deleteJob = append(deleteJob, job.ID)
-		}
-		iter.Close()
-		for _, jobID := range deleteJob {
-			sched.driver.Delete(jobID)
-		}
-		delete(sched.stats, Func)
-		delete(sched.jobPQ, Func)
+	if e := c.authorize(RoleDrop, string(payload)); e != nil {
+		err = c.handleError(msgID, e)
+		return
 	}
+	// the func has workers is kept silently.
+	c.sched.dropFunc(c.namespace, string(payload))
 	err = c.handleCommand(msgID, protocol.SUCCESS)
 	return
 }
 
 func (c *client) handleRemoveJob(msgID, payload []byte) (err error) {
-	var job driver.Job
-	var e error
-	var conn = c.conn
-	var sched = c.sched
-	defer sched.jobLocker.Unlock()
-	sched.jobLocker.Lock()
-	job, e = driver.NewJob(payload)
+	job, e := driver.NewJob(payload)
 	if e != nil {
-		err = conn.Send([]byte(e.Error()))
-		return
+		e = validationError{e}
+	} else {
+		e = c.authorize(RoleRemove, job.Func)
 	}
-	job, e = sched.driver.GetOne(job.Func, job.Name)
-	if e == nil && job.ID > 0 {
-		if _, ok := sched.procQueue[job.ID]; ok {
-			delete(sched.procQueue, job.ID)
-		}
-		sched.driver.Delete(job.ID)
-		sched.decrStatJob(job)
-		if job.IsProc() {
-			sched.decrStatProc(job)
-			sched.removeRevertPQ(job)
-		}
-		sched.notifyJobTimer()
+	if e == nil {
+		_, e = c.sched.removeJob(c.namespace, 0, job.Func, job.Name)
 	}
-
-	if e != nil {
-		err = conn.Send([]byte(e.Error()))
-	} else {
-		err = c.handleCommand(msgID, protocol.SUCCESS)
+	if e != nil && e != ErrJobNotExists {
+		err = c.handleError(msgID, e)
+		return
 	}
+	err = c.handleCommand(msgID, protocol.SUCCESS)
 	return
 }
 
+// dumpBatchArgsSize the args size of a DUMP batch
+const dumpBatchArgsSize = 4 << 20
+
 func (c *client) handleDump(msgID []byte) (err error) {
+	if e := c.authorize(RoleDump, ""); e != nil {
+		err = c.handleError(msgID, e)
+		return
+	}
 	var sched = c.sched
 	var batchSize = 100
 	var offset = 0
+	var size = 0
 	var jobList []driver.Job
-	iter := sched.driver.NewIterator(nil)
+	iter := sched.driver.NewIterator(c.namespace, nil)
 	for {
 		if !iter.Next() {
 			break
@@ -227,17 +531,26 @@ func (c *client) handleDump(msgID []byte) (err error) {
 		if job.Name == "" {
 			continue
 		}
+		// the dump carry the offloaded args
+		if job, err = sched.loadArgs(job); err != nil {
+			withJob(protoLog, job).Warn("Dump job without args", "err", err)
+			err = nil
+		}
 
 		if offset == 0 {
 			jobList = make([]driver.Job, 0)
+			size = 0
 		}
 
 		jobList = append(jobList, job)
 		offset = offset + 1
+		size = size + len(job.Args)
 
-		if offset == batchSize {
+		// the large args are sent by the smaller batches
+		if offset == batchSize || size >= dumpBatchArgsSize {
 			offset = 0
 			if err = c.handleJobList(msgID, jobList); err != nil {
+				iter.Close()
 				return
 			}
 		}
@@ -270,8 +583,13 @@ func (c *client) handleJobList(msgID []byte, jobList []driver.Job) (err error) {
 }
 
 func (c *client) handleLoad(msgID, payload []byte) (err error) {
+	if e := c.authorize(RoleDump, ""); e != nil {
+		err = c.handleError(msgID, e)
+		return
+	}
 	var packed map[string][]driver.Job
-	if err = json.Unmarshal(payload, &packed); err != nil {
+	if e := json.Unmarshal(payload, &packed); e != nil {
+		err = c.handleError(msgID, validationError{e})
 		return
 	}
 
@@ -288,9 +606,27 @@ func (c *client) handleLoad(msgID, payload []byte) (err error) {
 			runAt = job.SchedAt
 		}
 
-		job.SetReady()
+		if !job.IsPaused() {
+			job.SetReady()
+		}
+
+		job.Namespace = c.namespace
+		old, e := sched.driver.Get(job.ID)
+		if e == nil && old.ID > 0 && old.Namespace != c.namespace {
+			// the job id is taken by the other namespace, a new job is created.
+			job.ID = 0
+		}
+		// only the job overwritten in the namespace is not counted
+		if e != nil || old.ID <= 0 || job.ID == 0 {
+			if e := sched.checkMaxJobs(c.namespace, 1); e != nil {
+				withJob(protoLog, job).Warn("Load job skipped", "err", e)
+				continue
+			}
+		}
 
-		if err = sched.driver.Save(&job, true); err != nil {
+		if e := sched.driver.Save(&job, true); e != nil {
+			sched.notifyJobTimer()
+			err = c.handleError(msgID, e)
 			return
 		}
 
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"runtime"
 	"runtime/pprof"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jmuyuyang/periodic"
@@ -14,6 +17,8 @@ import (
 	"github.com/jmuyuyang/periodic/driver"
 	"github.com/jmuyuyang/periodic/driver/leveldb"
 	"github.com/jmuyuyang/periodic/driver/redis"
+	"github.com/jmuyuyang/periodic/logger"
+	"github.com/jmuyuyang/periodic/protocol"
 	"github.com/urfave/cli"
 )
 
@@ -29,6 +34,82 @@ func main() {
 			Usage:  "the server address eg: tcp://127.0.0.1:5000",
 			EnvVar: "PERIODIC_PORT",
 		},
+		cli.StringFlag{
+			Name:   "http",
+			Value:  "",
+			Usage:  "The REST API address eg: tcp://127.0.0.1:5001, disabled when empty",
+			EnvVar: "PERIODIC_HTTP_PORT",
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Value:  "",
+			Usage:  "The token to authenticate the connections",
+			EnvVar: "PERIODIC_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "namespace",
+			Value:  "",
+			Usage:  "The namespace of the jobs and the funcs, the default namespace when empty",
+			EnvVar: "PERIODIC_NAMESPACE",
+		},
+		cli.StringFlag{
+			Name:   "compression",
+			Value:  "",
+			Usage:  "Compress the frames of the client commands by [snappy], disabled when empty",
+			EnvVar: "PERIODIC_COMPRESSION",
+		},
+		cli.StringFlag{
+			Name:   "auth-token",
+			Value:  "",
+			Usage:  "The static tokens to authenticate, comma separated [identity:]token, disabled when empty",
+			EnvVar: "PERIODIC_AUTH_TOKENS",
+		},
+		cli.StringFlag{
+			Name:   "auth-secret",
+			Value:  "",
+			Usage:  "The HMAC secret to verify the signed tokens, disabled when empty",
+			EnvVar: "PERIODIC_AUTH_SECRET",
+		},
+		cli.StringFlag{
+			Name:   "acl",
+			Value:  "",
+			Usage:  "The json file of the roles granted to the identities, everything is allowed when empty",
+			EnvVar: "PERIODIC_ACL",
+		},
+		cli.StringFlag{
+			Name:   "quota",
+			Value:  "",
+			Usage:  "The json file of the quotas of the namespaces, unlimited when empty",
+			EnvVar: "PERIODIC_QUOTA",
+		},
+		cli.StringFlag{
+			Name:   "tls-cert",
+			Value:  "",
+			Usage:  "The TLS certificate file, the server serve TLS on tcp when it is set",
+			EnvVar: "PERIODIC_TLS_CERT",
+		},
+		cli.StringFlag{
+			Name:   "tls-key",
+			Value:  "",
+			Usage:  "The TLS private key file",
+			EnvVar: "PERIODIC_TLS_KEY",
+		},
+		cli.StringFlag{
+			Name:   "tls-ca",
+			Value:  "",
+			Usage:  "The CA file to verify the client certificates, or the server certificate on the client",
+			EnvVar: "PERIODIC_TLS_CA",
+		},
+		cli.BoolFlag{
+			Name:   "tls-client-auth",
+			Usage:  "Require the client certificates verified by --tls-ca",
+			EnvVar: "PERIODIC_TLS_CLIENT_AUTH",
+		},
+		cli.BoolFlag{
+			Name:   "tls",
+			Usage:  "Connect the server over TLS, implied by --tls-ca or --tls-cert",
+			EnvVar: "PERIODIC_TLS",
+		},
 		cli.StringFlag{
 			Name:  "redis",
 			Value: "tcp://127.0.0.1:6379",
@@ -53,6 +134,75 @@ func main() {
 			Value: 0,
 			Usage: "The socket timeout",
 		},
+		cli.IntFlag{
+			Name:  "max-in-flight",
+			Value: 0,
+			Usage: "The max jobs processing at once per worker, 0 is unlimited",
+		},
+		cli.IntFlag{
+			Name:  "blob-threshold",
+			Value: 0,
+			Usage: "The args larger than it in bytes are offloaded to the blob store, 0 is disabled",
+		},
+		cli.StringFlag{
+			Name:  "blob-dir",
+			Value: "",
+			Usage: "Store the offloaded args in the directory, default in the --driver",
+		},
+		cli.IntFlag{
+			Name:  "max-frame-size",
+			Value: protocol.DefaultMaxFrameSize,
+			Usage: "The max frame size in bytes received from the connections",
+		},
+		cli.IntFlag{
+			Name:  "retention-interval",
+			Value: 60,
+			Usage: "How often in seconds the overdue jobs are expired",
+		},
+		cli.IntFlag{
+			Name:  "archive-retention",
+			Value: 604800,
+			Usage: "How long in seconds the archived jobs are kept, 0 keep them forever",
+		},
+		cli.IntFlag{
+			Name:  "history-job-limit",
+			Value: 100,
+			Usage: "The max execution records kept per job",
+		},
+		cli.IntFlag{
+			Name:  "history-func-limit",
+			Value: 1000,
+			Usage: "The max execution records kept per func",
+		},
+		cli.StringFlag{
+			Name:   "webhook-secret",
+			Value:  "",
+			Usage:  "The default HMAC secret to sign the webhook deliveries",
+			EnvVar: "PERIODIC_WEBHOOK_SECRET",
+		},
+		cli.IntFlag{
+			Name:  "webhook-retries",
+			Value: 5,
+			Usage: "The max attempts of a webhook delivery",
+		},
+		cli.StringFlag{
+			Name:   "otlp-endpoint",
+			Value:  "",
+			Usage:  "The OTLP/HTTP collector to export the job spans eg: http://127.0.0.1:4318",
+			EnvVar: "OTEL_EXPORTER_OTLP_ENDPOINT",
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Value:  "logfmt",
+			Usage:  "The log format [logfmt, json]",
+			EnvVar: "PERIODIC_LOG_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "log-level",
+			Value:  "info",
+			Usage:  "The log levels eg: info,sched=debug,driver=warn",
+			EnvVar: "PERIODIC_LOG_LEVEL",
+		},
 		cli.IntFlag{
 			Name:   "cpus",
 			Value:  runtime.NumCPU(),
@@ -225,6 +375,142 @@ func main() {
 				return nil
 			},
 		},
+		{
+			Name:  "history",
+			Usage: "Show the execution history of a job or func",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "f",
+					Value: "",
+					Usage: "function name",
+				},
+				cli.StringFlag{
+					Name:  "n",
+					Value: "",
+					Usage: "job name",
+				},
+				cli.IntFlag{
+					Name:  "id",
+					Value: 0,
+					Usage: "job id",
+				},
+				cli.IntFlag{
+					Name:  "l",
+					Value: 20,
+					Usage: "the max records to show",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "output as json",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var funcName = c.String("f")
+				var jobID = int64(c.Int("id"))
+				if len(funcName) == 0 && jobID == 0 {
+					cli.ShowCommandHelp(c, "history")
+					log.Fatal("function name or job id is required")
+				}
+				subcmd.ShowHistory(c.GlobalString("H"), jobID, funcName, c.String("n"), c.Int("l"), c.Bool("json"))
+				return nil
+			},
+		},
+		{
+			Name:  "show",
+			Usage: "Show a job",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "f",
+					Value: "",
+					Usage: "function name",
+				},
+				cli.StringFlag{
+					Name:  "n",
+					Value: "",
+					Usage: "job name",
+				},
+				cli.IntFlag{
+					Name:  "id",
+					Value: 0,
+					Usage: "job id",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "output as json",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var funcName = c.String("f")
+				var name = c.String("n")
+				var jobID = int64(c.Int("id"))
+				if jobID == 0 && (len(funcName) == 0 || len(name) == 0) {
+					cli.ShowCommandHelp(c, "show")
+					log.Fatal("job id or function name and job name is required")
+				}
+				subcmd.ShowJob(c.GlobalString("H"), jobID, funcName, name, c.Bool("json"))
+				return nil
+			},
+		},
+		{
+			Name:  "list",
+			Usage: "List the jobs",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "f",
+					Value: "",
+					Usage: "function name",
+				},
+				cli.StringFlag{
+					Name:  "s",
+					Value: "",
+					Usage: "job status [ready, processing, paused]",
+				},
+				cli.StringFlag{
+					Name:  "p",
+					Value: "",
+					Usage: "job name prefix",
+				},
+				cli.IntFlag{
+					Name:  "cursor",
+					Value: 0,
+					Usage: "list the jobs after the job id",
+				},
+				cli.IntFlag{
+					Name:  "l",
+					Value: 100,
+					Usage: "the max jobs of a page",
+				},
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "list all the pages",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "output as json",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				subcmd.ListJobs(c.GlobalString("H"), c.String("f"), c.String("s"), c.String("p"),
+					int64(c.Int("cursor")), c.Int("l"), c.Bool("all"), c.Bool("json"))
+				return nil
+			},
+		},
+		{
+			Name:      "log-level",
+			Usage:     "Show or change the log level of the server",
+			ArgsUsage: "[level]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "s",
+					Value: "",
+					Usage: "subsystem [sched, protocol, driver, http, trace], empty for all",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				subcmd.LogLevel(c.GlobalString("H"), c.String("s"), c.Args().First())
+				return nil
+			},
+		},
 		{
 			Name:  "dump",
 			Usage: "Dump database to file.",
@@ -255,9 +541,75 @@ func main() {
 				return nil
 			},
 		},
+		{
+			Name:  "token",
+			Usage: "Sign a token by the --auth-secret",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "n",
+					Value: "",
+					Usage: "the identity of the token",
+				},
+				cli.IntFlag{
+					Name:  "ttl",
+					Value: 0,
+					Usage: "the token expire after ttl seconds, never expire when 0",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var identity = c.String("n")
+				var secret = c.GlobalString("auth-secret")
+				if len(identity) == 0 || len(secret) == 0 {
+					cli.ShowCommandHelp(c, "token")
+					log.Fatal("identity and --auth-secret is required")
+				}
+				var expiresAt int64
+				if ttl := c.Int("ttl"); ttl > 0 {
+					expiresAt = time.Now().Unix() + int64(ttl)
+				}
+				fmt.Println(periodic.SignToken(secret, identity, expiresAt))
+				return nil
+			},
+		},
+		{
+			Name:  "migrate",
+			Usage: "Rewrite the jobs of the --driver in the current encoding, stop the server first",
+			Action: func(c *cli.Context) error {
+				store := newStore(c.GlobalString("driver"), c.GlobalString("dbpath"), c.GlobalString("redis"))
+				defer store.Close()
+				count, err := driver.MigrateJobs(store)
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Printf("Migrated %d jobs\n", count)
+				return nil
+			},
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		subcmd.SetToken(c.GlobalString("token"))
+		subcmd.SetNamespace(c.GlobalString("namespace"))
+		if err := subcmd.SetCompression(c.GlobalString("compression")); err != nil {
+			return err
+		}
+		if c.GlobalBool("d") {
+			return nil
+		}
+		if c.GlobalBool("tls") || c.GlobalString("tls-ca") != "" || c.GlobalString("tls-cert") != "" {
+			return subcmd.SetTLS(c.GlobalString("tls-cert"), c.GlobalString("tls-key"), c.GlobalString("tls-ca"))
+		}
+		return nil
 	}
 	app.Action = func(c *cli.Context) error {
 		if c.Bool("d") {
+			format, err := logger.ParseFormat(c.String("log-format"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			logger.SetFormat(format)
+			if err := logger.SetLevels(c.String("log-level")); err != nil {
+				log.Fatal(err)
+			}
 			if c.String("cpuprofile") != "" {
 				f, err := os.Create(c.String("cpuprofile"))
 				if err != nil {
@@ -266,29 +618,72 @@ func main() {
 				pprof.StartCPUProfile(f)
 				defer pprof.StopCPUProfile()
 			}
-			var store driver.StoreDriver
-			switch c.String("driver") {
-			case "memstore":
-				store = driver.NewMemStroeDriver()
-				break
-			case "redis":
-				store = redis.NewDriver(c.String("redis"))
-				break
-			case "leveldb":
-				store = leveldb.NewDriver(c.String("dbpath"))
-				break
-			default:
-				store = driver.NewMemStroeDriver()
-				break
-			}
+			store := newStore(c.String("driver"), c.String("dbpath"), c.String("redis"))
 
 			runtime.GOMAXPROCS(c.Int("cpus"))
 			timeout := time.Duration(c.Int("timeout"))
 			periodicd := periodic.NewSched(c.String("H"), store, timeout)
+			if interval := c.Int("retention-interval"); interval > 0 {
+				periodicd.SetRetentionInterval(time.Duration(interval) * time.Second)
+			}
+			periodicd.SetArchiveRetention(time.Duration(c.Int("archive-retention")) * time.Second)
+			periodicd.SetWorkerMaxInFlight(c.Int("max-in-flight"))
+			periodicd.SetMaxFrameSize(uint32(c.Int("max-frame-size")))
+			// the blobs offloaded before are read even if nothing is offloaded now
+			var blobs driver.BlobStore
+			if dir := c.String("blob-dir"); dir != "" {
+				if blobs, err = driver.NewFileBlobStore(dir); err != nil {
+					log.Fatal(err)
+				}
+			} else if s, ok := store.(driver.BlobStore); ok {
+				blobs = s
+			}
+			if blobs != nil {
+				periodicd.SetBlobStore(blobs, c.Int("blob-threshold"))
+			} else if c.Int("blob-threshold") > 0 {
+				log.Fatal("The driver can not store the blobs, use --blob-dir")
+			}
+			periodicd.SetHistoryLimit(c.Int("history-job-limit"), c.Int("history-func-limit"))
+			periodicd.SetWebhookSecret(c.String("webhook-secret"))
+			if retries := c.Int("webhook-retries"); retries > 0 {
+				periodicd.SetWebhookRetry(retries, time.Second)
+			}
+			periodicd.SetTraceEndpoint(c.String("otlp-endpoint"))
+			periodicd.SetHTTPEntryPoint(c.String("http"))
+			var tokens []string
+			if c.String("auth-token") != "" {
+				tokens = strings.Split(c.String("auth-token"), ",")
+			}
+			periodicd.SetAuth(tokens, c.String("auth-secret"))
+			if c.String("acl") != "" {
+				if err := periodicd.SetACL(c.String("acl")); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if c.String("quota") != "" {
+				if err := periodicd.SetQuotas(c.String("quota")); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if c.String("tls-cert") != "" {
+				err := periodicd.SetTLS(c.String("tls-cert"), c.String("tls-key"),
+					c.String("tls-ca"), c.Bool("tls-client-auth"))
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
 			go periodicd.Serve()
 			s := make(chan os.Signal, 1)
-			signal.Notify(s, os.Interrupt, os.Kill)
-			<-s
+			signal.Notify(s, os.Interrupt, os.Kill, syscall.SIGHUP)
+			for sig := range s {
+				if sig != syscall.SIGHUP {
+					break
+				}
+				// reload the certificates, the connections are kept
+				if err := periodicd.ReloadTLS(); err != nil {
+					log.Printf("Reload TLS failed: %v", err)
+				}
+			}
 			periodicd.Close()
 		} else {
 			cli.ShowAppHelp(c)
@@ -298,3 +693,22 @@ func main() {
 
 	app.Run(os.Args)
 }
+
+// newStore create the store driver by name
+func newStore(name, dbpath, redisAddr string) (store driver.StoreDriver) {
+	switch name {
+	case "memstore":
+		store = driver.NewMemStroeDriver()
+		break
+	case "redis":
+		store = redis.NewDriver(redisAddr)
+		break
+	case "leveldb":
+		store = leveldb.NewDriver(dbpath)
+		break
+	default:
+		store = driver.NewMemStroeDriver()
+		break
+	}
+	return
+}
@@ -0,0 +1,173 @@
+package subcmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jmuyuyang/periodic/protocol"
+)
+
+// token authenticate the raw clients, empty when the server has no
+// authentication.
+var token string
+
+// SetToken set the token to authenticate the connections
+func SetToken(t string) {
+	token = t
+}
+
+// namespace the namespace of the raw clients, empty is the default one.
+var namespace string
+
+// SetNamespace set the namespace of the connections
+func SetNamespace(ns string) {
+	namespace = ns
+}
+
+// compression the compression negotiated by the raw clients, empty is
+// disabled.
+var compression string
+
+// SetCompression set the compression of the connections
+func SetCompression(name string) error {
+	if name != "" && !protocol.SupportCompression(name) {
+		return protocol.ErrUnsupportedCompression
+	}
+	compression = name
+	return nil
+}
+
+// tlsConfig dial the tcp servers over TLS, nil when it is disabled
+var tlsConfig *tls.Config
+
+// SetTLS dial the tcp servers over TLS, the server certificate is verified by
+// the CAs of caFile or the system CAs, the client certificate is presented
+// when certFile and keyFile are set.
+func SetTLS(certFile, keyFile, caFile string) error {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return errors.New("no certificate found in " + caFile)
+		}
+	}
+	tlsConfig = config
+	return nil
+}
+
+// rawClient a plain protocol client for the commands go-periodic not support.
+type rawClient struct {
+	conn  protocol.Conn
+	msgID int
+}
+
+func newRawClient(entryPoint string) (c *rawClient, err error) {
+	parts := strings.SplitN(entryPoint, "://", 2)
+	if len(parts) != 2 {
+		err = errors.New("invalid entry point: " + entryPoint)
+		return
+	}
+	var conn net.Conn
+	if parts[0] == "tcp" && tlsConfig != nil {
+		conn, err = tls.Dial(parts[0], parts[1], tlsConfig)
+	} else {
+		conn, err = net.Dial(parts[0], parts[1])
+	}
+	if err != nil {
+		return
+	}
+	c = new(rawClient)
+	c.conn = protocol.NewClientConn(conn)
+	handshake := append(protocol.TYPECLIENT.Bytes(), namespace...)
+	if err = c.conn.Send(handshake); err == nil && token != "" {
+		_, err = c.request(protocol.AUTH, []byte(token))
+	}
+	if err == nil {
+		err = c.hello()
+	}
+	if err != nil {
+		c.conn.Close()
+		c = nil
+	}
+	return
+}
+
+// hello negotiate the ERROR responses and the compression, the server
+// without HELLO reply the error message alone and keep the frames plain.
+func (c *rawClient) hello() error {
+	hello := protocol.Hello{
+		Version:      protocol.Version,
+		Agent:        "periodic-cli",
+		Capabilities: []protocol.Capability{protocol.CapResults, protocol.CapBatch, protocol.CapErrors},
+	}
+	if compression != "" {
+		hello.Compression = []string{compression}
+	}
+	data, err := c.request(protocol.HELLO, hello.Bytes())
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, append(protocol.HELLO.Bytes(), protocol.NullChar...)) {
+		return nil
+	}
+	if hello, err = protocol.NewHello(data[len(protocol.HELLO.Bytes())+len(protocol.NullChar):]); err != nil {
+		return err
+	}
+	if len(hello.Compression) > 0 {
+		return c.conn.SetCompression(hello.Compression[0])
+	}
+	return nil
+}
+
+// errorPrefix the data of an ERROR response start with
+var errorPrefix = append(protocol.ERROR.Bytes(), protocol.NullChar...)
+
+// request send a command and wait for the response data, an ERROR response
+// is returned as a protocol.Error.
+func (c *rawClient) request(cmd protocol.Command, payload []byte) (data []byte, err error) {
+	c.msgID++
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(strconv.Itoa(c.msgID))
+	buf.Write(protocol.NullChar)
+	buf.Write(cmd.Bytes())
+	buf.Write(protocol.NullChar)
+	buf.Write(payload)
+	if err = c.conn.Send(buf.Bytes()); err != nil {
+		return
+	}
+	if data, err = c.conn.Receive(); err != nil {
+		return
+	}
+	parts := bytes.SplitN(data, protocol.NullChar, 2)
+	if len(parts) != 2 {
+		err = errors.New(string(data))
+		return
+	}
+	data = parts[1]
+	if bytes.HasPrefix(data, errorPrefix) {
+		err = protocol.ParseError(data[len(errorPrefix):])
+		data = nil
+	}
+	return
+}
+
+func (c *rawClient) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,53 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/protocol"
+)
+
+// ShowHistory cli history
+func ShowHistory(entryPoint string, jobID int64, funcName, name string, limit int, asJSON bool) {
+	c, err := newRawClient(entryPoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"job_id": jobID,
+		"func":   funcName,
+		"name":   name,
+		"limit":  limit,
+	})
+	data, err := c.request(protocol.HISTORY, payload)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if asJSON {
+		fmt.Println(string(data))
+		return
+	}
+	var packed map[string][]driver.History
+	if err = json.Unmarshal(data, &packed); err != nil {
+		log.Fatal(err)
+	}
+	table := uitable.New()
+	table.MaxColWidth = 50
+
+	table.AddRow("JOB_ID", "FUNCTION", "NAME", "ATTEMPT", "WORKER", "ASSIGNED", "OUTCOME", "DURATION", "RESULT")
+	for _, record := range packed["history"] {
+		result := record.Result
+		if record.Error != "" {
+			result = record.Error
+		}
+		table.AddRow(record.JobID, record.Func, record.Name, record.Attempt, record.Worker,
+			time.Unix(record.AssignedAt, 0).Format("2006-01-02 15:04:05"), record.Outcome,
+			time.Duration(record.Duration)*time.Millisecond, result)
+	}
+	fmt.Println(table)
+}
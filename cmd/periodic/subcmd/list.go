@@ -0,0 +1,67 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/gosuri/uitable"
+	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/protocol"
+)
+
+type jobPage struct {
+	Jobs       []driver.Job `json:"jobs"`
+	NextCursor int64        `json:"next_cursor,omitempty"`
+}
+
+// ListJobs cli list, all the pages are listed when all is true.
+func ListJobs(entryPoint, funcName, status, prefix string, cursor int64, limit int, all, asJSON bool) {
+	c, err := newRawClient(entryPoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	var result jobPage
+	result.Jobs = make([]driver.Job, 0)
+	for {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"func":   funcName,
+			"status": status,
+			"prefix": prefix,
+			"cursor": cursor,
+			"limit":  limit,
+		})
+		data, err := c.request(protocol.LISTJOBS, payload)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var page jobPage
+		if err = json.Unmarshal(data, &page); err != nil {
+			log.Fatal(err)
+		}
+		result.Jobs = append(result.Jobs, page.Jobs...)
+		result.NextCursor = page.NextCursor
+		if !all || page.NextCursor == 0 {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if asJSON {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+		return
+	}
+	table := uitable.New()
+	table.MaxColWidth = 50
+
+	table.AddRow("JOB_ID", "FUNCTION", "NAME", "STATUS", "SCHED_AT", "RUN_AT", "PERIOD", "COUNTER", "REVISION")
+	for _, job := range result.Jobs {
+		table.AddRow(job.ID, job.Func, job.Name, job.Status, formatTime(job.SchedAt),
+			formatTime(job.RunAt), job.Period, job.Counter, job.Revision)
+	}
+	fmt.Println(table)
+	if result.NextCursor > 0 {
+		fmt.Printf("More jobs, list the next page with --cursor %d\n", result.NextCursor)
+	}
+}
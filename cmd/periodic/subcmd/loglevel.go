@@ -0,0 +1,47 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/gosuri/uitable"
+	"github.com/jmuyuyang/periodic/protocol"
+)
+
+// LogLevel cli log-level, show the levels when level is empty
+func LogLevel(entryPoint, subsystem, level string) {
+	c, err := newRawClient(entryPoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	var payload []byte
+	if level != "" {
+		payload, _ = json.Marshal(map[string]string{
+			"subsystem": subsystem,
+			"level":     level,
+		})
+	}
+	data, err := c.request(protocol.LOGLEVEL, payload)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var packed map[string]map[string]string
+	if err = json.Unmarshal(data, &packed); err != nil {
+		log.Fatal(err)
+	}
+	levels := packed["levels"]
+	names := make([]string, 0, len(levels))
+	for name := range levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	table := uitable.New()
+	table.AddRow("SUBSYSTEM", "LEVEL")
+	for _, name := range names {
+		table.AddRow(name, levels[name])
+	}
+	fmt.Println(table)
+}
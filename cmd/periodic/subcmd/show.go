@@ -0,0 +1,68 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/protocol"
+)
+
+// ShowJob cli show
+func ShowJob(entryPoint string, jobID int64, funcName, name string, asJSON bool) {
+	c, err := newRawClient(entryPoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"job_id": jobID,
+		"func":   funcName,
+		"name":   name,
+	})
+	data, err := c.request(protocol.GETJOB, payload)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if asJSON {
+		fmt.Println(string(data))
+		return
+	}
+	job, err := driver.NewJob(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	table := uitable.New()
+	table.MaxColWidth = 80
+
+	table.AddRow("JOB_ID:", job.ID)
+	table.AddRow("FUNCTION:", job.Func)
+	table.AddRow("NAME:", job.Name)
+	table.AddRow("STATUS:", job.Status)
+	table.AddRow("ARGS:", job.Args)
+	table.AddRow("SCHED_AT:", formatTime(job.SchedAt))
+	table.AddRow("RUN_AT:", formatTime(job.RunAt))
+	table.AddRow("PERIOD:", job.Period)
+	table.AddRow("TIMEOUT:", job.Timeout)
+	table.AddRow("RETENTION:", job.Retention)
+	table.AddRow("FAIL_RETRY:", job.FailRetry)
+	table.AddRow("COUNTER:", job.Counter)
+	table.AddRow("REVISION:", job.Revision)
+	if job.Webhook != "" {
+		table.AddRow("WEBHOOK:", job.Webhook)
+	}
+	if job.TraceParent != "" {
+		table.AddRow("TRACEPARENT:", job.TraceParent)
+	}
+	fmt.Println(table)
+}
+
+func formatTime(timestamp int64) string {
+	if timestamp <= 0 {
+		return "-"
+	}
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
@@ -3,24 +3,41 @@ package subcmd
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/gosuri/uitable"
-	"github.com/jmuyuyang/go-periodic"
+	"github.com/jmuyuyang/periodic/protocol"
 )
 
 // ShowStatus cli status
 func ShowStatus(entryPoint string) {
-	c := periodic.NewClient()
-	if err := c.Connect(entryPoint); err != nil {
+	c, err := newRawClient(entryPoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	data, err := c.request(protocol.STATUS, []byte("extended"))
+	if err != nil {
 		log.Fatal(err)
 	}
-	stats, _ := c.Status()
 	table := uitable.New()
 	table.MaxColWidth = 50
 
-	table.AddRow("FUNCTION", "WORKERS", "JOBS", "PROCESSING")
-	for _, stat := range stats {
-		table.AddRow(stat[0], stat[1], stat[2], stat[3])
+	table.AddRow("FUNCTION", "WORKERS", "JOBS", "PROCESSING",
+		"LAG P50/P95/P99", "RUN P50/P95/P99", "DONE/MIN 1M/5M/15M", "FAILURE/MIN 1M/5M/15M")
+	for _, line := range strings.Split(string(data), "\n") {
+		stat := strings.Split(line, ",")
+		if len(stat) < 4 {
+			continue
+		}
+		if len(stat) < 16 {
+			// an old server only report the counters.
+			table.AddRow(stat[0], stat[1], stat[2], stat[3])
+			continue
+		}
+		table.AddRow(stat[0], stat[1], stat[2], stat[3],
+			strings.Join(stat[4:7], "/"), strings.Join(stat[7:10], "/"),
+			strings.Join(stat[10:13], "/"), strings.Join(stat[13:16], "/"))
 	}
 	fmt.Println(table)
 }
@@ -0,0 +1,22 @@
+// Package dashboard defined the web dashboard of periodic, the static assets
+// are embedded in the binary. The dashboard talk to the REST API under
+// /api/v1 and get the live updates from /api/v1/events.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serve the dashboard assets, the index.html is served on /.
+func Handler() http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(assets))
+}
@@ -0,0 +1,341 @@
+(function () {
+  'use strict';
+
+  var API = '/api/v1';
+  var EVENT_TYPES = [
+    'submitted', 'assigned', 'done', 'failed', 'timeout', 'rescheduled',
+    'removed', 'paused', 'resumed', 'expired', 'dead_lettered',
+    'worker_connected', 'worker_disconnected'
+  ];
+  var MAX_EVENTS = 200;
+
+  var query = {func: '', status: '', prefix: ''};
+  var cursors = [0]; // The cursor of every visited page, the last is current
+  var nextCursor = 0;
+  var selected = null; // The job id shown in the detail
+  var refreshTimer = null;
+  var source = null;
+  var token = localStorage.getItem('periodic.token') || '';
+  var namespace = localStorage.getItem('periodic.namespace') || '';
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function request(method, path) {
+    var headers = {};
+    if (token) {
+      headers.Authorization = 'Bearer ' + token;
+    }
+    if (namespace) {
+      headers['X-Periodic-Namespace'] = namespace;
+    }
+    return fetch(API + path, {method: method, headers: headers}).then(function (rsp) {
+      if (rsp.status === 204) {
+        return null;
+      }
+      return rsp.json().then(function (body) {
+        if (rsp.status === 401) {
+          throw new Error('Unauthorized, please enter the access token.');
+        }
+        if (!rsp.ok) {
+          var message = body && body.error ? body.error.message : rsp.statusText;
+          throw new Error(message);
+        }
+        return body;
+      });
+    });
+  }
+
+  function showError(err) {
+    var el = $('error');
+    el.textContent = err.message || String(err);
+    el.hidden = false;
+    setTimeout(function () { el.hidden = true; }, 5000);
+  }
+
+  function formatTime(ts) {
+    if (!ts) {
+      return '-';
+    }
+    return new Date(ts * 1000).toLocaleString();
+  }
+
+  function fixed(n) {
+    return (n || 0).toFixed(2);
+  }
+
+  function cell(tr, text, className) {
+    var td = document.createElement('td');
+    td.textContent = text;
+    if (className) {
+      td.className = className;
+    }
+    tr.appendChild(td);
+    return td;
+  }
+
+  function fill(tbody, rows, render, empty, columns) {
+    tbody.textContent = '';
+    if (rows.length === 0) {
+      var tr = document.createElement('tr');
+      var td = cell(tr, empty);
+      td.colSpan = columns;
+      tbody.appendChild(tr);
+      return;
+    }
+    rows.forEach(function (row) {
+      var tr = document.createElement('tr');
+      render(tr, row);
+      tbody.appendChild(tr);
+    });
+  }
+
+  function loadFuncs() {
+    return request('GET', '/funcs').then(function (stats) {
+      var names = Object.keys(stats).sort();
+      var rows = names.map(function (name) { return stats[name]; });
+      fill($('funcs').tBodies[0], rows, function (tr, st) {
+        cell(tr, st.func_name);
+        cell(tr, st.total_worker);
+        cell(tr, st.total_job);
+        cell(tr, st.processing);
+        cell(tr, [fixed(st.lag_p50), fixed(st.lag_p95), fixed(st.lag_p99)].join(' / '));
+        cell(tr, [fixed(st.run_p50), fixed(st.run_p95), fixed(st.run_p99)].join(' / '));
+        cell(tr, [fixed(st.done_1m), fixed(st.done_5m), fixed(st.done_15m)].join(' / '));
+        cell(tr, [fixed(st.failure_1m), fixed(st.failure_5m), fixed(st.failure_15m)].join(' / '));
+      }, 'No functions.', 8);
+    });
+  }
+
+  function loadWorkers() {
+    return request('GET', '/workers').then(function (body) {
+      fill($('workers').tBodies[0], body.workers || [], function (tr, w) {
+        cell(tr, w.id);
+        cell(tr, (w.funcs || []).join(', '));
+        cell(tr, (w.jobs || []).join(', '));
+        cell(tr, formatTime(w.connected_at));
+      }, 'No workers.', 4);
+    });
+  }
+
+  function loadJobs() {
+    var params = new URLSearchParams();
+    Object.keys(query).forEach(function (key) {
+      if (query[key]) {
+        params.set(key, query[key]);
+      }
+    });
+    var cursor = cursors[cursors.length - 1];
+    if (cursor > 0) {
+      params.set('cursor', cursor);
+    }
+    params.set('limit', 50);
+    return request('GET', '/jobs?' + params.toString()).then(function (page) {
+      nextCursor = page.next_cursor || 0;
+      $('next').disabled = nextCursor === 0;
+      $('prev').disabled = cursors.length <= 1;
+      fill($('jobs').tBodies[0], page.jobs || [], function (tr, job) {
+        if (job.job_id === selected) {
+          tr.className = 'selected';
+        }
+        cell(tr, job.job_id);
+        cell(tr, job.func);
+        cell(tr, job.name);
+        cell(tr, job.status, 'status-' + job.status);
+        cell(tr, formatTime(job.sched_at));
+        cell(tr, formatTime(job.run_at));
+        cell(tr, job.period || '-');
+        cell(tr, job.counter);
+        tr.addEventListener('click', function () { showJob(job.job_id); });
+      }, 'No jobs.', 8);
+    });
+  }
+
+  function showJob(id) {
+    selected = id;
+    return Promise.all([
+      request('GET', '/jobs/' + id),
+      request('GET', '/jobs/' + id + '/results?limit=20')
+    ]).then(function (values) {
+      var job = values[0];
+      var results = values[1].results || [];
+      $('detail-title').textContent = '#' + job.job_id + ' ' + job.func + '/' + job.name;
+      $('pause').hidden = job.status === 'paused';
+      $('resume').hidden = job.status !== 'paused';
+      $('run').disabled = job.status !== 'ready';
+
+      var fields = [
+        ['Status', job.status],
+        ['Workload', job.workload],
+        ['Sched at', formatTime(job.sched_at)],
+        ['Run at', formatTime(job.run_at)],
+        ['Timeout', job.timeout + 's'],
+        ['Period', job.period || '-'],
+        ['Counter', job.counter],
+        ['Fail retry', job.fail_retry],
+        ['Retention', job.retention],
+        ['Revision', job.revision],
+        ['Webhook', job.webhook || '-']
+      ];
+      fill($('fields').tBodies[0], fields, function (tr, field) {
+        var th = document.createElement('th');
+        th.textContent = field[0];
+        tr.appendChild(th);
+        cell(tr, field[1], 'wrap');
+      }, '', 2);
+
+      fill($('results').tBodies[0], results, function (tr, r) {
+        cell(tr, r.attempt);
+        cell(tr, r.worker);
+        cell(tr, formatTime(r.assigned_at));
+        cell(tr, r.outcome);
+        cell(tr, r.duration);
+        cell(tr, r.error || r.result || '', 'wrap');
+      }, 'No history.', 6);
+      $('detail').hidden = false;
+    }).catch(function (err) {
+      closeJob();
+      showError(err);
+    });
+  }
+
+  function closeJob() {
+    selected = null;
+    $('detail').hidden = true;
+  }
+
+  function jobAction(method, action) {
+    if (selected === null) {
+      return;
+    }
+    var path = '/jobs/' + selected + (action ? '/' + action : '');
+    request(method, path).then(function () {
+      if (method === 'DELETE') {
+        closeJob();
+      }
+      refresh();
+    }).catch(showError);
+  }
+
+  function refresh() {
+    var loads = [loadFuncs(), loadWorkers(), loadJobs()];
+    if (selected !== null) {
+      loads.push(showJob(selected));
+    }
+    return Promise.all(loads).catch(showError);
+  }
+
+  // scheduleRefresh coalesce the refreshes triggered by the burst of events.
+  function scheduleRefresh() {
+    if (refreshTimer) {
+      return;
+    }
+    refreshTimer = setTimeout(function () {
+      refreshTimer = null;
+      refresh();
+    }, 1000);
+  }
+
+  function logEvent(e) {
+    var list = $('events');
+    var li = document.createElement('li');
+    var text = new Date(e.at * 1000).toLocaleTimeString() + ' ' + e.type;
+    if (e.job_id) {
+      text += ' #' + e.job_id;
+    }
+    if (e.func) {
+      text += ' ' + e.func + (e.name ? '/' + e.name : '');
+    }
+    if (e.worker) {
+      text += ' worker=' + e.worker;
+    }
+    if (e.retry) {
+      text += ' (retry)';
+    }
+    li.textContent = text;
+    list.insertBefore(li, list.firstChild);
+    while (list.childNodes.length > MAX_EVENTS) {
+      list.removeChild(list.lastChild);
+    }
+  }
+
+  // subscribe open the event stream, the EventSource can not set the headers
+  // so the token and the namespace are sent in the query.
+  function subscribe() {
+    var live = $('live');
+    if (source) {
+      source.close();
+    }
+    var params = [];
+    if (token) {
+      params.push('access_token=' + encodeURIComponent(token));
+    }
+    if (namespace) {
+      params.push('namespace=' + encodeURIComponent(namespace));
+    }
+    var url = API + '/events';
+    if (params.length > 0) {
+      url += '?' + params.join('&');
+    }
+    source = new EventSource(url);
+    source.onopen = function () {
+      live.textContent = 'live';
+      live.className = 'live on';
+    };
+    source.onerror = function () {
+      live.textContent = 'offline';
+      live.className = 'live off';
+    };
+    EVENT_TYPES.forEach(function (type) {
+      source.addEventListener(type, function (msg) {
+        logEvent(JSON.parse(msg.data));
+        scheduleRefresh();
+      });
+    });
+  }
+
+  $('auth').elements.token.value = token;
+  $('auth').elements.namespace.value = namespace;
+  $('auth').addEventListener('submit', function (e) {
+    e.preventDefault();
+    token = e.target.elements.token.value.trim();
+    namespace = e.target.elements.namespace.value.trim();
+    localStorage.setItem('periodic.token', token);
+    localStorage.setItem('periodic.namespace', namespace);
+    closeJob();
+    cursors = [0];
+    refresh();
+    subscribe();
+  });
+  $('search').addEventListener('submit', function (e) {
+    e.preventDefault();
+    var form = e.target;
+    query.func = form.elements.func.value.trim();
+    query.status = form.elements.status.value;
+    query.prefix = form.elements.prefix.value.trim();
+    cursors = [0];
+    loadJobs().catch(showError);
+  });
+  $('next').addEventListener('click', function () {
+    cursors.push(nextCursor);
+    loadJobs().catch(showError);
+  });
+  $('prev').addEventListener('click', function () {
+    cursors.pop();
+    loadJobs().catch(showError);
+  });
+  $('run').addEventListener('click', function () { jobAction('POST', 'run'); });
+  $('pause').addEventListener('click', function () { jobAction('POST', 'pause'); });
+  $('resume').addEventListener('click', function () { jobAction('POST', 'resume'); });
+  $('remove').addEventListener('click', function () {
+    if (confirm('Remove the job #' + selected + '?')) {
+      jobAction('DELETE', '');
+    }
+  });
+  $('close').addEventListener('click', closeJob);
+
+  refresh();
+  subscribe();
+  setInterval(refresh, 10000);
+})();
@@ -0,0 +1,245 @@
+package driver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrBlobNotFound the blob is not exists in the blob store
+var ErrBlobNotFound = errors.New("Blob not exists.")
+
+// BlobStore define the store of the large args offloaded from the jobs.
+type BlobStore interface {
+	// PutBlob save the data by key.
+	PutBlob(key string, data []byte) error
+	// GetBlob get the data by key, ErrBlobNotFound when not exists.
+	GetBlob(key string) ([]byte, error)
+	// DeleteBlob remove the data by key, it is not an error when not exists.
+	DeleteBlob(key string) error
+}
+
+// newBlobKey create an unique key for the args of a job
+func newBlobKey() string {
+	var key [16]byte
+	rand.Read(key[:])
+	return hex.EncodeToString(key[:])
+}
+
+// LoadArgs fetch the args of the job offloaded to the blob store, the job
+// returned carry the args inline.
+func LoadArgs(blobs BlobStore, job Job) (Job, error) {
+	if job.Blob == "" {
+		return job, nil
+	}
+	if blobs == nil {
+		return job, ErrBlobNotFound
+	}
+	data, err := blobs.GetBlob(job.Blob)
+	if err != nil {
+		return job, err
+	}
+	job.Args = string(data)
+	job.Blob = ""
+	return job, nil
+}
+
+// OffloadArgs move the args of the job to a new blob, the job keep the key of
+// the blob.
+func OffloadArgs(blobs BlobStore, job *Job) error {
+	key := newBlobKey()
+	if err := blobs.PutBlob(key, []byte(job.Args)); err != nil {
+		return err
+	}
+	job.Args = ""
+	job.Blob = key
+	return nil
+}
+
+// FileBlobStore defined a blob store on the filesystem, a blob is a file
+// under the directory.
+type FileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore create a blob store in the directory
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileBlobStore{dir: dir}, nil
+}
+
+func (s *FileBlobStore) path(key string) string {
+	if len(key) > 2 {
+		return filepath.Join(s.dir, key[:2], key)
+	}
+	return filepath.Join(s.dir, key)
+}
+
+// PutBlob save the data by key, the file is written then renamed.
+func (s *FileBlobStore) PutBlob(key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// GetBlob get the data by key
+func (s *FileBlobStore) GetBlob(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	return data, err
+}
+
+// DeleteBlob remove the data by key
+func (s *FileBlobStore) DeleteBlob(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// blobDriver wrap a store driver to offload the args larger than the
+// threshold to a blob store, the job keep the key of the blob. The blob is
+// removed with the job, and kept with the archived job until it is purged.
+type blobDriver struct {
+	StoreDriver
+	blobs     BlobStore
+	threshold int
+}
+
+// NewBlobDriver wrap the store to offload the args larger than threshold
+// bytes to the blobs, zero offload nothing but the blobs offloaded before are
+// still removed with the jobs.
+func NewBlobDriver(store StoreDriver, blobs BlobStore, threshold int) StoreDriver {
+	return &blobDriver{StoreDriver: store, blobs: blobs, threshold: threshold}
+}
+
+// offload move the large args of the job to a new blob, it return the blob
+// created and the blob replaced by the job. The job offloaded before by
+// OffloadArgs carry the new blob already.
+func (d *blobDriver) offload(job *Job) (created, stale string, err error) {
+	if job.Args != "" && job.Blob != "" {
+		// the args replace the offloaded one
+		stale = job.Blob
+		job.Blob = ""
+	} else if job.ID > 0 {
+		if old, e := d.StoreDriver.Get(job.ID); e == nil && old.Blob != job.Blob {
+			stale = old.Blob
+		}
+	}
+	if d.threshold <= 0 || len(job.Args) <= d.threshold {
+		return
+	}
+	if err = OffloadArgs(d.blobs, job); err == nil {
+		created = job.Blob
+	}
+	return
+}
+
+// settle remove the stale blob when the job is saved, or the created blob
+// when it is not.
+func (d *blobDriver) settle(job *Job, created, stale string, err error) {
+	if err != nil {
+		if created != "" {
+			d.blobs.DeleteBlob(created)
+		}
+		return
+	}
+	if stale != "" && stale != job.Blob {
+		d.blobs.DeleteBlob(stale)
+	}
+}
+
+// Save job, the large args is offloaded to the blob store.
+func (d *blobDriver) Save(job *Job, force ...bool) (err error) {
+	var created, stale string
+	if created, stale, err = d.offload(job); err != nil {
+		return
+	}
+	err = d.StoreDriver.Save(job, force...)
+	d.settle(job, created, stale, err)
+	return
+}
+
+// SaveBatch save a batch of jobs at once, returns the error of each job.
+func (d *blobDriver) SaveBatch(jobs []*Job) []error {
+	var errs = make([]error, len(jobs))
+	var created = make([]string, len(jobs))
+	var stales = make([]string, len(jobs))
+	var saving = make([]*Job, 0, len(jobs))
+	var index = make([]int, 0, len(jobs))
+	for i, job := range jobs {
+		if created[i], stales[i], errs[i] = d.offload(job); errs[i] == nil {
+			saving = append(saving, job)
+			index = append(index, i)
+		}
+	}
+	for k, err := range d.StoreDriver.SaveBatch(saving) {
+		i := index[k]
+		errs[i] = err
+		d.settle(saving[k], created[i], stales[i], err)
+	}
+	return errs
+}
+
+// Delete a job with job id and the blob of it.
+func (d *blobDriver) Delete(jobID int64) (err error) {
+	job, _ := d.StoreDriver.Get(jobID)
+	if err = d.StoreDriver.Delete(jobID); err == nil && job.Blob != "" {
+		d.blobs.DeleteBlob(job.Blob)
+	}
+	return
+}
+
+// DeleteBatch delete a batch of jobs at once, returns the error of each job.
+func (d *blobDriver) DeleteBatch(jobIDs []int64) []error {
+	var blobs = make([]string, len(jobIDs))
+	for i, jobID := range jobIDs {
+		job, _ := d.StoreDriver.Get(jobID)
+		blobs[i] = job.Blob
+	}
+	errs := d.StoreDriver.DeleteBatch(jobIDs)
+	for i, err := range errs {
+		if err == nil && blobs[i] != "" {
+			d.blobs.DeleteBlob(blobs[i])
+		}
+	}
+	return errs
+}
+
+// GetArchived get an archived job with job id, the offloaded args is loaded.
+func (d *blobDriver) GetArchived(jobID int64) (job ArchivedJob, err error) {
+	if job, err = d.StoreDriver.GetArchived(jobID); err != nil || job.Blob == "" {
+		return
+	}
+	if data, e := d.blobs.GetBlob(job.Blob); e == nil {
+		job.Args = string(data)
+	}
+	job.Blob = ""
+	return
+}
+
+// PurgeArchived remove the jobs archived before the time and the blobs of
+// them.
+func (d *blobDriver) PurgeArchived(before int64) (jobs []ArchivedJob, err error) {
+	jobs, err = d.StoreDriver.PurgeArchived(before)
+	for _, job := range jobs {
+		if job.Blob != "" {
+			d.blobs.DeleteBlob(job.Blob)
+		}
+	}
+	return
+}
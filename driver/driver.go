@@ -1,17 +1,55 @@
 package driver
 
+// DefaultNamespace the namespace of the connections without one, and of the
+// data stored before the namespaces.
+const DefaultNamespace = "default"
+
 // StoreDriver define the general store interface.
 type StoreDriver interface {
 	// Save job. when job is exists update it, other create one.
 	Save(*Job, ...bool) error
-	// Delete a job with job id.
+	// SaveBatch save a batch of jobs at once, returns the error of each job.
+	SaveBatch([]*Job) []error
+	// Delete a job with job id, the execution records of the job are
+	// deleted with it.
 	Delete(jobID int64) error
+	// DeleteBatch delete a batch of jobs at once, returns the error of each job.
+	DeleteBatch([]int64) []error
+	// Archive move a job out of the jobs into the archive with a reason, the
+	// execution records of the job are kept until it is purged.
+	Archive(jobID int64, reason string) error
+	// GetArchived get an archived job with job id.
+	GetArchived(jobID int64) (ArchivedJob, error)
+	// PurgeArchived remove the jobs archived before the time and their
+	// execution records, it returns the removed jobs.
+	PurgeArchived(before int64) ([]ArchivedJob, error)
 	// Get a job with job id.
 	Get(jobID int64) (Job, error)
-	// GetOne get a job with func and name.
-	GetOne(string, string) (Job, error)
-	// NewIterator create a job Iterator with func or nil.
-	NewIterator([]byte) Iterator
+	// GetOne get a job with namespace, func and name.
+	GetOne(string, string, string) (Job, error)
+	// AddHistory append an execution record, and keep at most jobLimit
+	// records of the job and funcLimit records of the func.
+	AddHistory(record History, jobLimit, funcLimit int) error
+	// GetHistory get at most limit execution records of a job, newest first.
+	GetHistory(jobID int64, limit int) ([]History, error)
+	// GetFuncHistory get at most limit execution records of a func, newest first.
+	GetFuncHistory(ns, Func string, limit int) ([]History, error)
+	// SaveWebhook save the webhook of a func.
+	SaveWebhook(Webhook) error
+	// GetWebhook get the webhook of a func.
+	GetWebhook(ns, Func string) (Webhook, error)
+	// DeleteWebhook delete the webhook of a func.
+	DeleteWebhook(ns, Func string) error
+	// AddDelivery append a webhook delivery, and keep at most limit deliveries of the func.
+	AddDelivery(delivery Delivery, limit int) error
+	// GetDeliveries get at most limit webhook deliveries of a func, newest first.
+	GetDeliveries(ns, Func string, limit int) ([]Delivery, error)
+	// NewIterator create a job Iterator with namespace and func or nil, an
+	// empty namespace iterate the jobs of all the namespaces.
+	NewIterator(string, []byte) Iterator
+	// NewIteratorAfter create a job Iterator like NewIterator, the jobs after
+	// the cursor are iterated in the job id order.
+	NewIteratorAfter(ns string, Func []byte, cursor int64) Iterator
 	// Close the driver
 	Close() error
 }
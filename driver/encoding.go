@@ -0,0 +1,213 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/golang/snappy"
+)
+
+// The job records of the store are encoded in a compact binary, the first
+// byte is the version of the encoding. The legacy records are json objects,
+// they start with '{' and are still readable.
+//
+// Version 1:
+//
+//	version(1 byte) flags(1 byte) ID Namespace Name Func Args Timeout
+//	Retention SchedAt RunAt FailRetry Period Counter Status Revision Webhook
+//	TraceParent TraceState
+//
+// Version 2 append the Blob.
+//
+// The integers are varints, the strings are an uvarint length then the
+// bytes. The Args is compressed by snappy when flagArgsSnappy is set.
+const (
+	jobEncodingV1 byte = 1
+	jobEncodingV2 byte = 2
+
+	flagArgsSnappy byte = 1 << 0
+)
+
+var (
+	// ErrInvalidJobRecord the job record of the store is broken
+	ErrInvalidJobRecord = errors.New("Invalid job record.")
+	// ErrUnsupportedJobEncoding the job record is encoded by a newer version
+	ErrUnsupportedJobEncoding = errors.New("Unsupported job encoding.")
+)
+
+func isLegacyRecord(data []byte) bool {
+	return len(data) > 0 && data[0] == '{'
+}
+
+type jobEncoder struct {
+	bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *jobEncoder) varint(v int64) {
+	n := binary.PutVarint(e.scratch[:], v)
+	e.Write(e.scratch[:n])
+}
+
+func (e *jobEncoder) string(s string) {
+	n := binary.PutUvarint(e.scratch[:], uint64(len(s)))
+	e.Write(e.scratch[:n])
+	e.WriteString(s)
+}
+
+type jobDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *jobDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = ErrInvalidJobRecord
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *jobDecoder) bytes() []byte {
+	if d.err != nil {
+		return nil
+	}
+	size, n := binary.Uvarint(d.data)
+	if n <= 0 || size > uint64(len(d.data)-n) {
+		d.err = ErrInvalidJobRecord
+		return nil
+	}
+	v := d.data[n : n+int(size)]
+	d.data = d.data[n+int(size):]
+	return v
+}
+
+func (d *jobDecoder) string() string {
+	return string(d.bytes())
+}
+
+// StoreBytes encode job to the binary record for the store, the args larger
+// than CompressArgsSize are compressed by snappy.
+func (job Job) StoreBytes() []byte {
+	var e jobEncoder
+	var flags byte
+	args := job.Args
+	if len(args) > CompressArgsSize {
+		flags |= flagArgsSnappy
+		args = string(snappy.Encode(nil, []byte(args)))
+	}
+	e.WriteByte(jobEncodingV2)
+	e.WriteByte(flags)
+	e.varint(job.ID)
+	e.string(job.Namespace)
+	e.string(job.Name)
+	e.string(job.Func)
+	e.string(args)
+	e.varint(job.Timeout)
+	e.varint(job.Retention)
+	e.varint(job.SchedAt)
+	e.varint(job.RunAt)
+	e.varint(int64(job.FailRetry))
+	e.string(job.Period)
+	e.varint(job.Counter)
+	e.string(job.Status)
+	e.varint(job.Revision)
+	e.string(job.Webhook)
+	e.string(job.TraceParent)
+	e.string(job.TraceState)
+	e.string(job.Blob)
+	return e.Bytes()
+}
+
+// DecodeJob create a job from the record of the store, both the binary
+// records and the legacy json records are accepted.
+func DecodeJob(data []byte) (job Job, err error) {
+	if isLegacyRecord(data) {
+		return NewJob(data)
+	}
+	if len(data) < 2 {
+		return job, ErrInvalidJobRecord
+	}
+	version := data[0]
+	if version != jobEncodingV1 && version != jobEncodingV2 {
+		return job, ErrUnsupportedJobEncoding
+	}
+	flags := data[1]
+	d := jobDecoder{data: data[2:]}
+	job.ID = d.varint()
+	job.Namespace = d.string()
+	job.Name = d.string()
+	job.Func = d.string()
+	args := d.bytes()
+	job.Timeout = d.varint()
+	job.Retention = d.varint()
+	job.SchedAt = d.varint()
+	job.RunAt = d.varint()
+	job.FailRetry = int(d.varint())
+	job.Period = d.string()
+	job.Counter = d.varint()
+	job.Status = d.string()
+	job.Revision = d.varint()
+	job.Webhook = d.string()
+	job.TraceParent = d.string()
+	job.TraceState = d.string()
+	if version >= jobEncodingV2 {
+		job.Blob = d.string()
+	}
+	if d.err != nil {
+		return job, d.err
+	}
+	if flags&flagArgsSnappy != 0 {
+		if args, err = snappy.Decode(nil, args); err != nil {
+			return job, ErrInvalidJobRecord
+		}
+	}
+	job.Args = string(args)
+	err = job.Init()
+	return
+}
+
+// migrateBatchSize the count of the jobs saved at once by MigrateJobs
+const migrateBatchSize = 100
+
+// MigrateJobs rewrite the jobs of the store in the current encoding, the
+// legacy json records are converted. It return the count of the jobs.
+func MigrateJobs(store StoreDriver) (count int, err error) {
+	var jobs []*Job
+	// the iterators hold the lock of the store, the jobs are saved after
+	// the iterator closed.
+	iter := store.NewIterator("", nil)
+	for iter.Next() {
+		job := iter.Value()
+		// the records can not be read are zero jobs, the iterators report
+		// the errors by Error
+		if job.ID == 0 {
+			continue
+		}
+		jobs = append(jobs, &job)
+	}
+	err = iter.Error()
+	iter.Close()
+	if err != nil {
+		return
+	}
+	for start := 0; start < len(jobs); start += migrateBatchSize {
+		end := start + migrateBatchSize
+		if end > len(jobs) {
+			end = len(jobs)
+		}
+		for _, e := range store.SaveBatch(jobs[start:end]) {
+			if e != nil {
+				return count, e
+			}
+			count++
+		}
+	}
+	return
+}
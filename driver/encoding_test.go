@@ -0,0 +1,206 @@
+package driver
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func newTestJob() Job {
+	return Job{
+		ID:          42,
+		Namespace:   "billing",
+		Name:        "invoice",
+		Func:        "billing.send",
+		Args:        "workload",
+		Timeout:     30,
+		Retention:   3600,
+		SchedAt:     1700000000,
+		RunAt:       1700000010,
+		FailRetry:   3,
+		Period:      "every_1m",
+		Counter:     7,
+		Status:      "ready",
+		Revision:    2,
+		Webhook:     "http://localhost/hook",
+		TraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		TraceState:  "congo=t61rcWkgMzE",
+		Blob:        "blob-42",
+	}
+}
+
+func equalJob(a, b Job) bool {
+	a.timeCon = timeCondition{}
+	b.timeCon = timeCondition{}
+	return reflect.DeepEqual(a, b)
+}
+
+func TestStoreBytes(t *testing.T) {
+	var job = newTestJob()
+	var data = job.StoreBytes()
+	if data[0] != jobEncodingV2 {
+		t.Fatalf("StoreBytes: except version: %d, got: %d", jobEncodingV2, data[0])
+	}
+	got, err := DecodeJob(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalJob(job, got) {
+		t.Fatalf("DecodeJob: except: %+v, got: %+v", job, got)
+	}
+
+	job.Args = strings.Repeat("a", CompressArgsSize+1)
+	data = job.StoreBytes()
+	if data[1]&flagArgsSnappy == 0 || len(data) > CompressArgsSize {
+		t.Fatalf("StoreBytes: except the args compressed, got: %d bytes", len(data))
+	}
+	if got, err = DecodeJob(data); err != nil || got.Args != job.Args {
+		t.Fatalf("DecodeJob: except the args decompressed, got: %d bytes, %v", len(got.Args), err)
+	}
+}
+
+func TestDecodeJobV1(t *testing.T) {
+	var job = newTestJob()
+	job.Blob = ""
+	// the version 1 record is the version 2 without the trailing empty blob
+	var data = job.StoreBytes()
+	data = data[:len(data)-1]
+	data[0] = jobEncodingV1
+	got, err := DecodeJob(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalJob(job, got) {
+		t.Fatalf("DecodeJob: except: %+v, got: %+v", job, got)
+	}
+}
+
+func TestDecodeJobLegacy(t *testing.T) {
+	var job = newTestJob()
+	job.Blob = ""
+	got, err := DecodeJob(job.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalJob(job, got) {
+		t.Fatalf("DecodeJob: except: %+v, got: %+v", job, got)
+	}
+
+	var args = strings.Repeat("a", CompressArgsSize+1)
+	var stored = storedJob{Job: job, CompressedArgs: snappy.Encode(nil, []byte(args))}
+	stored.Args = ""
+	data, _ := json.Marshal(stored)
+	if got, err = DecodeJob(data); err != nil || got.Args != args {
+		t.Fatalf("DecodeJob: except the workload_snappy decompressed, got: %d bytes, %v", len(got.Args), err)
+	}
+
+	// the legacy records without retention keep one day
+	if got, err = DecodeJob([]byte(`{"job_id":1,"func":"f","name":"n"}`)); err != nil || got.Retention != 86400 {
+		t.Fatalf("DecodeJob: except retention: 86400, got: %d, %v", got.Retention, err)
+	}
+}
+
+func TestDecodeJobInvalid(t *testing.T) {
+	var job = newTestJob()
+	var data = job.StoreBytes()
+
+	for _, record := range [][]byte{nil, {jobEncodingV2}, data[:len(data)/2], data[:len(data)-1]} {
+		if _, err := DecodeJob(record); err != ErrInvalidJobRecord {
+			t.Fatalf("DecodeJob: except: %v, got: %v", ErrInvalidJobRecord, err)
+		}
+	}
+
+	// a string length overflow the record
+	var size [binary.MaxVarintLen64]byte
+	var n = binary.PutUvarint(size[:], uint64(len(data)))
+	var corrupt = append(append(append([]byte{}, data[:3]...), size[:n]...), data[4:]...)
+	if _, err := DecodeJob(corrupt); err != ErrInvalidJobRecord {
+		t.Fatalf("DecodeJob: except: %v, got: %v", ErrInvalidJobRecord, err)
+	}
+
+	// the args flagged compressed are not snappy
+	corrupt = append([]byte{}, data...)
+	corrupt[1] |= flagArgsSnappy
+	if _, err := DecodeJob(corrupt); err != ErrInvalidJobRecord {
+		t.Fatalf("DecodeJob: except: %v, got: %v", ErrInvalidJobRecord, err)
+	}
+
+	var unknown = append([]byte{}, data...)
+	unknown[0] = jobEncodingV2 + 1
+	if _, err := DecodeJob(unknown); err != ErrUnsupportedJobEncoding {
+		t.Fatalf("DecodeJob: except: %v, got: %v", ErrUnsupportedJobEncoding, err)
+	}
+}
+
+func TestMigrateJobs(t *testing.T) {
+	var store = NewMemStroeDriver()
+	for i := 0; i < migrateBatchSize+1; i++ {
+		var job = newTestJob()
+		job.ID = 0
+		job.Name = job.Name + strings.Repeat("x", i)
+		if err := store.Save(&job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := MigrateJobs(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != migrateBatchSize+1 {
+		t.Fatalf("MigrateJobs: except: %d, got: %d", migrateBatchSize+1, count)
+	}
+	job, err := store.Get(1)
+	if err != nil || job.Name != "invoice" || job.Args != "workload" {
+		t.Fatalf("MigrateJobs: except the job kept, got: %+v, %v", job, err)
+	}
+}
+
+// failedIterator stop after the first job with an error
+type failedIterator struct {
+	Iterator
+	err error
+}
+
+func (iter *failedIterator) Next() bool {
+	if iter.err != nil {
+		return false
+	}
+	if !iter.Iterator.Next() {
+		return false
+	}
+	iter.err = errors.New("connection reset")
+	return true
+}
+
+func (iter *failedIterator) Error() error {
+	return iter.err
+}
+
+type failedStore struct {
+	*MemStoreDriver
+}
+
+func (store failedStore) NewIterator(ns string, Func []byte) Iterator {
+	return &failedIterator{Iterator: store.MemStoreDriver.NewIterator(ns, Func)}
+}
+
+func TestMigrateJobsError(t *testing.T) {
+	var store = failedStore{NewMemStroeDriver()}
+	for _, name := range []string{"a", "b"} {
+		var job = newTestJob()
+		job.ID = 0
+		job.Name = name
+		if err := store.Save(&job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := MigrateJobs(store)
+	if err == nil || count != 0 {
+		t.Fatalf("MigrateJobs: except the iterator error, got: %d, %v", count, err)
+	}
+}
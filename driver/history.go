@@ -0,0 +1,45 @@
+package driver
+
+import (
+	"encoding/json"
+)
+
+// History outcomes
+const (
+	// OutcomeDone the worker tell the job is done
+	OutcomeDone = "done"
+	// OutcomeFail the worker tell the job is fail
+	OutcomeFail = "fail"
+	// OutcomeSchedLater the worker tell sched the job later
+	OutcomeSchedLater = "sched_later"
+	// OutcomeTimeout the job is not finished in the timeout
+	OutcomeTimeout = "timeout"
+)
+
+// History defined an execution record of a job run
+type History struct {
+	JobID      int64  `json:"job_id"`
+	Namespace  string `json:"namespace,omitempty"`
+	Func       string `json:"func"`
+	Name       string `json:"name"`
+	Attempt    int    `json:"attempt"`     // The attempt of the run, start from 1
+	Worker     string `json:"worker"`      // The worker identity the job assigned to
+	AssignedAt int64  `json:"assigned_at"` // When the job is assigned
+	FinishedAt int64  `json:"finished_at"` // When the job is finished
+	Outcome    string `json:"outcome"`
+	Duration   int64  `json:"duration"` // The run duration in milliseconds
+	Result     string `json:"result,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewHistory create an execution record from json bytes
+func NewHistory(payload []byte) (record History, err error) {
+	err = json.Unmarshal(payload, &record)
+	return
+}
+
+// Bytes encode execution record to json bytes
+func (record History) Bytes() (data []byte) {
+	data, _ = json.Marshal(record)
+	return
+}
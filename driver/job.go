@@ -3,8 +3,11 @@ package driver
 import (
 	"encoding/json"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/golang/groupcache/lru"
+	"github.com/golang/snappy"
 	"github.com/gorhill/cronexpr"
 	"github.com/jmuyuyang/periodic/util"
 )
@@ -12,6 +15,7 @@ import (
 // Job workload.
 type Job struct {
 	ID        int64         `json:"job_id"`
+	Namespace string        `json:"namespace,omitempty"`
 	Name      string        `json:"name"`       // The job name, this is unique.
 	Func      string        `json:"func"`       // The job function reffer on worker function
 	Args      string        `json:"workload"`   // Job args
@@ -23,7 +27,17 @@ type Job struct {
 	Period    string        `json:"period"`
 	Counter   int64         `json:"counter"` // The job run counter
 	Status    string        `json:"status"`
-	timeCon   timeCondition `json:"_"`
+	Revision  int64         `json:"revision"`          // Bumped on every submit or update
+	Webhook   string        `json:"webhook,omitempty"` // Notify the job outcomes to the url
+	timeCon   timeCondition `json:"-"`
+
+	// The W3C trace context of the submitter, the worker get the traceparent
+	// of the job run span.
+	TraceParent string `json:"traceparent,omitempty"`
+	TraceState  string `json:"tracestate,omitempty"`
+
+	// The key of the blob the args is offloaded to, see NewBlobDriver.
+	Blob string `json:"-"`
 }
 
 type timeCondition struct {
@@ -31,25 +45,47 @@ type timeCondition struct {
 	Every time.Duration
 }
 
+// timeConditions cache the parsed periods, a cron expression is parsed once
+// instead of on every decode of the job.
+var timeConditions = struct {
+	sync.Mutex
+	cache *lru.Cache
+}{cache: lru.New(4096)}
+
+func parseTimeCondition(period string) (timeCondition, error) {
+	timeConditions.Lock()
+	cached, ok := timeConditions.cache.Get(period)
+	timeConditions.Unlock()
+	if ok {
+		return cached.(timeCondition), nil
+	}
+	var con timeCondition
+	if strings.Index(period, "every_") == 0 {
+		every, err := util.ParseDuration(strings.Trim(period[6:], " "))
+		if err != nil {
+			return con, err
+		}
+		con.Every = every
+	} else {
+		cron, err := cronexpr.Parse(period)
+		if err != nil {
+			return con, err
+		}
+		con.Cron = cron
+	}
+	defer timeConditions.Unlock()
+	timeConditions.Lock()
+	timeConditions.cache.Add(period, con)
+	return con, nil
+}
+
 func (job *Job) Init() error {
 	if job.Period != "" {
-		if strings.Index(job.Period, "every_") == 0 {
-			every, err := util.ParseDuration(strings.Trim(job.Period[6:], " "))
-			if err != nil {
-				return err
-			}
-			job.timeCon = timeCondition{
-				Every: every,
-			}
-		} else {
-			cron, err := cronexpr.Parse(job.Period)
-			if err != nil {
-				return err
-			}
-			job.timeCon = timeCondition{
-				Cron: cron,
-			}
+		con, err := parseTimeCondition(job.Period)
+		if err != nil {
+			return err
 		}
+		job.timeCon = con
 	}
 	return nil
 }
@@ -61,6 +97,11 @@ func (job Job) IsPeriod() bool {
 	return false
 }
 
+// IsExpired check the job is overdue the retention at current
+func (job Job) IsExpired(current int64) bool {
+	return job.Retention > 0 && job.SchedAt > 0 && current-job.SchedAt > job.Retention
+}
+
 // IsReady check job status ready
 func (job Job) IsReady() bool {
 	return job.Status == "ready"
@@ -101,9 +142,65 @@ func (job *Job) SetProc() {
 	job.Status = "processing"
 }
 
-// NewJob create a job from json bytes
+// IsPaused check job status paused
+func (job Job) IsPaused() bool {
+	return job.Status == "paused"
+}
+
+// SetPaused set job status paused, a paused job is not scheduled
+func (job *Job) SetPaused() {
+	job.Status = "paused"
+}
+
+// ArchivedJob defined a job moved to the archive
+type ArchivedJob struct {
+	Job
+	Reason     string `json:"reason"`      // Why the job is archived, eg: expired
+	ArchivedAt int64  `json:"archived_at"` // When the job is archived
+
+	// The key of the blob the args is offloaded to, the blob is kept with
+	// the archived job.
+	Blob string `json:"blob,omitempty"`
+}
+
+// NewArchivedJob archive a job with reason at now
+func NewArchivedJob(job Job, reason string) ArchivedJob {
+	return ArchivedJob{
+		Job:        job,
+		Reason:     reason,
+		ArchivedAt: time.Now().Unix(),
+		Blob:       job.Blob,
+	}
+}
+
+// Bytes encode archived job to json bytes
+func (job ArchivedJob) Bytes() (data []byte) {
+	data, _ = json.Marshal(job)
+	return
+}
+
+// CompressArgsSize the args larger than it are compressed in the store
+const CompressArgsSize = 1024
+
+// storedJob defined a job in the legacy json store records
+type storedJob struct {
+	Job
+	// The args compressed by snappy, the workload is empty then
+	CompressedArgs []byte `json:"workload_snappy,omitempty"`
+}
+
+// NewJob create a job from json bytes, the args compressed by the legacy json
+// store records are decompressed.
 func NewJob(payload []byte) (job Job, err error) {
-	err = json.Unmarshal(payload, &job)
+	var stored storedJob
+	err = json.Unmarshal(payload, &stored)
+	job = stored.Job
+	if err == nil && stored.CompressedArgs != nil {
+		var args []byte
+		if args, err = snappy.Decode(nil, stored.CompressedArgs); err == nil {
+			job.Args = string(args)
+		}
+	}
 	if err == nil {
 		if job.Retention == 0 {
 			//默认存活时间1天
@@ -1,28 +1,71 @@
 package leveldb
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/golang/groupcache/lru"
 	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/logger"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
-// PREJOB prefix job key
+var driverLog = logger.New("driver")
+
+// PREJOB prefix job key, eg: job:[namespace]:[job_id]
 const PREJOB = "job:"
 
-// PREFUNC perfix func key
+// PREJOBNS prefix the namespace key of the job id
+const PREJOBNS = "jobns:"
+
+// PREJOBID prefix the job id index key of the func, eg: jobid:[namespace]:[job_id]
+const PREJOBID = "jobid:"
+
+// PREFUNC perfix func key, eg: func:[namespace]:[func]:[name]
 const PREFUNC = "func:"
 
 // PRESEQUENCE prefix sequence key
 const PRESEQUENCE = "sequence:"
 
+// PREARCHIVE prefix archived job key
+const PREARCHIVE = "archive:"
+
+// PREARCHIVEAT prefix the archive time index key, eg: archiveat:[archived_at]:[job_id]
+const PREARCHIVEAT = "archiveat:"
+
+// PREHISTORY prefix execution record key
+const PREHISTORY = "history:"
+
+// PREWEBHOOK prefix func webhook key
+const PREWEBHOOK = "webhook:"
+
+// PREDELIVERY prefix webhook delivery key
+const PREDELIVERY = "delivery:"
+
+// PREBLOB prefix the blob key of the offloaded args
+const PREBLOB = "blob:"
+
+// PRECOUNT prefix the count key of the records under a prefix, eg:
+// count:history:job:[job_id]:
+const PRECOUNT = "count:"
+
+// SCHEMA the schema version key
+const SCHEMA = "schema"
+
+// schemaVersion the namespaces are in the keys since the schema version 2,
+// the jobs are indexed by job id since the schema version 3, the funcs of the
+// history and the delivery keys are length prefixed and the records are
+// counted since the schema version 4, the history of the removed jobs is
+// deleted since the schema version 5
+const schemaVersion = "5"
+
 // Driver define leveldb store driver
 type Driver struct {
 	db       *leveldb.DB
@@ -44,15 +87,226 @@ func NewDriver(dbpath string) Driver {
 		db, err = leveldb.OpenFile(dbpath, nil)
 	}
 	if err != nil {
-		log.Fatal(err)
+		driverLog.Fatal("Open leveldb failed", "path", dbpath, "err", err)
 	}
 	cache = lru.New(1000)
 	var RWLocker = new(sync.Mutex)
-	return Driver{
+	l := Driver{
 		db:       db,
 		cache:    cache,
 		RWLocker: RWLocker,
 	}
+	migrated, err := l.migrate()
+	if err != nil {
+		driverLog.Fatal("Migrate leveldb failed", "path", dbpath, "err", err)
+	}
+	if migrated > 0 {
+		driverLog.Info("Migrated the jobs to the default namespace", "path", dbpath, "jobs", migrated)
+	}
+	return l
+}
+
+func jobKey(ns string, jobID int64) string {
+	return PREJOB + ns + ":" + strconv.FormatInt(jobID, 10)
+}
+
+func funcKey(ns, Func, name string) string {
+	return PREFUNC + ns + ":" + Func + ":" + name
+}
+
+// funcRecordPrefix the key prefix of the records of a func, the func is
+// length prefixed to keep a func from matching the funcs it prefix, eg:
+// history:func:[namespace]:[len(func)]:[func]:
+func funcRecordPrefix(prefix, ns, Func string) string {
+	return prefix + ns + ":" + strconv.Itoa(len(Func)) + ":" + Func + ":"
+}
+
+// jobIDKey the job id index key, the job id is padded to keep the keys in the
+// job id order.
+func jobIDKey(ns string, jobID int64) string {
+	return fmt.Sprintf("%s%s:%020d", PREJOBID, ns, jobID)
+}
+
+// migrate upgrade the data stored by the older schema versions step by step.
+func (l Driver) migrate() (migrated int, err error) {
+	var version string
+	if data, e := l.db.Get([]byte(SCHEMA), nil); e == nil {
+		version = string(data)
+	}
+	if version == schemaVersion {
+		return
+	}
+	if version < "2" {
+		if migrated, err = l.migrateNamespaces(); err != nil {
+			return
+		}
+	}
+	if version < "3" {
+		if err = l.indexJobs(); err != nil {
+			return
+		}
+	}
+	if version < "4" {
+		if err = l.countRecords(); err != nil {
+			return
+		}
+	}
+	if version < "5" {
+		err = l.purgeHistory()
+	}
+	return
+}
+
+// migrateNamespaces move the data stored before the namespaces into the
+// default namespace, the func keys are rebuilt from the jobs. All the changes
+// and the schema version are written with a single leveldb batch.
+func (l Driver) migrateNamespaces() (migrated int, err error) {
+	var ns = driver.DefaultNamespace
+	batch := new(leveldb.Batch)
+	iter := l.db.NewIterator(nil, nil)
+	for iter.Next() {
+		key := string(iter.Key())
+		value := append([]byte(nil), iter.Value()...)
+		switch {
+		case strings.HasPrefix(key, PREJOB):
+			// the legacy key is job:[job_id]
+			if strings.Contains(key[len(PREJOB):], ":") {
+				break
+			}
+			job, e := driver.DecodeJob(value)
+			if e != nil {
+				driverLog.Warn("Skip the invalid job", "key", key, "err", e)
+				break
+			}
+			job.Namespace = ns
+			strID := strconv.FormatInt(job.ID, 10)
+			batch.Delete(iter.Key())
+			batch.Put([]byte(jobKey(ns, job.ID)), job.StoreBytes())
+			batch.Put([]byte(PREJOBNS+strID), []byte(ns))
+			batch.Put([]byte(funcKey(ns, job.Func, job.Name)), []byte(strID))
+			migrated++
+			break
+		case strings.HasPrefix(key, PREFUNC):
+			batch.Delete(iter.Key())
+			break
+		case strings.HasPrefix(key, PREHISTORY+"func:"):
+			batch.Delete(iter.Key())
+			batch.Put([]byte(PREHISTORY+"func:"+ns+":"+key[len(PREHISTORY+"func:"):]), value)
+			break
+		case strings.HasPrefix(key, PREWEBHOOK):
+			batch.Delete(iter.Key())
+			batch.Put([]byte(PREWEBHOOK+ns+":"+key[len(PREWEBHOOK):]), value)
+			break
+		case strings.HasPrefix(key, PREDELIVERY):
+			batch.Delete(iter.Key())
+			batch.Put([]byte(PREDELIVERY+ns+":"+key[len(PREDELIVERY):]), value)
+			break
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return
+	}
+	batch.Put([]byte(SCHEMA), []byte("2"))
+	err = l.db.Write(batch, nil)
+	return
+}
+
+// indexJobs build the job id index of the jobs stored before the schema
+// version 3.
+func (l Driver) indexJobs() (err error) {
+	batch := new(leveldb.Batch)
+	iter := l.db.NewIterator(util.BytesPrefix([]byte(PREJOB)), nil)
+	for iter.Next() {
+		key := string(iter.Key())
+		job, e := driver.DecodeJob(iter.Value())
+		if e != nil {
+			driverLog.Warn("Skip the invalid job", "key", key, "err", e)
+			continue
+		}
+		ns := key[len(PREJOB):strings.LastIndex(key, ":")]
+		batch.Put([]byte(jobIDKey(ns, job.ID)), []byte(job.Func))
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return
+	}
+	batch.Put([]byte(SCHEMA), []byte("3"))
+	err = l.db.Write(batch, nil)
+	return
+}
+
+// countRecords move the records of the funcs stored before the schema version
+// 4 to the length prefixed keys, and count the records of every prefix.
+func (l Driver) countRecords() (err error) {
+	var counts = make(map[string]int)
+	batch := new(leveldb.Batch)
+	for _, prefix := range []string{PREHISTORY + "job:", PREHISTORY + "func:", PREDELIVERY} {
+		iter := l.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+		for iter.Next() {
+			key := string(iter.Key())
+			if prefix == PREHISTORY+"job:" {
+				counts[key[:strings.LastIndex(key, ":")+1]]++
+				continue
+			}
+			// the legacy key is [prefix][namespace]:[func]:[seq]
+			rest := key[len(prefix):]
+			sep := strings.Index(rest, ":")
+			last := strings.LastIndex(rest, ":")
+			if sep < 0 || last <= sep {
+				continue
+			}
+			newPrefix := funcRecordPrefix(prefix, rest[:sep], rest[sep+1:last])
+			batch.Delete(iter.Key())
+			batch.Put([]byte(newPrefix+rest[last+1:]), append([]byte(nil), iter.Value()...))
+			counts[newPrefix]++
+		}
+		iter.Release()
+		if err = iter.Error(); err != nil {
+			return
+		}
+	}
+	for prefix, count := range counts {
+		batch.Put([]byte(PRECOUNT+prefix), []byte(strconv.Itoa(count)))
+	}
+	batch.Put([]byte(SCHEMA), []byte("4"))
+	err = l.db.Write(batch, nil)
+	return
+}
+
+// purgeHistory delete the history left by the jobs removed before the schema
+// version 5, the history of the jobs and the archived jobs is kept.
+func (l Driver) purgeHistory() (err error) {
+	var kept = make(map[string]bool)
+	batch := new(leveldb.Batch)
+	iter := l.db.NewIterator(util.BytesPrefix([]byte(PREHISTORY+"job:")), nil)
+	for iter.Next() {
+		key := string(iter.Key())
+		strID := key[len(PREHISTORY+"job:"):strings.LastIndex(key, ":")]
+		keep, ok := kept[strID]
+		if !ok {
+			keep = l.has(PREJOBNS+strID) || l.has(PREARCHIVE+strID)
+			kept[strID] = keep
+			if !keep {
+				batch.Delete([]byte(PRECOUNT + key[:strings.LastIndex(key, ":")+1]))
+			}
+		}
+		if !keep {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return
+	}
+	batch.Put([]byte(SCHEMA), []byte(schemaVersion))
+	err = l.db.Write(batch, nil)
+	return
+}
+
+func (l Driver) has(key string) bool {
+	ok, _ := l.db.Has([]byte(key), nil)
+	return ok
 }
 
 // Save job. when job is exists update it, other create one.
@@ -60,23 +314,66 @@ func (l Driver) Save(job *driver.Job, force ...bool) (err error) {
 	defer l.RWLocker.Unlock()
 	l.RWLocker.Lock()
 	batch := new(leveldb.Batch)
+	oldID := l.lastID()
+	lastID := oldID
+	if err = l.save(batch, job, &lastID, len(force) > 0 && force[0]); err != nil {
+		return
+	}
+	if lastID > oldID {
+		batch.Put([]byte(PRESEQUENCE+"JOB"), []byte(strconv.FormatInt(lastID, 10)))
+	}
+	err = l.db.Write(batch, nil)
+	return
+}
+
+// SaveBatch save a batch of jobs at once, returns the error of each job.
+// All the jobs are written with a single leveldb batch.
+func (l Driver) SaveBatch(jobs []*driver.Job) []error {
+	defer l.RWLocker.Unlock()
+	l.RWLocker.Lock()
+	var errs = make([]error, len(jobs))
+	batch := new(leveldb.Batch)
+	oldID := l.lastID()
+	lastID := oldID
+	for i, job := range jobs {
+		errs[i] = l.save(batch, job, &lastID, false)
+	}
+	if lastID > oldID {
+		batch.Put([]byte(PRESEQUENCE+"JOB"), []byte(strconv.FormatInt(lastID, 10)))
+	}
+	if err := l.db.Write(batch, nil); err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
+
+func (l Driver) lastID() (id int64) {
+	data, err := l.db.Get([]byte(PRESEQUENCE+"JOB"), nil)
+	if err != nil || data == nil {
+		return 0
+	}
+	id, _ = strconv.ParseInt(string(data), 10, 64)
+	return
+}
+
+func (l Driver) save(batch *leveldb.Batch, job *driver.Job, lastID *int64, force bool) (err error) {
 	var isNew = true
 	if job.ID > 0 {
 		isNew = false
 	} else {
-		lastID, e := l.db.Get([]byte(PRESEQUENCE+"JOB"), nil)
-		if e != nil || lastID == nil {
-			job.ID = 1
-		} else {
-			id, _ := strconv.ParseInt(string(lastID), 10, 64)
-			job.ID = id + 1
-		}
+		*lastID = *lastID + 1
+		job.ID = *lastID
 	}
 	var strID = strconv.FormatInt(job.ID, 10)
-	if isNew {
-		batch.Put([]byte(PRESEQUENCE+"JOB"), []byte(strID))
-		batch.Put([]byte(PREFUNC+job.Func+":"+job.Name), []byte(strID))
-	} else if len(force) == 0 || !force[0] {
+	if isNew || force {
+		l.cache.Remove(PREJOB + strID)
+		batch.Put([]byte(funcKey(job.Namespace, job.Func, job.Name)), []byte(strID))
+		batch.Put([]byte(PREJOBNS+strID), []byte(job.Namespace))
+	} else {
 		old, e := l.get(job.ID)
 		if e != nil || old.ID == 0 {
 			err = fmt.Errorf("Update Job %d fail, the old job is not exists.", job.ID)
@@ -84,33 +381,171 @@ func (l Driver) Save(job *driver.Job, force ...bool) (err error) {
 		}
 		l.cache.Remove(PREJOB + strID)
 		if old.Name != job.Name {
-			batch.Delete([]byte(PREFUNC + job.Func + ":" + old.Name))
-			batch.Put([]byte(PREFUNC+job.Func+":"+job.Name), []byte(strID))
+			batch.Delete([]byte(funcKey(old.Namespace, job.Func, old.Name)))
+			batch.Put([]byte(funcKey(job.Namespace, job.Func, job.Name)), []byte(strID))
 		}
 	}
-	batch.Put([]byte(PREJOB+strID), job.Bytes())
-	err = l.db.Write(batch, nil)
+	batch.Put([]byte(jobKey(job.Namespace, job.ID)), job.StoreBytes())
+	batch.Put([]byte(jobIDKey(job.Namespace, job.ID)), []byte(job.Func))
 	return
 }
 
-// Delete a job with job id.
+// Delete a job with job id and its execution records.
 func (l Driver) Delete(jobID int64) (err error) {
 	defer l.RWLocker.Unlock()
 	l.RWLocker.Lock()
-	var job driver.Job
 	batch := new(leveldb.Batch)
+	if err = l.delete(batch, jobID); err != nil {
+		return
+	}
+	l.deleteHistory(batch, jobID)
+	err = l.db.Write(batch, nil)
+	return
+}
+
+// DeleteBatch delete a batch of jobs at once, returns the error of each job.
+// All the jobs are removed with a single leveldb batch.
+func (l Driver) DeleteBatch(jobIDs []int64) []error {
+	defer l.RWLocker.Unlock()
+	l.RWLocker.Lock()
+	var errs = make([]error, len(jobIDs))
+	batch := new(leveldb.Batch)
+	for i, jobID := range jobIDs {
+		if errs[i] = l.delete(batch, jobID); errs[i] == nil {
+			l.deleteHistory(batch, jobID)
+		}
+	}
+	if err := l.db.Write(batch, nil); err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
+
+func (l Driver) delete(batch *leveldb.Batch, jobID int64) (err error) {
+	var job driver.Job
 	job, err = l.get(jobID)
 	if err != nil {
 		return
 	}
 	var strID = strconv.FormatInt(job.ID, 10)
-	batch.Delete([]byte(PREFUNC + job.Func + ":" + job.Name))
-	batch.Delete([]byte(PREJOB + strID))
-	err = l.db.Write(batch, nil)
+	batch.Delete([]byte(funcKey(job.Namespace, job.Func, job.Name)))
+	batch.Delete([]byte(jobKey(job.Namespace, job.ID)))
+	batch.Delete([]byte(jobIDKey(job.Namespace, job.ID)))
+	batch.Delete([]byte(PREJOBNS + strID))
 	l.cache.Remove(PREJOB + strID)
 	return
 }
 
+// jobHistoryPrefix the key prefix of the execution records of a job
+func jobHistoryPrefix(jobID int64) string {
+	return PREHISTORY + "job:" + strconv.FormatInt(jobID, 10) + ":"
+}
+
+// deleteHistory delete the execution records of a job and their count.
+func (l Driver) deleteHistory(batch *leveldb.Batch, jobID int64) {
+	var prefix = jobHistoryPrefix(jobID)
+	iter := l.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+	batch.Delete([]byte(PRECOUNT + prefix))
+}
+
+// Archive move a job out of the jobs into the archive with a reason.
+func (l Driver) Archive(jobID int64, reason string) (err error) {
+	defer l.RWLocker.Unlock()
+	l.RWLocker.Lock()
+	var job driver.Job
+	job, err = l.get(jobID)
+	if err != nil {
+		return
+	}
+	batch := new(leveldb.Batch)
+	if err = l.delete(batch, jobID); err != nil {
+		return
+	}
+	archived := driver.NewArchivedJob(job, reason)
+	batch.Put([]byte(PREARCHIVE+strconv.FormatInt(job.ID, 10)), archived.Bytes())
+	batch.Put([]byte(archiveAtKey(archived.ArchivedAt, job.ID)), nil)
+	err = l.db.Write(batch, nil)
+	return
+}
+
+// archiveAtKey the index key of the archived job, the time is padded to keep
+// the keys in the time order.
+func archiveAtKey(archivedAt, jobID int64) string {
+	return fmt.Sprintf("%s%020d:%d", PREARCHIVEAT, archivedAt, jobID)
+}
+
+// PurgeArchived remove the jobs archived before the time and their execution
+// records, it returns the removed jobs.
+func (l Driver) PurgeArchived(before int64) (jobs []driver.ArchivedJob, err error) {
+	defer l.RWLocker.Unlock()
+	l.RWLocker.Lock()
+	batch := new(leveldb.Batch)
+	iter := l.db.NewIterator(&util.Range{
+		Start: []byte(PREARCHIVEAT),
+		Limit: []byte(fmt.Sprintf("%s%020d:", PREARCHIVEAT, before)),
+	}, nil)
+	for iter.Next() {
+		key := string(iter.Key())
+		strID := key[strings.LastIndex(key, ":")+1:]
+		if data, e := l.db.Get([]byte(PREARCHIVE+strID), nil); e == nil {
+			var job driver.ArchivedJob
+			if json.Unmarshal(data, &job) == nil {
+				jobs = append(jobs, job)
+			}
+		}
+		batch.Delete([]byte(key))
+		batch.Delete([]byte(PREARCHIVE + strID))
+		jobID, _ := strconv.ParseInt(strID, 10, 64)
+		l.deleteHistory(batch, jobID)
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return nil, err
+	}
+	if err = l.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// GetArchived get an archived job with job id.
+func (l Driver) GetArchived(jobID int64) (job driver.ArchivedJob, err error) {
+	var data []byte
+	data, err = l.db.Get([]byte(PREARCHIVE+strconv.FormatInt(jobID, 10)), nil)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &job)
+	return
+}
+
+// PutBlob save the blob by key.
+func (l Driver) PutBlob(key string, data []byte) error {
+	return l.db.Put([]byte(PREBLOB+key), data, nil)
+}
+
+// GetBlob get the blob by key.
+func (l Driver) GetBlob(key string) (data []byte, err error) {
+	data, err = l.db.Get([]byte(PREBLOB+key), nil)
+	if err == leveldb.ErrNotFound {
+		err = driver.ErrBlobNotFound
+	}
+	return
+}
+
+// DeleteBlob remove the blob by key.
+func (l Driver) DeleteBlob(key string) error {
+	return l.db.Delete([]byte(PREBLOB+key), nil)
+}
+
 // Get a job with job id.
 func (l Driver) Get(jobID int64) (driver.Job, error) {
 	defer l.RWLocker.Unlock()
@@ -120,53 +555,180 @@ func (l Driver) Get(jobID int64) (driver.Job, error) {
 
 func (l Driver) get(jobID int64) (job driver.Job, err error) {
 	var data []byte
-	var key = PREJOB + strconv.FormatInt(jobID, 10)
+	var strID = strconv.FormatInt(jobID, 10)
+	var key = PREJOB + strID
 	if val, hit := l.cache.Get(key); hit {
 		return val.(driver.Job), nil
 	}
-	data, err = l.db.Get([]byte(key), nil)
+	data, err = l.db.Get([]byte(PREJOBNS+strID), nil)
+	if err != nil {
+		return
+	}
+	data, err = l.db.Get([]byte(jobKey(string(data), jobID)), nil)
 	if err != nil {
 		return
 	}
-	job, err = driver.NewJob(data)
+	job, err = driver.DecodeJob(data)
 	if err == nil {
 		l.cache.Add(key, job)
 	}
 	return
 }
 
-// GetOne get a job with func and name.
-func (l Driver) GetOne(Func, name string) (job driver.Job, err error) {
+// GetOne get a job with namespace, func and name.
+func (l Driver) GetOne(ns, Func, name string) (job driver.Job, err error) {
 	defer l.RWLocker.Unlock()
 	l.RWLocker.Lock()
 	var data []byte
-	var key = PREFUNC + Func + ":" + name
-	data, err = l.db.Get([]byte(key), nil)
+	data, err = l.db.Get([]byte(funcKey(ns, Func, name)), nil)
 	if err != nil {
 		return
 	}
-	key = PREJOB + string(data)
-	if val, hit := l.cache.Get(key); hit {
-		return val.(driver.Job), nil
+	jobID, _ := strconv.ParseInt(string(data), 10, 64)
+	return l.get(jobID)
+}
+
+// AddHistory append an execution record, and keep at most jobLimit
+// records of the job and funcLimit records of the func.
+func (l Driver) AddHistory(record driver.History, jobLimit, funcLimit int) (err error) {
+	defer l.RWLocker.Unlock()
+	l.RWLocker.Lock()
+	var seq int64
+	data, e := l.db.Get([]byte(PRESEQUENCE+"HISTORY"), nil)
+	if e == nil {
+		seq, _ = strconv.ParseInt(string(data), 10, 64)
 	}
-	data, err = l.db.Get([]byte(key), nil)
+	seq = seq + 1
+	var strSeq = fmt.Sprintf("%020d", seq)
+	var jobPrefix = jobHistoryPrefix(record.JobID)
+	var funcPrefix = funcRecordPrefix(PREHISTORY+"func:", record.Namespace, record.Func)
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(PRESEQUENCE+"HISTORY"), []byte(strconv.FormatInt(seq, 10)))
+	batch.Put([]byte(jobPrefix+strSeq), record.Bytes())
+	batch.Put([]byte(funcPrefix+strSeq), record.Bytes())
+	l.trimPrefix(batch, jobPrefix, jobLimit)
+	l.trimPrefix(batch, funcPrefix, funcLimit)
+	err = l.db.Write(batch, nil)
+	return
+}
+
+// trimPrefix delete the oldest records of prefix, make room for a new one.
+// The records of prefix are counted, only the records deleted are read.
+func (l Driver) trimPrefix(batch *leveldb.Batch, prefix string, limit int) {
+	var count int
+	data, e := l.db.Get([]byte(PRECOUNT+prefix), nil)
+	if e == nil {
+		count, _ = strconv.Atoi(string(data))
+	}
+	// the new record
+	count = count + 1
+	if limit > 0 && count > limit {
+		iter := l.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+		for n := count - limit; n > 0 && iter.Next(); n-- {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+			count = count - 1
+		}
+		iter.Release()
+	}
+	batch.Put([]byte(PRECOUNT+prefix), []byte(strconv.Itoa(count)))
+}
+
+// GetHistory get at most limit execution records of a job, newest first.
+func (l Driver) GetHistory(jobID int64, limit int) ([]driver.History, error) {
+	return l.getHistory(jobHistoryPrefix(jobID), limit)
+}
+
+// GetFuncHistory get at most limit execution records of a func, newest first.
+func (l Driver) GetFuncHistory(ns, Func string, limit int) ([]driver.History, error) {
+	return l.getHistory(funcRecordPrefix(PREHISTORY+"func:", ns, Func), limit)
+}
+
+func (l Driver) getHistory(prefix string, limit int) (records []driver.History, err error) {
+	records = make([]driver.History, 0)
+	iter := l.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+	for ok := iter.Last(); ok; ok = iter.Prev() {
+		if limit > 0 && len(records) >= limit {
+			break
+		}
+		record, e := driver.NewHistory(iter.Value())
+		if e != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	err = iter.Error()
+	return
+}
+
+// SaveWebhook save the webhook of a func.
+func (l Driver) SaveWebhook(hook driver.Webhook) error {
+	return l.db.Put([]byte(PREWEBHOOK+hook.Namespace+":"+hook.Func), hook.Bytes(), nil)
+}
+
+// GetWebhook get the webhook of a func.
+func (l Driver) GetWebhook(ns, Func string) (hook driver.Webhook, err error) {
+	var data []byte
+	data, err = l.db.Get([]byte(PREWEBHOOK+ns+":"+Func), nil)
 	if err != nil {
 		return
 	}
-	job, err = driver.NewJob(data)
-	if err == nil {
-		l.cache.Add(key, job)
+	return driver.NewWebhook(data)
+}
+
+// DeleteWebhook delete the webhook of a func.
+func (l Driver) DeleteWebhook(ns, Func string) error {
+	return l.db.Delete([]byte(PREWEBHOOK+ns+":"+Func), nil)
+}
+
+// AddDelivery append a webhook delivery, and keep at most limit deliveries of the func.
+func (l Driver) AddDelivery(d driver.Delivery, limit int) (err error) {
+	defer l.RWLocker.Unlock()
+	l.RWLocker.Lock()
+	var seq int64
+	data, e := l.db.Get([]byte(PRESEQUENCE+"DELIVERY"), nil)
+	if e == nil {
+		seq, _ = strconv.ParseInt(string(data), 10, 64)
 	}
+	seq = seq + 1
+	var prefix = funcRecordPrefix(PREDELIVERY, d.Namespace, d.Func)
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(PRESEQUENCE+"DELIVERY"), []byte(strconv.FormatInt(seq, 10)))
+	batch.Put([]byte(prefix+fmt.Sprintf("%020d", seq)), d.Bytes())
+	l.trimPrefix(batch, prefix, limit)
+	err = l.db.Write(batch, nil)
 	return
 }
 
-// NewIterator create a job Iterator with func or nil.
-func (l Driver) NewIterator(Func []byte) driver.Iterator {
+// GetDeliveries get at most limit webhook deliveries of a func, newest first.
+func (l Driver) GetDeliveries(ns, Func string, limit int) (deliveries []driver.Delivery, err error) {
+	deliveries = make([]driver.Delivery, 0)
+	iter := l.db.NewIterator(util.BytesPrefix([]byte(funcRecordPrefix(PREDELIVERY, ns, Func))), nil)
+	defer iter.Release()
+	for ok := iter.Last(); ok; ok = iter.Prev() {
+		if limit > 0 && len(deliveries) >= limit {
+			break
+		}
+		d, e := driver.NewDelivery(iter.Value())
+		if e != nil {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	err = iter.Error()
+	return
+}
+
+// NewIterator create a job Iterator with namespace and func or nil, an empty
+// namespace iterate the jobs of all the namespaces.
+func (l Driver) NewIterator(ns string, Func []byte) driver.Iterator {
 	var prefix []byte
-	if Func == nil {
-		prefix = []byte(PREJOB)
+	if Func != nil {
+		prefix = []byte(PREFUNC + ns + ":" + string(Func))
+	} else if ns != "" {
+		prefix = []byte(PREJOB + ns + ":")
 	} else {
-		prefix = []byte(PREFUNC + string(Func))
+		prefix = []byte(PREJOB)
 	}
 	l.RWLocker.Lock()
 	iter := l.db.NewIterator(util.BytesPrefix(prefix), nil)
@@ -177,6 +739,26 @@ func (l Driver) NewIterator(Func []byte) driver.Iterator {
 	}
 }
 
+// NewIteratorAfter create a job Iterator like NewIterator, the jobs after the
+// cursor are iterated in the job id order of each namespace.
+func (l Driver) NewIteratorAfter(ns string, Func []byte, cursor int64) driver.Iterator {
+	var prefix = []byte(PREJOBID)
+	if ns != "" {
+		prefix = []byte(PREJOBID + ns + ":")
+	}
+	r := util.BytesPrefix(prefix)
+	if ns != "" {
+		r.Start = []byte(jobIDKey(ns, cursor+1))
+	}
+	l.RWLocker.Lock()
+	return &idIterator{
+		l:      l,
+		iter:   l.db.NewIterator(r, nil),
+		Func:   Func,
+		cursor: cursor,
+	}
+}
+
 // Close the driver
 func (l Driver) Close() error {
 	err := l.db.Close()
@@ -200,7 +782,7 @@ func (iter *Iterator) Next() bool {
 func (iter *Iterator) Value() (job driver.Job) {
 	data := iter.iter.Value()
 	if iter.Func == nil {
-		job, _ = driver.NewJob(data)
+		job, _ = driver.DecodeJob(data)
 		return
 	}
 	jobID, _ := strconv.ParseInt(string(data), 10, 64)
@@ -218,3 +800,46 @@ func (iter *Iterator) Close() {
 	iter.iter.Release()
 	iter.l.RWLocker.Unlock()
 }
+
+// idIterator define the job iterator over the job id index
+type idIterator struct {
+	l      Driver
+	iter   iterator.Iterator
+	Func   []byte
+	cursor int64
+	job    driver.Job
+}
+
+// Next advances the iterator to the next value, which will then be available through
+// then the Value method. It returns false if no further advancement is possible.
+func (iter *idIterator) Next() bool {
+	for iter.iter.Next() {
+		if iter.Func != nil && !bytes.Equal(iter.iter.Value(), iter.Func) {
+			continue
+		}
+		key := string(iter.iter.Key())
+		jobID, _ := strconv.ParseInt(key[strings.LastIndex(key, ":")+1:], 10, 64)
+		if jobID <= iter.cursor {
+			continue
+		}
+		iter.job, _ = iter.l.get(jobID)
+		return true
+	}
+	return false
+}
+
+// Value returns the current job.
+func (iter *idIterator) Value() driver.Job {
+	return iter.job
+}
+
+// Error returns the current error.
+func (iter *idIterator) Error() error {
+	return iter.iter.Error()
+}
+
+// Close the iterator
+func (iter *idIterator) Close() {
+	iter.iter.Release()
+	iter.l.RWLocker.Unlock()
+}
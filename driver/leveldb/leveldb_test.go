@@ -0,0 +1,100 @@
+package leveldb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmuyuyang/periodic/driver"
+)
+
+func newTestDriver(t *testing.T) (Driver, func()) {
+	dir, err := ioutil.TempDir("", "periodic-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewDriver(filepath.Join(dir, "db"))
+	return l, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func addHistory(t *testing.T, l Driver, job driver.Job, n int) {
+	for i := 0; i < n; i++ {
+		record := driver.History{JobID: job.ID, Namespace: job.Namespace, Func: job.Func, Name: job.Name}
+		if err := l.AddHistory(record, 10, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeleteHistory(t *testing.T) {
+	l, done := newTestDriver(t)
+	defer done()
+	var jobs []driver.Job
+	for _, name := range []string{"a", "b", "c"} {
+		job := driver.Job{Namespace: driver.DefaultNamespace, Func: "f", Name: name}
+		if err := l.Save(&job); err != nil {
+			t.Fatal(err)
+		}
+		addHistory(t, l, job, 2)
+		jobs = append(jobs, job)
+	}
+
+	if err := l.Delete(jobs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if errs := l.DeleteBatch([]int64{jobs[1].ID}); errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	for _, job := range jobs[:2] {
+		if records, _ := l.GetHistory(job.ID, 0); len(records) != 0 {
+			t.Fatalf("Delete: except the history deleted, got: %d records", len(records))
+		}
+		if ok, _ := l.db.Has([]byte(PRECOUNT+jobHistoryPrefix(job.ID)), nil); ok {
+			t.Fatalf("Delete: except the history count deleted")
+		}
+	}
+	if records, _ := l.GetFuncHistory(driver.DefaultNamespace, "f", 0); len(records) != 6 {
+		t.Fatalf("GetFuncHistory: except: 6, got: %d", len(records))
+	}
+
+	if err := l.Archive(jobs[2].ID, "dead_lettered"); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := l.GetHistory(jobs[2].ID, 0); len(records) != 2 {
+		t.Fatalf("Archive: except the history kept, got: %d records", len(records))
+	}
+	if _, err := l.PurgeArchived(time.Now().Unix() + 1); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := l.GetHistory(jobs[2].ID, 0); len(records) != 0 {
+		t.Fatalf("PurgeArchived: except the history deleted, got: %d records", len(records))
+	}
+}
+
+func TestPurgeHistory(t *testing.T) {
+	l, done := newTestDriver(t)
+	defer done()
+	job := driver.Job{Namespace: driver.DefaultNamespace, Func: "f", Name: "a"}
+	if err := l.Save(&job); err != nil {
+		t.Fatal(err)
+	}
+	addHistory(t, l, job, 2)
+	// the history left by a job removed before the schema version 5
+	addHistory(t, l, driver.Job{ID: job.ID + 1, Namespace: job.Namespace, Func: "f", Name: "b"}, 2)
+	l.db.Put([]byte(SCHEMA), []byte("4"), nil)
+
+	if _, err := l.migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := l.GetHistory(job.ID, 0); len(records) != 2 {
+		t.Fatalf("migrate: except the history of the job kept, got: %d records", len(records))
+	}
+	if records, _ := l.GetHistory(job.ID+1, 0); len(records) != 0 {
+		t.Fatalf("migrate: except the history of the removed job deleted, got: %d records", len(records))
+	}
+}
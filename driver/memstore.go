@@ -2,6 +2,7 @@ package driver
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -9,9 +10,18 @@ import (
 // MemStoreDriver defined a memory store driver
 type MemStoreDriver struct {
 	data      map[int64]*Job
+	archive   map[int64]ArchivedJob
+	archived  []int64
+	history   map[int64][]History
+	funcHist  map[string][]History
+	webhooks  map[string]Webhook
+	delivery  map[string][]Delivery
 	nameIndex map[string]int64
+	blobs     map[string][]byte
 	lastID    int64
 	locker    *sync.Mutex
+	// the blobs are read while an iterator hold the locker
+	blobLocker *sync.Mutex
 }
 
 // NewMemStroeDriver create a memory store driver
@@ -20,6 +30,13 @@ func NewMemStroeDriver() *MemStoreDriver {
 	mem.locker = new(sync.Mutex)
 	mem.nameIndex = make(map[string]int64)
 	mem.data = make(map[int64]*Job)
+	mem.archive = make(map[int64]ArchivedJob)
+	mem.history = make(map[int64][]History)
+	mem.funcHist = make(map[string][]History)
+	mem.webhooks = make(map[string]Webhook)
+	mem.delivery = make(map[string][]Delivery)
+	mem.blobs = make(map[string][]byte)
+	mem.blobLocker = new(sync.Mutex)
 	mem.lastID = 0
 	return mem
 }
@@ -28,38 +45,147 @@ func NewMemStroeDriver() *MemStoreDriver {
 func (m *MemStoreDriver) Save(job *Job, force ...bool) (err error) {
 	defer m.locker.Unlock()
 	m.locker.Lock()
-	if job.ID > 0 && (len(force) == 0 || !force[0]) {
+	return m.save(job, len(force) > 0 && force[0])
+}
+
+// SaveBatch save a batch of jobs at once, returns the error of each job.
+func (m *MemStoreDriver) SaveBatch(jobs []*Job) []error {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	var errs = make([]error, len(jobs))
+	for i, job := range jobs {
+		errs[i] = m.save(job, false)
+	}
+	return errs
+}
+
+func (m *MemStoreDriver) save(job *Job, force bool) (err error) {
+	if job.ID > 0 && !force {
 		old, ok := m.data[job.ID]
 		if !ok {
 			return fmt.Errorf("Update Job %d fail, the job is not exists.", job.ID)
 		}
 		if old.Name != job.Name {
-			delete(m.nameIndex, old.Func+":"+old.Name)
-			m.nameIndex[job.Func+":"+job.Name] = job.ID
+			delete(m.nameIndex, nsKey(old.Namespace, old.Func)+":"+old.Name)
+			m.nameIndex[nsKey(job.Namespace, job.Func)+":"+job.Name] = job.ID
 		}
 	} else {
 		m.lastID++
 		job.ID = m.lastID
-		m.nameIndex[job.Func+":"+job.Name] = job.ID
+		m.nameIndex[nsKey(job.Namespace, job.Func)+":"+job.Name] = job.ID
 	}
 	m.data[job.ID] = job
 	return
 }
 
-// Delete a job with job id.
+// Delete a job with job id and its execution records.
 func (m *MemStoreDriver) Delete(jobID int64) (err error) {
 	defer m.locker.Unlock()
 	m.locker.Lock()
+	if err = m.delete(jobID); err == nil {
+		delete(m.history, jobID)
+	}
+	return
+}
+
+// DeleteBatch delete a batch of jobs at once, returns the error of each job.
+func (m *MemStoreDriver) DeleteBatch(jobIDs []int64) []error {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	var errs = make([]error, len(jobIDs))
+	for i, jobID := range jobIDs {
+		if errs[i] = m.delete(jobID); errs[i] == nil {
+			delete(m.history, jobID)
+		}
+	}
+	return errs
+}
+
+func (m *MemStoreDriver) delete(jobID int64) (err error) {
 	var job Job
 	job, err = m.Get(jobID)
 	if err != nil {
 		return
 	}
 	delete(m.data, job.ID)
-	delete(m.nameIndex, job.Func+":"+job.Name)
+	delete(m.nameIndex, nsKey(job.Namespace, job.Func)+":"+job.Name)
 	return
 }
 
+// Archive move a job out of the jobs into the archive with a reason.
+func (m *MemStoreDriver) Archive(jobID int64, reason string) (err error) {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	var job Job
+	job, err = m.Get(jobID)
+	if err != nil {
+		return
+	}
+	m.archive[job.ID] = NewArchivedJob(job, reason)
+	m.archived = append(m.archived, job.ID)
+	return m.delete(jobID)
+}
+
+// GetArchived get an archived job with job id.
+func (m *MemStoreDriver) GetArchived(jobID int64) (job ArchivedJob, err error) {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	job, ok := m.archive[jobID]
+	if !ok {
+		err = fmt.Errorf("Archived Job %d not exists.", jobID)
+	}
+	return
+}
+
+// PurgeArchived remove the jobs archived before the time and their execution
+// records, it returns the removed jobs.
+func (m *MemStoreDriver) PurgeArchived(before int64) (jobs []ArchivedJob, err error) {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	var n int
+	for _, jobID := range m.archived {
+		job, ok := m.archive[jobID]
+		if ok && job.ArchivedAt >= before {
+			break
+		}
+		if ok {
+			jobs = append(jobs, job)
+			delete(m.archive, jobID)
+			delete(m.history, jobID)
+		}
+		n++
+	}
+	m.archived = m.archived[n:]
+	return
+}
+
+// PutBlob save the blob by key.
+func (m *MemStoreDriver) PutBlob(key string, data []byte) error {
+	defer m.blobLocker.Unlock()
+	m.blobLocker.Lock()
+	m.blobs[key] = data
+	return nil
+}
+
+// GetBlob get the blob by key.
+func (m *MemStoreDriver) GetBlob(key string) ([]byte, error) {
+	defer m.blobLocker.Unlock()
+	m.blobLocker.Lock()
+	data, ok := m.blobs[key]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return data, nil
+}
+
+// DeleteBlob remove the blob by key.
+func (m *MemStoreDriver) DeleteBlob(key string) error {
+	defer m.blobLocker.Unlock()
+	m.blobLocker.Lock()
+	delete(m.blobs, key)
+	return nil
+}
+
 // Get a job with job id.
 func (m *MemStoreDriver) Get(jobID int64) (job Job, err error) {
 	j, ok := m.data[jobID]
@@ -71,9 +197,9 @@ func (m *MemStoreDriver) Get(jobID int64) (job Job, err error) {
 	return
 }
 
-// GetOne get a job with func and name.
-func (m *MemStoreDriver) GetOne(Func, name string) (job Job, err error) {
-	jobID, ok := m.nameIndex[Func+":"+name]
+// GetOne get a job with namespace, func and name.
+func (m *MemStoreDriver) GetOne(ns, Func, name string) (job Job, err error) {
+	jobID, ok := m.nameIndex[nsKey(ns, Func)+":"+name]
 	if !ok {
 		err = fmt.Errorf("Job %s:%s not exists.", Func, name)
 		return
@@ -82,16 +208,118 @@ func (m *MemStoreDriver) GetOne(Func, name string) (job Job, err error) {
 	return
 }
 
-// NewIterator create a job Iterator with func or nil.
-func (m *MemStoreDriver) NewIterator(Func []byte) Iterator {
+// AddHistory append an execution record, and keep at most jobLimit
+// records of the job and funcLimit records of the func.
+func (m *MemStoreDriver) AddHistory(record History, jobLimit, funcLimit int) error {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	m.history[record.JobID] = appendHistory(m.history[record.JobID], record, jobLimit)
+	key := nsKey(record.Namespace, record.Func)
+	m.funcHist[key] = appendHistory(m.funcHist[key], record, funcLimit)
+	return nil
+}
+
+func appendHistory(records []History, record History, limit int) []History {
+	records = append(records, record)
+	if limit > 0 && len(records) > limit {
+		records = append([]History(nil), records[len(records)-limit:]...)
+	}
+	return records
+}
+
+// GetHistory get at most limit execution records of a job, newest first.
+func (m *MemStoreDriver) GetHistory(jobID int64, limit int) ([]History, error) {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	return newestHistory(m.history[jobID], limit), nil
+}
+
+// GetFuncHistory get at most limit execution records of a func, newest first.
+func (m *MemStoreDriver) GetFuncHistory(ns, Func string, limit int) ([]History, error) {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	return newestHistory(m.funcHist[nsKey(ns, Func)], limit), nil
+}
+
+func newestHistory(records []History, limit int) []History {
+	var newest = make([]History, 0)
+	for i := len(records) - 1; i >= 0; i-- {
+		if limit > 0 && len(newest) >= limit {
+			break
+		}
+		newest = append(newest, records[i])
+	}
+	return newest
+}
+
+// SaveWebhook save the webhook of a func.
+func (m *MemStoreDriver) SaveWebhook(hook Webhook) error {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	m.webhooks[nsKey(hook.Namespace, hook.Func)] = hook
+	return nil
+}
+
+// GetWebhook get the webhook of a func.
+func (m *MemStoreDriver) GetWebhook(ns, Func string) (hook Webhook, err error) {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	hook, ok := m.webhooks[nsKey(ns, Func)]
+	if !ok {
+		err = fmt.Errorf("Webhook %s not exists.", Func)
+	}
+	return
+}
+
+// DeleteWebhook delete the webhook of a func.
+func (m *MemStoreDriver) DeleteWebhook(ns, Func string) error {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	delete(m.webhooks, nsKey(ns, Func))
+	return nil
+}
+
+// AddDelivery append a webhook delivery, and keep at most limit deliveries of the func.
+func (m *MemStoreDriver) AddDelivery(d Delivery, limit int) error {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	key := nsKey(d.Namespace, d.Func)
+	deliveries := append(m.delivery[key], d)
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = append([]Delivery(nil), deliveries[len(deliveries)-limit:]...)
+	}
+	m.delivery[key] = deliveries
+	return nil
+}
+
+// GetDeliveries get at most limit webhook deliveries of a func, newest first.
+func (m *MemStoreDriver) GetDeliveries(ns, Func string, limit int) ([]Delivery, error) {
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	var deliveries = m.delivery[nsKey(ns, Func)]
+	var newest = make([]Delivery, 0)
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		if limit > 0 && len(newest) >= limit {
+			break
+		}
+		newest = append(newest, deliveries[i])
+	}
+	return newest, nil
+}
+
+// NewIterator create a job Iterator with namespace and func or nil, an empty
+// namespace iterate the jobs of all the namespaces.
+func (m *MemStoreDriver) NewIterator(ns string, Func []byte) Iterator {
 	m.locker.Lock()
 	var data = make([]int64, 0)
 	if Func == nil {
-		for jobID := range m.data {
-			data = append(data, jobID)
+		for jobID, job := range m.data {
+			if ns == "" || job.Namespace == ns {
+				data = append(data, jobID)
+			}
 		}
 	} else {
-		prefix := string(Func)
+		prefix := nsKey(ns, string(Func))
 		for key, jobID := range m.nameIndex {
 			if strings.HasPrefix(key, prefix) {
 				data = append(data, jobID)
@@ -105,11 +333,31 @@ func (m *MemStoreDriver) NewIterator(Func []byte) Iterator {
 	}
 }
 
+// NewIteratorAfter create a job Iterator like NewIterator, the jobs after the
+// cursor are iterated in the job id order.
+func (m *MemStoreDriver) NewIteratorAfter(ns string, Func []byte, cursor int64) Iterator {
+	iter := m.NewIterator(ns, Func).(*MemIterator)
+	var data = make([]int64, 0, len(iter.data))
+	for _, jobID := range iter.data {
+		if jobID > cursor {
+			data = append(data, jobID)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i] < data[j] })
+	iter.data = data
+	return iter
+}
+
 // Close the driver
 func (m *MemStoreDriver) Close() error {
 	return nil
 }
 
+// nsKey the key of the func in the namespace
+func nsKey(ns, Func string) string {
+	return ns + ":" + Func
+}
+
 // MemIterator define a memory store driver iterator
 type MemIterator struct {
 	data   []int64
@@ -0,0 +1,51 @@
+package driver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemStoreHistory(t *testing.T) {
+	var store = NewMemStroeDriver()
+	var ids []int64
+	for _, name := range []string{"a", "b", "c"} {
+		var job = Job{Namespace: DefaultNamespace, Func: "f", Name: name}
+		if err := store.Save(&job); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			store.AddHistory(History{JobID: job.ID, Namespace: job.Namespace, Func: job.Func, Name: job.Name}, 10, 10)
+		}
+		ids = append(ids, job.ID)
+	}
+
+	if err := store.Delete(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := store.GetHistory(ids[0], 0); len(records) != 0 {
+		t.Fatalf("Delete: except the history deleted, got: %d records", len(records))
+	}
+	if errs := store.DeleteBatch(ids[1:2]); errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	if records, _ := store.GetHistory(ids[1], 0); len(records) != 0 {
+		t.Fatalf("DeleteBatch: except the history deleted, got: %d records", len(records))
+	}
+	// the func history is kept to its limit
+	if records, _ := store.GetFuncHistory(DefaultNamespace, "f", 0); len(records) != 6 {
+		t.Fatalf("GetFuncHistory: except: 6, got: %d", len(records))
+	}
+
+	if err := store.Archive(ids[2], "dead_lettered"); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := store.GetHistory(ids[2], 0); len(records) != 2 {
+		t.Fatalf("Archive: except the history kept, got: %d records", len(records))
+	}
+	if _, err := store.PurgeArchived(time.Now().Unix() + 1); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := store.GetHistory(ids[2], 0); len(records) != 0 {
+		t.Fatalf("PurgeArchived: except the history deleted, got: %d records", len(records))
+	}
+}
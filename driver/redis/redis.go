@@ -1,9 +1,9 @@
 package redis
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"sync"
@@ -11,11 +11,47 @@ import (
 	"github.com/garyburd/redigo/redis"
 	"github.com/golang/groupcache/lru"
 	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/logger"
 )
 
-// PREFIX the redis key prefix
+var driverLog = logger.New("driver")
+
+// PREFIX the redis key prefix of the job sequence, the job ids and the job
+// namespaces
 const PREFIX = "periodic:job:"
 
+// PRENAMESPACE the redis key prefix of the namespaced keys, eg:
+// periodic:ns:[namespace]:job:[job_id]
+const PRENAMESPACE = "periodic:ns:"
+
+// PREARCHIVE the redis archived job key prefix
+const PREARCHIVE = "periodic:archive:"
+
+// ARCHIVEAT the redis sorted set of the archived job ids by the archive time
+const ARCHIVEAT = "periodic:archive_at"
+
+// PREHISTORY the redis execution record key prefix of the jobs, the records
+// of the funcs are under periodic:ns:[namespace]:history:func:
+const PREHISTORY = "periodic:history:"
+
+// WEBHOOKS the redis func webhooks hash key before the namespaces, it is
+// periodic:ns:[namespace]:webhook now
+const WEBHOOKS = "periodic:webhook"
+
+// PREDELIVERY the redis webhook delivery key prefix before the namespaces,
+// it is periodic:ns:[namespace]:delivery: now
+const PREDELIVERY = "periodic:delivery:"
+
+// PREBLOB the redis blob key prefix of the offloaded args
+const PREBLOB = "periodic:blob:"
+
+// SCHEMA the redis schema version key
+const SCHEMA = "periodic:schema"
+
+// schemaVersion the namespaces are in the keys since the schema version 2,
+// the history of the removed jobs is deleted since the schema version 3
+const schemaVersion = "3"
+
 // Driver define a redis store driver
 type Driver struct {
 	pool     *redis.Pool
@@ -34,22 +70,158 @@ func NewDriver(server string) Driver {
 	cache = lru.New(1000)
 	var RWLocker = new(sync.Mutex)
 
-	return Driver{pool: pool, cache: cache, RWLocker: RWLocker}
+	r := Driver{pool: pool, cache: cache, RWLocker: RWLocker}
+	migrated, err := r.migrate()
+	if err != nil {
+		driverLog.Fatal("Migrate redis failed", "server", server, "err", err)
+	}
+	if migrated > 0 {
+		driverLog.Info("Migrated the jobs to the default namespace", "server", server, "jobs", migrated)
+	}
+	return r
+}
+
+// nsPrefix the key prefix of the namespace
+func nsPrefix(ns string) string {
+	return PRENAMESPACE + ns + ":"
+}
+
+func jobKey(ns string, jobID int64) string {
+	return nsPrefix(ns) + "job:" + strconv.FormatInt(jobID, 10)
+}
+
+// migrate upgrade the data stored by the older schema versions step by step.
+func (r Driver) migrate() (migrated int, err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	version, _ := redis.String(conn.Do("GET", SCHEMA))
+	if version == schemaVersion {
+		return
+	}
+	if version < "2" {
+		if migrated, err = r.migrateNamespaces(conn); err != nil {
+			return
+		}
+	}
+	if version < "3" {
+		err = r.purgeHistory(conn)
+	}
+	return
+}
+
+// migrateNamespaces move the data stored before the namespaces into the
+// default namespace. A migrated key is renamed, so an interrupted migration
+// can be run again.
+func (r Driver) migrateNamespaces(conn redis.Conn) (migrated int, err error) {
+	var ns = driver.DefaultNamespace
+	var prefix = nsPrefix(ns)
+	var ids []string
+	if ids, err = redis.Strings(conn.Do("ZRANGE", PREFIX+"ID", 0, -1)); err != nil {
+		return
+	}
+	var nameKeys = make(map[string]bool)
+	for _, strID := range ids {
+		data, e := redis.Bytes(conn.Do("GET", PREFIX+strID))
+		if e != nil {
+			continue
+		}
+		job, e := driver.DecodeJob(data)
+		if e != nil {
+			driverLog.Warn("Skip the invalid job", "key", PREFIX+strID, "err", e)
+			continue
+		}
+		job.Namespace = ns
+		conn.Send("MULTI")
+		conn.Send("SET", jobKey(ns, job.ID), job.StoreBytes())
+		conn.Send("HSET", PREFIX+"namespace", strID, ns)
+		conn.Send("ZADD", prefix+"job:ID", job.ID, strID)
+		conn.Send("ZADD", prefix+"job:"+job.Func+":name", job.ID, job.Name)
+		conn.Send("DEL", PREFIX+strID)
+		if _, err = conn.Do("EXEC"); err != nil {
+			return
+		}
+		nameKeys[PREFIX+job.Func+":name"] = true
+		migrated++
+	}
+	for key := range nameKeys {
+		conn.Do("DEL", key)
+	}
+	var renames = map[string]string{WEBHOOKS: prefix + "webhook"}
+	for _, pattern := range []string{PREHISTORY + "func:*", PREDELIVERY + "*"} {
+		var keys []string
+		if keys, err = redis.Strings(conn.Do("KEYS", pattern)); err != nil {
+			return
+		}
+		for _, key := range keys {
+			renames[key] = prefix + key[len("periodic:"):]
+		}
+	}
+	for from, to := range renames {
+		if _, e := conn.Do("RENAME", from, to); e != nil && e.Error() != "ERR no such key" {
+			err = e
+			return
+		}
+	}
+	_, err = conn.Do("SET", SCHEMA, "2")
+	return
+}
+
+// purgeHistory delete the history left by the jobs removed before the schema
+// version 3, the history of the jobs and the archived jobs is kept.
+func (r Driver) purgeHistory(conn redis.Conn) (err error) {
+	var keys []string
+	if keys, err = redis.Strings(conn.Do("KEYS", PREHISTORY+"job:*")); err != nil {
+		return
+	}
+	for _, key := range keys {
+		strID := key[len(PREHISTORY+"job:"):]
+		conn.Send("HEXISTS", PREFIX+"namespace", strID)
+		conn.Send("EXISTS", PREARCHIVE+strID)
+	}
+	if err = conn.Flush(); err != nil {
+		return
+	}
+	var removed []interface{}
+	for _, key := range keys {
+		job, _ := redis.Int(conn.Receive())
+		archived, _ := redis.Int(conn.Receive())
+		if job == 0 && archived == 0 {
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) > 0 {
+		if _, err = conn.Do("DEL", removed...); err != nil {
+			return
+		}
+	}
+	_, err = conn.Do("SET", SCHEMA, schemaVersion)
+	return
+}
+
+// jobHistoryKey the key of the execution records of a job
+func jobHistoryKey(jobID int64) string {
+	return PREHISTORY + "job:" + strconv.FormatInt(jobID, 10)
 }
 
 func (r Driver) get(jobID int64) (job driver.Job, err error) {
 	var data []byte
 	var conn = r.pool.Get()
 	defer conn.Close()
-	var key = PREFIX + strconv.FormatInt(jobID, 10)
+	var strID = strconv.FormatInt(jobID, 10)
+	var key = PREFIX + strID
 	if val, hit := r.cache.Get(key); hit {
 		return val.(driver.Job), nil
 	}
-	data, err = redis.Bytes(conn.Do("GET", key))
+	var ns string
+	ns, err = redis.String(conn.Do("HGET", PREFIX+"namespace", strID))
 	if err != nil {
 		return
 	}
-	job, err = driver.NewJob(data)
+	data, err = redis.Bytes(conn.Do("GET", jobKey(ns, jobID)))
+	if err != nil {
+		return
+	}
+	job, err = driver.DecodeJob(data)
 	if err == nil {
 		r.cache.Add(key, job)
 	}
@@ -60,65 +232,339 @@ func (r Driver) get(jobID int64) (job driver.Job, err error) {
 func (r Driver) Save(job *driver.Job, force ...bool) (err error) {
 	defer r.RWLocker.Unlock()
 	r.RWLocker.Lock()
-	var key string
-	var prefix = PREFIX + job.Func + ":"
 	var conn = r.pool.Get()
 	defer conn.Close()
-	if job.ID > 0 && (len(force) == 0 || !force[0]) {
-		old, e := r.get(job.ID)
-		key = PREFIX + strconv.FormatInt(job.ID, 10)
-		if e != nil || old.ID < 1 {
-			err = fmt.Errorf("Update Job %d fail, the old job is not exists.", job.ID)
-			return
+	return r.saveBatch(conn, []*driver.Job{job}, len(force) > 0 && force[0])[0]
+}
+
+// SaveBatch save a batch of jobs at once, returns the error of each job.
+func (r Driver) SaveBatch(jobs []*driver.Job) []error {
+	defer r.RWLocker.Unlock()
+	r.RWLocker.Lock()
+	var conn = r.pool.Get()
+	defer conn.Close()
+	return r.saveBatch(conn, jobs, false)
+}
+
+// getBatch get the jobs with job ids, the jobs not cached are read in a
+// pipeline.
+func (r Driver) getBatch(conn redis.Conn, jobIDs []int64) ([]driver.Job, []error) {
+	var jobs = make([]driver.Job, len(jobIDs))
+	var errs = make([]error, len(jobIDs))
+	var missed []int
+	for i, jobID := range jobIDs {
+		if val, hit := r.cache.Get(PREFIX + strconv.FormatInt(jobID, 10)); hit {
+			jobs[i] = val.(driver.Job)
+			continue
 		}
-		r.cache.Remove(key)
-		if old.Name != job.Name {
-			if _, e := conn.Do("ZERM", prefix+"name", old.Name); e != nil {
-				log.Printf("Error: ZREM %s %s failed\n", prefix+"name", old.Name)
-			}
+		missed = append(missed, i)
+	}
+	if len(missed) == 0 {
+		return jobs, errs
+	}
+	for _, i := range missed {
+		conn.Send("HGET", PREFIX+"namespace", strconv.FormatInt(jobIDs[i], 10))
+	}
+	var nss = make([]string, len(jobIDs))
+	var found []int
+	if err := conn.Flush(); err != nil {
+		for _, i := range missed {
+			errs[i] = err
+		}
+		return jobs, errs
+	}
+	for _, i := range missed {
+		if nss[i], errs[i] = redis.String(conn.Receive()); errs[i] == nil {
+			found = append(found, i)
+		}
+	}
+	if len(found) == 0 {
+		return jobs, errs
+	}
+	for _, i := range found {
+		conn.Send("GET", jobKey(nss[i], jobIDs[i]))
+	}
+	if err := conn.Flush(); err != nil {
+		for _, i := range found {
+			errs[i] = err
+		}
+		return jobs, errs
+	}
+	for _, i := range found {
+		var data []byte
+		if data, errs[i] = redis.Bytes(conn.Receive()); errs[i] != nil {
+			continue
+		}
+		if jobs[i], errs[i] = driver.DecodeJob(data); errs[i] == nil {
+			r.cache.Add(PREFIX+strconv.FormatInt(jobIDs[i], 10), jobs[i])
+		}
+	}
+	return jobs, errs
+}
+
+// execErrors run the MULTI/EXEC transaction sent, the jobs get the errors of
+// their commands, ends[i] is the count of the commands sent until the job i.
+func execErrors(conn redis.Conn, ends []int, errs []error) {
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err == nil && len(ends) > 0 && len(replies) != ends[len(ends)-1] {
+		err = errors.New("Unexpected EXEC replies")
+	}
+	for i, end := range ends {
+		if errs[i] != nil {
+			continue
 		}
-	} else {
-		job.ID, err = redis.Int64(conn.Do("INCRBY", PREFIX+"sequence", 1))
 		if err != nil {
-			return
+			errs[i] = err
+			continue
+		}
+		start := 0
+		if i > 0 {
+			start = ends[i-1]
+		}
+		for _, reply := range replies[start:end] {
+			if e, ok := reply.(redis.Error); ok {
+				errs[i] = e
+				break
+			}
 		}
 	}
-	idx, _ := redis.Int64(conn.Do("ZSCORE", prefix+"name", job.Name))
-	if idx > 0 && idx != job.ID {
-		err = errors.New("Duplicate Job name: " + job.Name)
-		return
+}
+
+// saveBatch save the jobs in a MULTI/EXEC transaction, the old jobs, the new
+// job ids and the duplicate names are read before in a few round trips.
+func (r Driver) saveBatch(conn redis.Conn, jobs []*driver.Job, force bool) []error {
+	var errs = make([]error, len(jobs))
+	var olds = make([]driver.Job, len(jobs))
+	var updates []int64
+	var created int64
+	for _, job := range jobs {
+		if job.ID > 0 && !force {
+			updates = append(updates, job.ID)
+		} else {
+			created++
+		}
 	}
-	key = PREFIX + strconv.FormatInt(job.ID, 10)
-	_, err = conn.Do("SET", key, job.Bytes())
-	if err == nil {
-		if _, e := conn.Do("ZADD", prefix+"name", job.ID, job.Name); e != nil {
-			log.Printf("Error: ZADD %s %d %s fail\n", prefix+"name", job.ID, job.Name)
+	if len(updates) > 0 {
+		oldJobs, oldErrs := r.getBatch(conn, updates)
+		k := 0
+		for i, job := range jobs {
+			if job.ID > 0 && !force {
+				olds[i] = oldJobs[k]
+				if oldErrs[k] != nil || olds[i].ID < 1 {
+					errs[i] = fmt.Errorf("Update Job %d fail, the old job is not exists.", job.ID)
+				}
+				k++
+			}
 		}
-		if _, e := conn.Do("ZADD", PREFIX+"ID", job.ID, strconv.FormatInt(job.ID, 10)); e != nil {
-			log.Printf("Error: ZADD %s %d %d fail\n", PREFIX+"ID", job.ID, job.ID)
+	}
+	if created > 0 {
+		last, err := redis.Int64(conn.Do("INCRBY", PREFIX+"sequence", created))
+		next := last - created + 1
+		for i, job := range jobs {
+			if job.ID > 0 && !force {
+				continue
+			}
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			job.ID = next
+			next++
 		}
 	}
-	return
+
+	// the duplicate names in the store and in the batch
+	for _, job := range jobs {
+		conn.Send("ZSCORE", nsPrefix(job.Namespace)+"job:"+job.Func+":name", job.Name)
+	}
+	if err := conn.Flush(); err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+	var names = make(map[string]int64)
+	for i, job := range jobs {
+		idx, _ := redis.Int64(conn.Receive())
+		if errs[i] != nil {
+			continue
+		}
+		var nameKey = nsPrefix(job.Namespace) + "job:" + job.Func + ":name:" + job.Name
+		if id, ok := names[nameKey]; ok {
+			idx = id
+		}
+		if idx > 0 && idx != job.ID {
+			errs[i] = errors.New("Duplicate Job name: " + job.Name)
+			continue
+		}
+		names[nameKey] = job.ID
+	}
+
+	var ends = make([]int, len(jobs))
+	var sent = 0
+	conn.Send("MULTI")
+	for i, job := range jobs {
+		if errs[i] == nil {
+			var prefix = nsPrefix(job.Namespace) + "job:" + job.Func + ":"
+			var strID = strconv.FormatInt(job.ID, 10)
+			if olds[i].ID > 0 {
+				r.cache.Remove(PREFIX + strID)
+				if olds[i].Name != job.Name {
+					conn.Send("ZREM", prefix+"name", olds[i].Name)
+					sent++
+				}
+			}
+			conn.Send("HSET", PREFIX+"namespace", strID, job.Namespace)
+			conn.Send("SET", jobKey(job.Namespace, job.ID), job.StoreBytes())
+			conn.Send("ZADD", prefix+"name", job.ID, job.Name)
+			conn.Send("ZADD", PREFIX+"ID", job.ID, strID)
+			conn.Send("ZADD", nsPrefix(job.Namespace)+"job:ID", job.ID, strID)
+			sent = sent + 5
+		}
+		ends[i] = sent
+	}
+	execErrors(conn, ends, errs)
+	return errs
 }
 
-// Delete a job with job id.
+// Delete a job with job id and its execution records.
 func (r Driver) Delete(jobID int64) (err error) {
 	defer r.RWLocker.Unlock()
 	r.RWLocker.Lock()
-	var key = PREFIX + strconv.FormatInt(jobID, 10)
-	job, e := r.get(jobID)
-	if e != nil {
-		return e
+	var conn = r.pool.Get()
+	defer conn.Close()
+	return r.deleteBatch(conn, []int64{jobID}, true)[0]
+}
+
+// DeleteBatch delete a batch of jobs at once, returns the error of each job.
+func (r Driver) DeleteBatch(jobIDs []int64) []error {
+	defer r.RWLocker.Unlock()
+	r.RWLocker.Lock()
+	var conn = r.pool.Get()
+	defer conn.Close()
+	return r.deleteBatch(conn, jobIDs, true)
+}
+
+// deleteBatch delete the jobs in a MULTI/EXEC transaction, and their
+// execution records when history is true.
+func (r Driver) deleteBatch(conn redis.Conn, jobIDs []int64, history bool) []error {
+	jobs, errs := r.getBatch(conn, jobIDs)
+	var ends = make([]int, len(jobIDs))
+	var sent = 0
+	conn.Send("MULTI")
+	for i, job := range jobs {
+		if errs[i] == nil {
+			var strID = strconv.FormatInt(job.ID, 10)
+			var prefix = nsPrefix(job.Namespace) + "job:"
+			conn.Send("DEL", jobKey(job.Namespace, job.ID))
+			conn.Send("ZREM", prefix+job.Func+":name", job.Name)
+			conn.Send("ZREM", prefix+"ID", strID)
+			conn.Send("ZREM", PREFIX+"ID", strID)
+			conn.Send("HDEL", PREFIX+"namespace", strID)
+			r.cache.Remove(PREFIX + strID)
+			sent = sent + 5
+			if history {
+				conn.Send("DEL", jobHistoryKey(job.ID))
+				sent++
+			}
+		}
+		ends[i] = sent
 	}
-	var prefix = PREFIX + job.Func + ":"
+	execErrors(conn, ends, errs)
+	return errs
+}
 
+// Archive move a job out of the jobs into the archive with a reason.
+func (r Driver) Archive(jobID int64, reason string) (err error) {
+	defer r.RWLocker.Unlock()
+	r.RWLocker.Lock()
+	var job driver.Job
+	job, err = r.get(jobID)
+	if err != nil {
+		return
+	}
 	var conn = r.pool.Get()
 	defer conn.Close()
+	archived := driver.NewArchivedJob(job, reason)
+	var strID = strconv.FormatInt(job.ID, 10)
+	if _, err = conn.Do("SET", PREARCHIVE+strID, archived.Bytes()); err != nil {
+		return
+	}
+	if _, err = conn.Do("ZADD", ARCHIVEAT, archived.ArchivedAt, strID); err != nil {
+		return
+	}
+	// the history is kept with the archived job until it is purged
+	return r.deleteBatch(conn, []int64{jobID}, false)[0]
+}
 
-	_, err = conn.Do("DEL", key)
-	conn.Do("ZREM", prefix+"name", job.Name)
-	conn.Do("ZREM", PREFIX+"ID", strconv.FormatInt(job.ID, 10))
-	r.cache.Remove(key)
+// PurgeArchived remove the jobs archived before the time and their execution
+// records, it returns the removed jobs.
+func (r Driver) PurgeArchived(before int64) (jobs []driver.ArchivedJob, err error) {
+	defer r.RWLocker.Unlock()
+	r.RWLocker.Lock()
+	var conn = r.pool.Get()
+	defer conn.Close()
+	var strIDs []string
+	strIDs, err = redis.Strings(conn.Do("ZRANGEBYSCORE", ARCHIVEAT, "-inf", "("+strconv.FormatInt(before, 10)))
+	if err != nil {
+		return
+	}
+	for _, strID := range strIDs {
+		data, _ := redis.Bytes(conn.Do("GET", PREARCHIVE+strID))
+		conn.Send("MULTI")
+		conn.Send("DEL", PREARCHIVE+strID)
+		conn.Send("ZREM", ARCHIVEAT, strID)
+		conn.Send("DEL", PREHISTORY+"job:"+strID)
+		if _, err = conn.Do("EXEC"); err != nil {
+			return
+		}
+		var job driver.ArchivedJob
+		if json.Unmarshal(data, &job) == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return
+}
+
+// GetArchived get an archived job with job id.
+func (r Driver) GetArchived(jobID int64) (job driver.ArchivedJob, err error) {
+	var data []byte
+	var conn = r.pool.Get()
+	defer conn.Close()
+	data, err = redis.Bytes(conn.Do("GET", PREARCHIVE+strconv.FormatInt(jobID, 10)))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &job)
+	return
+}
+
+// PutBlob save the blob by key.
+func (r Driver) PutBlob(key string, data []byte) (err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("SET", PREBLOB+key, data)
+	return
+}
+
+// GetBlob get the blob by key.
+func (r Driver) GetBlob(key string) (data []byte, err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	data, err = redis.Bytes(conn.Do("GET", PREBLOB+key))
+	if err == redis.ErrNil {
+		err = driver.ErrBlobNotFound
+	}
+	return
+}
+
+// DeleteBlob remove the blob by key.
+func (r Driver) DeleteBlob(key string) (err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("DEL", PREBLOB+key)
 	return
 }
 
@@ -130,27 +576,147 @@ func (r Driver) Get(jobID int64) (job driver.Job, err error) {
 	return
 }
 
-// GetOne get a job with func and name.
-func (r Driver) GetOne(Func string, jobName string) (job driver.Job, err error) {
+// GetOne get a job with namespace, func and name.
+func (r Driver) GetOne(ns, Func string, jobName string) (job driver.Job, err error) {
 	defer r.RWLocker.Unlock()
 	r.RWLocker.Lock()
 	var conn = r.pool.Get()
 	defer conn.Close()
-	jobID, _ := redis.Int64(conn.Do("ZSCORE", PREFIX+Func+":name", jobName))
+	jobID, _ := redis.Int64(conn.Do("ZSCORE", nsPrefix(ns)+"job:"+Func+":name", jobName))
 	if jobID > 0 {
 		return r.get(jobID)
 	}
 	return
 }
 
-// NewIterator create a job Iterator with func or nil.
-func (r Driver) NewIterator(Func []byte) driver.Iterator {
+// AddHistory append an execution record, and keep at most jobLimit
+// records of the job and funcLimit records of the func.
+func (r Driver) AddHistory(record driver.History, jobLimit, funcLimit int) (err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	var jobKey = jobHistoryKey(record.JobID)
+	var funcKey = nsPrefix(record.Namespace) + "history:func:" + record.Func
+	var data = record.Bytes()
+	conn.Send("MULTI")
+	conn.Send("LPUSH", jobKey, data)
+	conn.Send("LPUSH", funcKey, data)
+	if jobLimit > 0 {
+		conn.Send("LTRIM", jobKey, 0, jobLimit-1)
+	}
+	if funcLimit > 0 {
+		conn.Send("LTRIM", funcKey, 0, funcLimit-1)
+	}
+	_, err = conn.Do("EXEC")
+	return
+}
+
+// GetHistory get at most limit execution records of a job, newest first.
+func (r Driver) GetHistory(jobID int64, limit int) ([]driver.History, error) {
+	return r.getHistory(jobHistoryKey(jobID), limit)
+}
+
+// GetFuncHistory get at most limit execution records of a func, newest first.
+func (r Driver) GetFuncHistory(ns, Func string, limit int) ([]driver.History, error) {
+	return r.getHistory(nsPrefix(ns)+"history:func:"+Func, limit)
+}
+
+func (r Driver) getHistory(key string, limit int) (records []driver.History, err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	var reply [][]byte
+	reply, err = redis.ByteSlices(conn.Do("LRANGE", key, 0, limit-1))
+	if err != nil {
+		return
+	}
+	records = make([]driver.History, 0, len(reply))
+	for _, data := range reply {
+		record, e := driver.NewHistory(data)
+		if e != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+// SaveWebhook save the webhook of a func.
+func (r Driver) SaveWebhook(hook driver.Webhook) (err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("HSET", nsPrefix(hook.Namespace)+"webhook", hook.Func, hook.Bytes())
+	return
+}
+
+// GetWebhook get the webhook of a func.
+func (r Driver) GetWebhook(ns, Func string) (hook driver.Webhook, err error) {
+	var data []byte
+	var conn = r.pool.Get()
+	defer conn.Close()
+	data, err = redis.Bytes(conn.Do("HGET", nsPrefix(ns)+"webhook", Func))
+	if err != nil {
+		return
+	}
+	return driver.NewWebhook(data)
+}
+
+// DeleteWebhook delete the webhook of a func.
+func (r Driver) DeleteWebhook(ns, Func string) (err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("HDEL", nsPrefix(ns)+"webhook", Func)
+	return
+}
+
+// AddDelivery append a webhook delivery, and keep at most limit deliveries of the func.
+func (r Driver) AddDelivery(d driver.Delivery, limit int) (err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	var key = nsPrefix(d.Namespace) + "delivery:" + d.Func
+	conn.Send("MULTI")
+	conn.Send("LPUSH", key, d.Bytes())
+	if limit > 0 {
+		conn.Send("LTRIM", key, 0, limit-1)
+	}
+	_, err = conn.Do("EXEC")
+	return
+}
+
+// GetDeliveries get at most limit webhook deliveries of a func, newest first.
+func (r Driver) GetDeliveries(ns, Func string, limit int) (deliveries []driver.Delivery, err error) {
+	var conn = r.pool.Get()
+	defer conn.Close()
+	var reply [][]byte
+	reply, err = redis.ByteSlices(conn.Do("LRANGE", nsPrefix(ns)+"delivery:"+Func, 0, limit-1))
+	if err != nil {
+		return
+	}
+	deliveries = make([]driver.Delivery, 0, len(reply))
+	for _, data := range reply {
+		d, e := driver.NewDelivery(data)
+		if e != nil {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	return
+}
+
+// NewIterator create a job Iterator with namespace and func or nil, an empty
+// namespace iterate the jobs of all the namespaces.
+func (r Driver) NewIterator(ns string, Func []byte) driver.Iterator {
+	return r.NewIteratorAfter(ns, Func, 0)
+}
+
+// NewIteratorAfter create a job Iterator like NewIterator, the jobs after the
+// cursor are iterated in the job id order.
+func (r Driver) NewIteratorAfter(ns string, Func []byte, cursor int64) driver.Iterator {
 	r.RWLocker.Lock()
 	return &Iterator{
+		ns:       ns,
 		Func:     Func,
 		cursor:   0,
 		cacheJob: make([]driver.Job, 0),
-		start:    0,
+		after:    cursor,
 		limit:    20,
 		err:      nil,
 		r:        r,
@@ -164,11 +730,12 @@ func (r Driver) Close() error {
 
 // Iterator define the job iterator
 type Iterator struct {
+	ns       string
 	Func     []byte
 	cursor   int
 	err      error
 	cacheJob []driver.Job
-	start    int
+	after    int64
 	limit    int
 	r        Driver
 }
@@ -180,22 +747,25 @@ func (iter *Iterator) Next() bool {
 	if len(iter.cacheJob) > 0 && len(iter.cacheJob) > iter.cursor {
 		return true
 	}
-	start := iter.start
-	stop := iter.start + iter.limit - 1
-	iter.start = iter.start + iter.limit
-	var err error
-
 	var conn = iter.r.pool.Get()
 	defer conn.Close()
 	var key string
-	if iter.Func == nil {
-		key = PREFIX + "ID"
+	if iter.Func != nil {
+		key = nsPrefix(iter.ns) + "job:" + string(iter.Func) + ":name"
+	} else if iter.ns != "" {
+		key = nsPrefix(iter.ns) + "job:ID"
 	} else {
-		key = PREFIX + string(iter.Func) + ":name"
+		key = PREFIX + "ID"
 	}
 
-	reply, err := redis.Values(conn.Do("ZRANGE", key, start, stop, "WITHSCORES"))
-	if err != nil || len(reply) == 0 {
+	// the job ids are the scores, fetch the jobs after the last one
+	min := "(" + strconv.FormatInt(iter.after, 10)
+	reply, err := redis.Values(conn.Do("ZRANGEBYSCORE", key, min, "+inf", "WITHSCORES", "LIMIT", 0, iter.limit))
+	if err != nil {
+		iter.err = err
+		return false
+	}
+	if len(reply) == 0 {
 		return false
 	}
 	var jobID int64
@@ -203,7 +773,13 @@ func (iter *Iterator) Next() bool {
 	for k, v := range reply {
 		if k%2 == 1 {
 			jobID, _ = strconv.ParseInt(string(v.([]byte)), 10, 0)
-			jobs[(k-1)/2], _ = iter.r.get(jobID)
+			jobs[(k-1)/2], err = iter.r.get(jobID)
+			// the job removed after the range is skipped, the other errors
+			// are kept for Error and the jobs left are still iterated.
+			if err != nil && err != redis.ErrNil && iter.err == nil {
+				iter.err = err
+			}
+			iter.after = jobID
 		}
 	}
 	iter.cacheJob = jobs
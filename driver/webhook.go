@@ -0,0 +1,67 @@
+package driver
+
+import (
+	"encoding/json"
+)
+
+// Webhook defined a func webhook
+type Webhook struct {
+	Func   string   `json:"func"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"` // The HMAC secret, use the default secret when empty
+	Events []string `json:"events,omitempty"` // The notify events, empty for all
+
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NewWebhook create a webhook from json bytes
+func NewWebhook(payload []byte) (hook Webhook, err error) {
+	err = json.Unmarshal(payload, &hook)
+	return
+}
+
+// Bytes encode webhook to json bytes
+func (hook Webhook) Bytes() (data []byte) {
+	data, _ = json.Marshal(hook)
+	return
+}
+
+// Delivery defined a webhook delivery attempt
+type Delivery struct {
+	ID         string `json:"id"`
+	Namespace  string `json:"namespace,omitempty"`
+	Func       string `json:"func"`
+	JobID      int64  `json:"job_id"`
+	Event      string `json:"event"`
+	URL        string `json:"url"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Success    bool   `json:"success"`
+	At         int64  `json:"at"`
+}
+
+// NewDelivery create a delivery from json bytes
+func NewDelivery(payload []byte) (d Delivery, err error) {
+	err = json.Unmarshal(payload, &d)
+	return
+}
+
+// Bytes encode delivery to json bytes
+func (d Delivery) Bytes() (data []byte) {
+	data, _ = json.Marshal(d)
+	return
+}
+
+// Wants check the webhook notify the event or not
+func (hook Webhook) Wants(event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
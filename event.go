@@ -0,0 +1,206 @@
+package periodic
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jmuyuyang/periodic/driver"
+)
+
+// EventType defined the scheduler event type
+type EventType string
+
+const (
+	// EventSubmitted the job is submitted
+	EventSubmitted EventType = "submitted"
+	// EventAssigned the job is assigned to a worker
+	EventAssigned EventType = "assigned"
+	// EventDone the worker tell the job is done
+	EventDone EventType = "done"
+	// EventFailed the worker tell the job is fail
+	EventFailed EventType = "failed"
+	// EventTimeout the job is not finished in the timeout
+	EventTimeout EventType = "timeout"
+	// EventRescheduled the worker tell sched the job later
+	EventRescheduled EventType = "rescheduled"
+	// EventRemoved the job is removed
+	EventRemoved EventType = "removed"
+	// EventPaused the job is paused
+	EventPaused EventType = "paused"
+	// EventResumed the paused job is resumed
+	EventResumed EventType = "resumed"
+	// EventExpired the job is expired by the retention and archived
+	EventExpired EventType = "expired"
+	// EventDeadLettered the job is failed permanently and archived
+	EventDeadLettered EventType = "dead_lettered"
+	// EventWorkerConnected a worker is connected
+	EventWorkerConnected EventType = "worker_connected"
+	// EventWorkerDisconnected a worker is disconnected
+	EventWorkerDisconnected EventType = "worker_disconnected"
+)
+
+// Event defined a scheduler event
+type Event struct {
+	Type   EventType `json:"type"`
+	JobID  int64     `json:"job_id,omitempty"`
+	Func   string    `json:"func,omitempty"`
+	Name   string    `json:"name,omitempty"`
+	Worker string    `json:"worker,omitempty"`
+	Retry  bool      `json:"retry,omitempty"` // The failed job will be retried
+	At     int64     `json:"at"`
+
+	// Namespace the namespace of the job or the worker
+	Namespace string `json:"namespace,omitempty"`
+
+	webhook string // The webhook url of the job
+	// The failed job is dead lettered, the dead_lettered event is notified
+	// by webhook instead.
+	deadLettered bool
+}
+
+// Bytes encode event to json bytes
+func (e Event) Bytes() (data []byte) {
+	data, _ = json.Marshal(e)
+	return
+}
+
+func newJobEvent(t EventType, job driver.Job) Event {
+	return Event{
+		Type:  t,
+		JobID: job.ID,
+		Func:  job.Func,
+		Name:  job.Name,
+		At:    time.Now().Unix(),
+
+		Namespace: job.Namespace,
+		webhook:   job.Webhook,
+	}
+}
+
+// newRunEvent create an event of the job run by worker
+func newRunEvent(t EventType, job driver.Job, worker string) Event {
+	e := newJobEvent(t, job)
+	e.Worker = worker
+	return e
+}
+
+func newFailEvent(job driver.Job, worker string, retry bool) Event {
+	e := newRunEvent(EventFailed, job, worker)
+	e.Retry = retry
+	return e
+}
+
+func newWorkerEvent(t EventType, w *worker) Event {
+	return Event{
+		Type:   t,
+		Worker: w.id,
+		At:     time.Now().Unix(),
+
+		Namespace: w.namespace,
+	}
+}
+
+// eventFilter defined which events a subscriber want, an empty set match all.
+type eventFilter struct {
+	Funcs []string    `json:"funcs"`
+	Types []EventType `json:"types"`
+
+	// allow skip the funcs not allowed, nil allow all
+	allow func(Func string) bool
+	// namespace skip the events of the other namespaces
+	namespace string
+}
+
+func (f eventFilter) match(e Event) bool {
+	if e.Namespace != f.namespace {
+		return false
+	}
+	if f.allow != nil && !f.allow(e.Func) {
+		return false
+	}
+	if len(f.Types) > 0 {
+		matched := false
+		for _, t := range f.Types {
+			if t == e.Type {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.Funcs) > 0 {
+		for _, Func := range f.Funcs {
+			if Func == e.Func {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// eventBus fan out the events to the listeners
+type eventBus struct {
+	listeners map[int]chan Event
+	lastID    int
+	locker    *sync.RWMutex
+}
+
+func newEventBus() *eventBus {
+	bus := new(eventBus)
+	bus.listeners = make(map[int]chan Event)
+	bus.locker = new(sync.RWMutex)
+	return bus
+}
+
+// subscribe create a listener with a buffered channel.
+func (bus *eventBus) subscribe(size int) (int, <-chan Event) {
+	defer bus.locker.Unlock()
+	bus.locker.Lock()
+	bus.lastID++
+	ch := make(chan Event, size)
+	bus.listeners[bus.lastID] = ch
+	return bus.lastID, ch
+}
+
+// unsubscribe remove the listener and close the channel.
+func (bus *eventBus) unsubscribe(id int) {
+	defer bus.locker.Unlock()
+	bus.locker.Lock()
+	if ch, ok := bus.listeners[id]; ok {
+		delete(bus.listeners, id)
+		close(ch)
+	}
+}
+
+// emit send the event to every listener, the event is dropped for the
+// listener when the channel is full, so a slow listener never block the
+// scheduler.
+func (bus *eventBus) emit(e Event) {
+	defer bus.locker.RUnlock()
+	bus.locker.RLock()
+	for _, ch := range bus.listeners {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// emit count the event to the func stat, log it, and send it to the event bus.
+func (sched *Sched) emit(e Event) {
+	sched.countEvent(e)
+	if e.JobID > 0 {
+		schedLog.Debug("Job event", "type", e.Type, "job_id", e.JobID, "namespace", e.Namespace,
+			"func", e.Func, "name", e.Name, "worker", e.Worker, "retry", e.Retry)
+	} else {
+		schedLog.Debug("Worker event", "type", e.Type, "namespace", e.Namespace, "worker", e.Worker)
+	}
+	if isWebhookEvent(e) {
+		sched.webhooks.notify(e)
+	}
+	sched.events.emit(e)
+}
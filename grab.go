@@ -5,14 +5,44 @@ import (
 	"container/list"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// grabSequence the last grab item sequence number
+var grabSequence int64
+
+// maxGrabJobs the most jobs assigned by a GRAB_JOBS
+const maxGrabJobs = 100
+
+// grabItem a GRAB_JOB waiting for a job, or a SLEEP waiting for a NOOP
 type grabItem struct {
 	w     *worker
 	msgID []byte
+	id    int64
+	// size the jobs asked by GRAB_JOBS, zero is a GRAB_JOB
+	size int
+	// sleep the worker is woken up by a NOOP instead of assigned a job
+	sleep bool
+	// timer reply NO_JOB when the GRAB_JOB wait timeout, nil wait forever
+	timer *time.Timer
+}
+
+func newGrabItem(w *worker, msgID []byte) grabItem {
+	return grabItem{w: w, msgID: msgID, id: atomic.AddInt64(&grabSequence, 1)}
+}
+
+// stop the timer of the item
+func (item grabItem) stop() {
+	if item.timer != nil {
+		item.timer.Stop()
+	}
 }
 
-func (item grabItem) has(Func string) bool {
+func (item grabItem) has(ns, Func string) bool {
+	if item.w.namespace != ns {
+		return false
+	}
 	for _, F := range item.w.funcs {
 		if F == Func {
 			return true
@@ -22,7 +52,7 @@ func (item grabItem) has(Func string) bool {
 }
 
 func (item grabItem) equal(item1 grabItem) bool {
-	if item1.w == item.w && bytes.Equal(item.msgID, item1.msgID) {
+	if item1.w == item.w && bytes.Equal(item.msgID, item1.msgID) && item1.id == item.id {
 		return true
 	}
 	return false
@@ -39,36 +69,59 @@ func (g *grabQueue) push(item grabItem) {
 	g.list.PushBack(item)
 }
 
-func (g *grabQueue) get(Func string) (item grabItem, err error) {
+func (g *grabQueue) get(ns, Func string) (item grabItem, err error) {
 	defer g.locker.Unlock()
 	g.locker.Lock()
 	for e := g.list.Front(); e != nil; e = e.Next() {
 		item = e.Value.(grabItem)
-		if item.has(Func) {
+		if !item.sleep && item.has(ns, Func) && !item.w.full() {
 			return
 		}
 	}
-	err = fmt.Errorf("func name: %s not found", Func)
+	err = fmt.Errorf("func name: %s not found in namespace: %s", Func, ns)
 	return
 }
 
-func (g *grabQueue) remove(item grabItem) {
+// remove the item, returns false when it is already removed, eg: assigned
+// a job or timeout.
+func (g *grabQueue) remove(item grabItem) bool {
 	defer g.locker.Unlock()
 	g.locker.Lock()
 	for e := g.list.Front(); e != nil; e = e.Next() {
 		item1 := e.Value.(grabItem)
 		if item.equal(item1) {
 			g.list.Remove(e)
+			return true
+		}
+	}
+	return false
+}
+
+// wake remove the sleeping items able to perform the func
+func (g *grabQueue) wake(ns, Func string) (items []grabItem) {
+	defer g.locker.Unlock()
+	g.locker.Lock()
+	var next *list.Element
+	for e := g.list.Front(); e != nil; e = next {
+		next = e.Next()
+		item := e.Value.(grabItem)
+		if item.sleep && item.has(ns, Func) {
+			g.list.Remove(e)
+			items = append(items, item)
 		}
 	}
+	return
 }
 
 func (g *grabQueue) removeWorker(w *worker) {
 	defer g.locker.Unlock()
 	g.locker.Lock()
-	for e := g.list.Front(); e != nil; e = e.Next() {
+	var next *list.Element
+	for e := g.list.Front(); e != nil; e = next {
+		next = e.Next()
 		item := e.Value.(grabItem)
 		if item.w == w {
+			item.stop()
 			g.list.Remove(e)
 		}
 	}
@@ -0,0 +1,130 @@
+package periodic
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/jmuyuyang/periodic/protocol"
+)
+
+// ErrHelloRepeated the capabilities are negotiated only once per connection
+var ErrHelloRepeated = errors.New("HELLO is already negotiated.")
+
+const (
+	// defaultHeartbeat the heartbeat interval when the client ask none
+	defaultHeartbeat = 30 * time.Second
+	// maxHeartbeat the longest heartbeat interval accepted
+	maxHeartbeat = 5 * time.Minute
+)
+
+// serverCapabilities the capabilities supported by the server
+var serverCapabilities = []protocol.Capability{
+	protocol.CapResults,
+	protocol.CapHeartbeats,
+	protocol.CapBatch,
+	protocol.CapErrors,
+}
+
+// session the features of a connection, negotiated by HELLO. A connection
+// without HELLO has the legacy capabilities.
+type session struct {
+	version   int
+	agent     string // The library name/version of the client
+	caps      map[protocol.Capability]bool
+	heartbeat time.Duration // The client send a packet at least every heartbeat, zero is unlimited
+	helloed   bool
+	// compression the compression of the frames, empty is disabled
+	compression string
+}
+
+func newSession() (s session) {
+	s.version = protocol.Version
+	s.caps = make(map[protocol.Capability]bool)
+	for _, c := range protocol.LegacyCapabilities {
+		s.caps[c] = true
+	}
+	return
+}
+
+// enabled check the capability is enabled on the connection
+func (s *session) enabled(c protocol.Capability) bool {
+	return s.caps[c]
+}
+
+// receive wait for the next packet, the connection silent for three
+// heartbeats is timeout. A bad frame is replied by an ERROR when the errors
+// is negotiated.
+func (s *session) receive(conn protocol.Conn) (payload []byte, err error) {
+	if s.heartbeat > 0 {
+		conn.SetReadDeadline(time.Now().Add(3 * s.heartbeat))
+	}
+	if payload, err = conn.Receive(); err != nil && s.enabled(protocol.CapErrors) {
+		sendFrameError(conn, err)
+	}
+	return
+}
+
+// replyError reply the error of the request msgID, by an ERROR when the
+// errors is negotiated, or by the error message alone on the legacy
+// connections.
+func (s *session) replyError(conn protocol.Conn, msgID []byte, e error) error {
+	if !s.enabled(protocol.CapErrors) {
+		return conn.Send([]byte(e.Error()))
+	}
+	return sendError(conn, msgID, e)
+}
+
+// handleHello negotiate the protocol version and the capabilities, reply the
+// negotiated ones.
+func (s *session) handleHello(conn protocol.Conn, msgID, payload []byte) error {
+	if s.helloed {
+		return sendError(conn, msgID, ErrHelloRepeated)
+	}
+	var err error
+	hello, err := protocol.NewHello(payload)
+	if err != nil {
+		return sendError(conn, msgID, validationError{err})
+	}
+	result := hello.Negotiate(protocol.Hello{
+		Version:      protocol.Version,
+		Agent:        "periodic/" + Version,
+		Capabilities: serverCapabilities,
+		Compression:  protocol.Compressions,
+	})
+	if result.Has(protocol.CapHeartbeats) {
+		heartbeat := time.Duration(hello.Heartbeat) * time.Second
+		if heartbeat <= 0 {
+			heartbeat = defaultHeartbeat
+		}
+		if heartbeat > maxHeartbeat {
+			heartbeat = maxHeartbeat
+		}
+		result.Heartbeat = int(heartbeat / time.Second)
+		s.heartbeat = heartbeat
+	}
+	s.version = result.Version
+	s.agent = hello.Agent
+	s.caps = make(map[protocol.Capability]bool)
+	for _, c := range result.Capabilities {
+		s.caps[c] = true
+	}
+	s.helloed = true
+	if len(result.Compression) > 0 {
+		s.compression = result.Compression[0]
+	}
+	protoLog.Debug("Negotiated", "agent", s.agent, "version", s.version,
+		"capabilities", result.Capabilities, "heartbeat", result.Heartbeat, "compression", s.compression)
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(msgID)
+	buf.Write(protocol.NullChar)
+	buf.Write(protocol.HELLO.Bytes())
+	buf.Write(protocol.NullChar)
+	buf.Write(result.Bytes())
+	if err = conn.Send(buf.Bytes()); err != nil {
+		return err
+	}
+	// the HELLO is sent plain, the frames after it are compressed
+	return conn.SetCompression(s.compression)
+}
@@ -0,0 +1,151 @@
+package periodic
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/trace"
+)
+
+// historySummarySize the max size of result or error kept in a record
+const historySummarySize = 1024
+
+// assignment defined a job run assigned to a worker
+type assignment struct {
+	worker  string
+	attempt int
+	at      time.Time
+	parent  trace.SpanContext // The job traceparent
+	span    trace.SpanContext // The run span handed to the worker
+}
+
+// SetHistoryLimit set how many execution records are kept per job and per func
+func (sched *Sched) SetHistoryLimit(jobLimit, funcLimit int) {
+	sched.historyJobLimit = jobLimit
+	sched.historyFuncLimit = funcLimit
+}
+
+// assignJob remember the job run assigned to worker at, the caller must hold
+// the jobLocker.
+func (sched *Sched) assignJob(job driver.Job, w *worker, at time.Time, parent, span trace.SpanContext) (a assignment) {
+	attempt := 1
+	if counter, ok := sched.retryCounter[job.ID]; ok {
+		attempt = attempt + int(counter.Int())
+	}
+	a = assignment{
+		worker:  w.id,
+		attempt: attempt,
+		at:      at,
+		parent:  parent,
+		span:    span,
+	}
+	sched.assigns[job.ID] = a
+	if job.SchedAt > 0 {
+		lag := float64(at.UnixNano())/float64(time.Second) - float64(job.SchedAt)
+		if lag < 0 {
+			lag = 0
+		}
+		sched.getFuncStat(job.Namespace, job.Func).ObserveLag(lag)
+	}
+	return
+}
+
+// addHistory append the execution record of the job run finished with outcome,
+// returns the worker of the run. the caller must hold the jobLocker.
+func (sched *Sched) addHistory(job driver.Job, outcome string, result []byte) (worker string) {
+	a, ok := sched.assigns[job.ID]
+	if !ok {
+		// the job is not assigned by this scheduler, eg. loaded from store.
+		return
+	}
+	worker = a.worker
+	delete(sched.assigns, job.ID)
+	now := time.Now()
+	record := driver.History{
+		JobID:      job.ID,
+		Namespace:  job.Namespace,
+		Func:       job.Func,
+		Name:       job.Name,
+		Attempt:    a.attempt,
+		Worker:     a.worker,
+		AssignedAt: a.at.Unix(),
+		FinishedAt: now.Unix(),
+		Outcome:    outcome,
+		Duration:   int64(now.Sub(a.at) / time.Millisecond),
+	}
+	sched.getFuncStat(job.Namespace, job.Func).ObserveRun(now.Sub(a.at).Seconds())
+	sched.traceRun(job, a, outcome, result, now)
+	if len(result) > historySummarySize {
+		result = result[:historySummarySize]
+	}
+	if outcome == driver.OutcomeDone {
+		record.Result = string(result)
+	} else {
+		record.Error = string(result)
+	}
+	if err := sched.driver.AddHistory(record, sched.historyJobLimit, sched.historyFuncLimit); err != nil {
+		withJob(schedLog, job).Error("AddHistory failed", "err", err)
+	}
+	return
+}
+
+type historyRequest struct {
+	ID    int64  `json:"job_id"`
+	Func  string `json:"func"`
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+}
+
+// queryHistory query the execution records of the namespace
+func (sched *Sched) queryHistory(ns string, req historyRequest) (records []driver.History, err error) {
+	if req.Limit <= 0 {
+		req.Limit = 20
+	}
+	if req.ID > 0 {
+		return sched.jobHistory(ns, req.ID, req.Func, req.Limit)
+	}
+	if req.Func == "" {
+		err = validationError{errors.New("job_id or func is required")}
+		return
+	}
+	if req.Name == "" {
+		return sched.driver.GetFuncHistory(ns, req.Func, req.Limit)
+	}
+	job, e := sched.driver.GetOne(ns, req.Func, req.Name)
+	if e == nil && job.ID > 0 {
+		return sched.jobHistory(ns, job.ID, req.Func, req.Limit)
+	}
+	// the job is finished and deleted, find it in the func records.
+	var all []driver.History
+	if all, err = sched.driver.GetFuncHistory(ns, req.Func, sched.historyFuncLimit); err != nil {
+		return
+	}
+	records = make([]driver.History, 0)
+	for _, record := range all {
+		if record.Name == req.Name && len(records) < req.Limit {
+			records = append(records, record)
+		}
+	}
+	return
+}
+
+// jobHistory get the execution records of the job, the records of the other
+// namespaces and of the other func when Func is given are skipped.
+func (sched *Sched) jobHistory(ns string, jobID int64, Func string, limit int) (records []driver.History, err error) {
+	var all []driver.History
+	if all, err = sched.driver.GetHistory(jobID, limit); err != nil {
+		return
+	}
+	records = make([]driver.History, 0, len(all))
+	for _, record := range all {
+		if namespaceOf(record.Namespace) != ns {
+			continue
+		}
+		if Func != "" && record.Func != Func {
+			continue
+		}
+		records = append(records, record)
+	}
+	return
+}
@@ -0,0 +1,341 @@
+package periodic
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jmuyuyang/periodic/driver"
+)
+
+var (
+	// ErrJobNotExists the job is not found
+	ErrJobNotExists = errors.New("Job not exists.")
+	// ErrJobProcessing the job is processing by a worker
+	ErrJobProcessing = errors.New("Job is processing.")
+	// ErrJobNotPaused the job is not paused
+	ErrJobNotPaused = errors.New("Job is not paused.")
+	// ErrJobPaused the job is paused
+	ErrJobPaused = errors.New("Job is paused.")
+	// ErrFuncNotExists the func is not found
+	ErrFuncNotExists = errors.New("Func not exists.")
+	// ErrFuncHasWorker the func can not be dropped while workers can do it
+	ErrFuncHasWorker = errors.New("Func has workers.")
+	// ErrJobRequired the job name or func is missing
+	ErrJobRequired = validationError{errors.New("job name or func is required")}
+)
+
+// validationError the request is rejected by the validation
+type validationError struct {
+	error
+}
+
+// findJob find the job of the namespace by job_id or by func and name, the
+// caller must hold the jobLocker.
+func (sched *Sched) findJob(ns string, jobID int64, Func, name string) (job driver.Job, err error) {
+	if jobID > 0 {
+		job, err = sched.driver.Get(jobID)
+	} else if Func != "" && name != "" {
+		job, err = sched.driver.GetOne(ns, Func, name)
+	} else {
+		err = validationError{errors.New("job_id or job name and func is required")}
+		return
+	}
+	if err != nil || job.ID <= 0 || job.Namespace != ns {
+		err = ErrJobNotExists
+	} else if Func != "" && job.Func != Func {
+		err = ErrJobNotExists
+	}
+	return
+}
+
+type jobRequest struct {
+	ID   int64  `json:"job_id"`
+	Func string `json:"func"`
+	Name string `json:"name"`
+}
+
+// getJob get the job of the namespace by job_id or by func and name
+func (sched *Sched) getJob(ns string, jobID int64, Func, name string) (driver.Job, error) {
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	return sched.findJob(ns, jobID, Func, name)
+}
+
+// prepareJob set the job ready and take over the id and the revision of the
+// job with the same func and name. the caller must hold the jobLocker.
+func (sched *Sched) prepareJob(job *driver.Job, now int64) (isNew, changed bool) {
+	isNew = true
+	job.SetReady()
+	if job.SchedAt == 0 {
+		job.SchedAt = now
+	}
+	oldJob, e := sched.driver.GetOne(job.Namespace, job.Func, job.Name)
+	job.Revision = 1
+	if e == nil && oldJob.ID > 0 {
+		job.ID = oldJob.ID
+		job.Revision = oldJob.Revision + 1
+		if oldJob.IsProc() {
+			sched.decrStatProc(oldJob)
+			sched.removeRevertPQ(oldJob)
+			changed = true
+		}
+		if oldJob.IsPaused() {
+			changed = true
+		}
+		isNew = false
+	}
+	return
+}
+
+// queueJob schedule the saved job, the caller must hold the jobLocker.
+func (sched *Sched) queueJob(job driver.Job, isNew, changed bool) {
+	if isNew {
+		if job.IsPeriod() {
+			job.ResetPeriod()
+		}
+		sched.incrStatJob(job)
+	}
+	if isNew || changed {
+		sched.pushJobPQ(job)
+	}
+	sched.emit(newJobEvent(EventSubmitted, job))
+}
+
+// saveJob submit a job to the namespace, the job with the same func and name
+// is replaced.
+func (sched *Sched) saveJob(ns string, job driver.Job) (_ driver.Job, isNew bool, err error) {
+	if job.Name == "" || job.Func == "" {
+		return job, false, ErrJobRequired
+	}
+	job.Namespace = ns
+	if err = sched.allowSubmit(ns, 1); err != nil {
+		return job, false, err
+	}
+	// offload the large args before the jobLocker, the blob may be large.
+	var blob string
+	if blob, err = sched.offloadArgs(&job); err != nil {
+		return job, false, err
+	}
+	defer func() {
+		if err != nil {
+			sched.removeBlob(blob)
+		}
+	}()
+	defer sched.notifyJobTimer()
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	isNew, changed := sched.prepareJob(&job, time.Now().Unix())
+	if isNew {
+		if err = sched.checkMaxJobs(ns, 1); err != nil {
+			return job, false, err
+		}
+	}
+	if err = sched.driver.Save(&job); err != nil {
+		return job, false, err
+	}
+	sched.queueJob(job, isNew, changed)
+	return job, isNew, nil
+}
+
+// forgetJob clean up the deleted job, the caller must hold the jobLocker.
+func (sched *Sched) forgetJob(job driver.Job) {
+	if _, ok := sched.procQueue[job.ID]; ok {
+		delete(sched.procQueue, job.ID)
+	}
+	delete(sched.assigns, job.ID)
+	delete(sched.retryCounter, job.ID)
+	sched.decrStatJob(job)
+	if job.IsProc() {
+		sched.decrStatProc(job)
+		sched.removeRevertPQ(job)
+	}
+	sched.removeJobPQ(job)
+	sched.emit(newJobEvent(EventRemoved, job))
+}
+
+// removeJob remove the job found by job_id or by func and name
+func (sched *Sched) removeJob(ns string, jobID int64, Func, name string) (job driver.Job, err error) {
+	defer sched.notifyJobTimer()
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	if job, err = sched.findJob(ns, jobID, Func, name); err != nil {
+		return
+	}
+	if err = sched.driver.Delete(job.ID); err != nil {
+		return
+	}
+	sched.forgetJob(job)
+	return
+}
+
+// dropFunc remove the func of the namespace and all the jobs of it, the func
+// can not be dropped while workers can do it.
+func (sched *Sched) dropFunc(ns, Func string) error {
+	defer sched.notifyJobTimer()
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+
+	defer sched.funcLocker.Unlock()
+	sched.funcLocker.Lock()
+	key := nsFunc(ns, Func)
+	stat, ok := sched.stats[key]
+	if !ok {
+		return nil
+	}
+	if stat.Worker.Int() > 0 {
+		return ErrFuncHasWorker
+	}
+	iter := sched.driver.NewIterator(ns, []byte(Func))
+	var deleteJob = make([]driver.Job, 0)
+	for {
+		if !iter.Next() {
+			break
+		}
+		job := iter.Value()
+		if job.Func == Func {
+			deleteJob = append(deleteJob, job)
+		}
+	}
+	iter.Close()
+	for _, job := range deleteJob {
+		sched.driver.Delete(job.ID)
+		sched.emit(newJobEvent(EventRemoved, job))
+	}
+	delete(sched.stats, key)
+	delete(sched.jobPQ, key)
+	return nil
+}
+
+// pauseJob stop scheduling the ready job until it is resumed
+func (sched *Sched) pauseJob(ns string, jobID int64, Func, name string) (job driver.Job, err error) {
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	if job, err = sched.findJob(ns, jobID, Func, name); err != nil {
+		return
+	}
+	if job.IsPaused() {
+		return
+	}
+	if job.IsProc() {
+		err = ErrJobProcessing
+		return
+	}
+	job.SetPaused()
+	if err = sched.driver.Save(&job); err != nil {
+		return
+	}
+	sched.removeJobPQ(job)
+	sched.emit(newJobEvent(EventPaused, job))
+	return
+}
+
+// resumeJob schedule the paused job again, the runs of a periodic job missed
+// while paused are skipped.
+func (sched *Sched) resumeJob(ns string, jobID int64, Func, name string) (job driver.Job, err error) {
+	defer sched.notifyJobTimer()
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	if job, err = sched.findJob(ns, jobID, Func, name); err != nil {
+		return
+	}
+	if !job.IsPaused() {
+		err = ErrJobNotPaused
+		return
+	}
+	job.SetReady()
+	if job.IsPeriod() && job.SchedAt < time.Now().Unix() {
+		job.SchedAt = 0
+		job.ResetPeriod()
+	}
+	if err = sched.driver.Save(&job); err != nil {
+		return
+	}
+	sched.pushJobPQ(job)
+	sched.emit(newJobEvent(EventResumed, job))
+	return
+}
+
+// runJob schedule the ready job to run now
+func (sched *Sched) runJob(ns string, jobID int64, Func, name string) (job driver.Job, err error) {
+	defer sched.notifyJobTimer()
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	if job, err = sched.findJob(ns, jobID, Func, name); err != nil {
+		return
+	}
+	if job.IsProc() {
+		err = ErrJobProcessing
+		return
+	}
+	if job.IsPaused() {
+		err = ErrJobPaused
+		return
+	}
+	job.SchedAt = time.Now().Unix()
+	if err = sched.driver.Save(&job); err != nil {
+		return
+	}
+	sched.pushJobPQ(job)
+	return
+}
+
+type listRequest struct {
+	Func   string `json:"func"`
+	Status string `json:"status"`
+	Prefix string `json:"prefix"` // The job name prefix
+	Cursor int64  `json:"cursor"` // List the jobs after the job id
+	Limit  int    `json:"limit"`
+
+	// allow skip the funcs not allowed, nil allow all
+	allow func(Func string) bool
+}
+
+type listResult struct {
+	Jobs       []driver.Job `json:"jobs"`
+	NextCursor int64        `json:"next_cursor,omitempty"` // Zero on the last page
+}
+
+// listJobs list the matched jobs of the namespace ordered by job id, a page
+// hold at most limit jobs after the cursor.
+func (sched *Sched) listJobs(ns string, req listRequest) (result listResult) {
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 100
+	}
+	var prefix []byte
+	if req.Func != "" {
+		prefix = []byte(req.Func)
+	}
+	var jobs = make([]driver.Job, 0)
+	iter := sched.driver.NewIteratorAfter(ns, prefix, req.Cursor)
+	for {
+		if !iter.Next() {
+			break
+		}
+		job := iter.Value()
+		if job.ID <= req.Cursor || job.Name == "" {
+			continue
+		}
+		if req.Func != "" && job.Func != req.Func {
+			continue
+		}
+		if req.allow != nil && !req.allow(job.Func) {
+			continue
+		}
+		if req.Status != "" && job.Status != req.Status {
+			continue
+		}
+		if !strings.HasPrefix(job.Name, req.Prefix) {
+			continue
+		}
+		// one more matched job, there is a next page
+		if len(jobs) == req.Limit {
+			result.NextCursor = jobs[req.Limit-1].ID
+			break
+		}
+		jobs = append(jobs, job)
+	}
+	iter.Close()
+	result.Jobs = jobs
+	return
+}
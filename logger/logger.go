@@ -0,0 +1,310 @@
+// Package logger defined the leveled structured logger of periodic.
+//
+// Each subsystem (sched, protocol, driver, http, trace) has its own level,
+// which can be changed at runtime. A line is written in logfmt or json with
+// the time, the level, the subsystem, the message and the fields:
+//
+//	time=2017-01-02T15:04:05+08:00 level=info subsystem=sched msg="job done" job_id=1 func=f
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level defined the log level
+type Level int
+
+const (
+	// DEBUG the detail of the job lifecycle
+	DEBUG Level = iota
+	// INFO the normal messages
+	INFO
+	// WARN something unexpected but can go on
+	WARN
+	// ERROR something failed
+	ERROR
+)
+
+func (l Level) String() string {
+	switch l {
+	case DEBUG:
+		return "debug"
+	case INFO:
+		return "info"
+	case WARN:
+		return "warn"
+	case ERROR:
+		return "error"
+	}
+	return "unknown"
+}
+
+// ParseLevel parse the level name
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DEBUG, nil
+	case "info":
+		return INFO, nil
+	case "warn", "warning":
+		return WARN, nil
+	case "error":
+		return ERROR, nil
+	}
+	return INFO, fmt.Errorf("Unknown log level %s", name)
+}
+
+// Format defined the output format
+type Format int
+
+const (
+	// LOGFMT key=value pairs
+	LOGFMT Format = iota
+	// JSON one json object per line
+	JSON
+)
+
+// ParseFormat parse the format name
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "logfmt", "text", "":
+		return LOGFMT, nil
+	case "json":
+		return JSON, nil
+	}
+	return LOGFMT, fmt.Errorf("Unknown log format %s", name)
+}
+
+var (
+	locker                 = new(sync.RWMutex)
+	outLocker              = new(sync.Mutex)
+	out          io.Writer = os.Stderr
+	format                 = LOGFMT
+	defaultLevel           = INFO
+	levels                 = make(map[string]Level)
+)
+
+// SetOutput set the writer of all loggers
+func SetOutput(w io.Writer) {
+	defer outLocker.Unlock()
+	outLocker.Lock()
+	out = w
+}
+
+// SetFormat set the format of all loggers
+func SetFormat(f Format) {
+	defer locker.Unlock()
+	locker.Lock()
+	format = f
+}
+
+// SetLevel set the level of a subsystem, an empty subsystem set the level
+// of all subsystems.
+func SetLevel(subsystem string, level Level) {
+	defer locker.Unlock()
+	locker.Lock()
+	if subsystem == "" || subsystem == "all" {
+		defaultLevel = level
+		for name := range levels {
+			levels[name] = level
+		}
+		return
+	}
+	levels[subsystem] = level
+}
+
+// SetLevels set the levels from spec like "info" or "sched=debug,driver=warn"
+func SetLevels(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var subsystem, name = "", part
+		if idx := strings.Index(part, "="); idx > -1 {
+			subsystem, name = part[:idx], part[idx+1:]
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return err
+		}
+		SetLevel(subsystem, level)
+	}
+	return nil
+}
+
+// Levels get the level name of each subsystem
+func Levels() map[string]string {
+	defer locker.RUnlock()
+	locker.RLock()
+	var result = make(map[string]string)
+	for name, level := range levels {
+		result[name] = level.String()
+	}
+	return result
+}
+
+func getLevel(subsystem string) Level {
+	defer locker.RUnlock()
+	locker.RLock()
+	if level, ok := levels[subsystem]; ok {
+		return level
+	}
+	return defaultLevel
+}
+
+func register(subsystem string) {
+	defer locker.Unlock()
+	locker.Lock()
+	if _, ok := levels[subsystem]; !ok {
+		levels[subsystem] = defaultLevel
+	}
+}
+
+// Logger defined a subsystem logger with the context fields
+type Logger struct {
+	subsystem string
+	fields    []interface{}
+}
+
+// New create a logger of the subsystem
+func New(subsystem string) *Logger {
+	register(subsystem)
+	return &Logger{subsystem: subsystem}
+}
+
+// With create a logger carry the key value pairs in every line
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{subsystem: l.subsystem, fields: fields}
+}
+
+// Enabled check the level is enabled or not
+func (l *Logger) Enabled(level Level) bool {
+	return level >= getLevel(l.subsystem)
+}
+
+// Debug log a message with the key value pairs
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(DEBUG, msg, kv)
+}
+
+// Info log a message with the key value pairs
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(INFO, msg, kv)
+}
+
+// Warn log a message with the key value pairs
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.log(WARN, msg, kv)
+}
+
+// Error log a message with the key value pairs
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(ERROR, msg, kv)
+}
+
+// Fatal log a message with the key value pairs, then exit
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+	l.log(ERROR, msg, kv)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	locker.RLock()
+	f := format
+	locker.RUnlock()
+
+	var fields = make([]interface{}, 0, 8+len(l.fields)+len(kv))
+	fields = append(fields, "time", time.Now().Format(time.RFC3339), "level", level.String(),
+		"subsystem", l.subsystem, "msg", msg)
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	if len(fields)%2 == 1 {
+		fields = append(fields, nil)
+	}
+
+	var line []byte
+	if f == JSON {
+		line = encodeJSON(fields)
+	} else {
+		line = encodeLogfmt(fields)
+	}
+	defer outLocker.Unlock()
+	outLocker.Lock()
+	out.Write(line)
+}
+
+func toString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func encodeLogfmt(fields []interface{}) []byte {
+	buf := bytes.NewBuffer(nil)
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(toString(fields[i]))
+		buf.WriteByte('=')
+		value := toString(fields[i+1])
+		if value == "" || strings.ContainsAny(value, " =\"\t\r\n") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func encodeJSON(fields []interface{}) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(toString(fields[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+		var value []byte
+		var err error
+		switch v := fields[i+1].(type) {
+		case bool, int, int64, int32, uint, uint64, uint32, float64, float32:
+			value, err = json.Marshal(v)
+		default:
+			value, err = json.Marshal(toString(v))
+		}
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(fields[i+1]))
+		}
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
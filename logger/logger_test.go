@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogfmt(t *testing.T) {
+	var buf = bytes.NewBuffer(nil)
+	SetOutput(buf)
+	SetFormat(LOGFMT)
+	var l = New("test").With("func", "f")
+	l.Info("job done", "job_id", 1, "err", errors.New("bad thing"))
+	line := buf.String()
+	if !strings.Contains(line, "level=info subsystem=test msg=\"job done\" func=f job_id=1 err=\"bad thing\"\n") {
+		t.Fatalf("Logfmt: unexcept line: %s", line)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf = bytes.NewBuffer(nil)
+	SetOutput(buf)
+	SetFormat(JSON)
+	defer SetFormat(LOGFMT)
+	var l = New("test")
+	l.Warn("slow", "job_id", int64(2), "worker", "worker#1")
+	line := buf.String()
+	if !strings.Contains(line, "\"level\":\"warn\",\"subsystem\":\"test\",\"msg\":\"slow\",\"job_id\":2,\"worker\":\"worker#1\"}\n") {
+		t.Fatalf("JSON: unexcept line: %s", line)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	var buf = bytes.NewBuffer(nil)
+	SetOutput(buf)
+	var l = New("sched")
+	if err := SetLevels("warn,sched=debug"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLevel("", INFO)
+	l.Debug("visible")
+	New("driver").Info("hidden")
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("Levels: except 1 line, got: %s", buf.String())
+	}
+	if Levels()["driver"] != "warn" || Levels()["sched"] != "debug" {
+		t.Fatalf("Levels: unexcept levels: %v", Levels())
+	}
+	if err := SetLevels("sched=loud"); err == nil {
+		t.Fatalf("Levels: except error")
+	}
+}
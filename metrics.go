@@ -0,0 +1,246 @@
+package periodic
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/stat"
+)
+
+// connTypes the connection types counted by the scheduler
+var connTypes = []string{"client", "worker", "http"}
+
+// countEvent count the job outcomes to the func stat. It is called under the
+// jobLocker, and the removed event is emitted under the funcLocker, so only
+// the counted events can touch the func stat.
+func (sched *Sched) countEvent(e Event) {
+	switch e.Type {
+	case EventSubmitted:
+		sched.getFuncStat(e.Namespace, e.Func).Submitted.Incr()
+		break
+	case EventDone:
+		sched.getFuncStat(e.Namespace, e.Func).MarkDone()
+		break
+	case EventFailed:
+		st := sched.getFuncStat(e.Namespace, e.Func)
+		if e.Retry {
+			st.Retried.Incr()
+		}
+		st.Failed.Incr()
+		st.MarkFailure()
+		break
+	case EventTimeout:
+		st := sched.getFuncStat(e.Namespace, e.Func)
+		st.Timeout.Incr()
+		st.MarkFailure()
+		break
+	case EventExpired:
+		sched.getFuncStat(e.Namespace, e.Func).Expired.Incr()
+		break
+	}
+}
+
+// metricsDriver wrap a store driver to observe the latency of the operations
+type metricsDriver struct {
+	driver.StoreDriver
+	latency map[string]*stat.Histogram
+	locker  *sync.Mutex
+}
+
+func newMetricsDriver(store driver.StoreDriver) *metricsDriver {
+	d := new(metricsDriver)
+	d.StoreDriver = store
+	d.latency = make(map[string]*stat.Histogram)
+	d.locker = new(sync.Mutex)
+	return d
+}
+
+func (d *metricsDriver) observe(op string, start time.Time) {
+	d.locker.Lock()
+	h, ok := d.latency[op]
+	if !ok {
+		h = stat.NewHistogram(stat.LatencyBuckets)
+		d.latency[op] = h
+	}
+	d.locker.Unlock()
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (d *metricsDriver) Save(job *driver.Job, force ...bool) error {
+	defer d.observe("save", time.Now())
+	return d.StoreDriver.Save(job, force...)
+}
+
+func (d *metricsDriver) SaveBatch(jobs []*driver.Job) []error {
+	defer d.observe("save_batch", time.Now())
+	return d.StoreDriver.SaveBatch(jobs)
+}
+
+func (d *metricsDriver) Delete(jobID int64) error {
+	defer d.observe("delete", time.Now())
+	return d.StoreDriver.Delete(jobID)
+}
+
+func (d *metricsDriver) DeleteBatch(jobIDs []int64) []error {
+	defer d.observe("delete_batch", time.Now())
+	return d.StoreDriver.DeleteBatch(jobIDs)
+}
+
+func (d *metricsDriver) Archive(jobID int64, reason string) error {
+	defer d.observe("archive", time.Now())
+	return d.StoreDriver.Archive(jobID, reason)
+}
+
+func (d *metricsDriver) PurgeArchived(before int64) ([]driver.ArchivedJob, error) {
+	defer d.observe("purge_archived", time.Now())
+	return d.StoreDriver.PurgeArchived(before)
+}
+
+func (d *metricsDriver) Get(jobID int64) (driver.Job, error) {
+	defer d.observe("get", time.Now())
+	return d.StoreDriver.Get(jobID)
+}
+
+func (d *metricsDriver) GetOne(ns, Func, name string) (driver.Job, error) {
+	defer d.observe("get_one", time.Now())
+	return d.StoreDriver.GetOne(ns, Func, name)
+}
+
+func (d *metricsDriver) AddHistory(record driver.History, jobLimit, funcLimit int) error {
+	defer d.observe("add_history", time.Now())
+	return d.StoreDriver.AddHistory(record, jobLimit, funcLimit)
+}
+
+// metricsWriter write the metrics in the prometheus text format
+type metricsWriter struct {
+	buf *bytes.Buffer
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func (w metricsWriter) header(name, typ, help string) {
+	fmt.Fprintf(w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (w metricsWriter) sample(name, labels string, v float64) {
+	w.buf.WriteString(name)
+	if labels != "" {
+		w.buf.WriteString("{" + labels + "}")
+	}
+	w.buf.WriteString(" ")
+	w.buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	w.buf.WriteString("\n")
+}
+
+func (w metricsWriter) histogram(name, labels string, h *stat.Histogram) {
+	buckets, counts, sum, count := h.Snapshot()
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, le := range buckets {
+		w.sample(name+"_bucket", labels+sep+"le=\""+strconv.FormatFloat(le, 'g', -1, 64)+"\"", float64(counts[i]))
+	}
+	w.sample(name+"_bucket", labels+sep+"le=\"+Inf\"", float64(count))
+	w.sample(name+"_sum", labels, sum)
+	w.sample(name+"_count", labels, float64(count))
+}
+
+func label(name, value string) string {
+	return name + "=\"" + labelEscaper.Replace(value) + "\""
+}
+
+func funcLabels(st *stat.FuncStat) string {
+	return label("namespace", st.Namespace) + "," + label("func", st.Name)
+}
+
+// metrics export the scheduler metrics in the prometheus text format
+func (sched *Sched) metrics() []byte {
+	w := metricsWriter{buf: bytes.NewBuffer(nil)}
+
+	sched.funcLocker.Lock()
+	stats := make([]*stat.FuncStat, 0, len(sched.stats))
+	for _, st := range sched.stats {
+		stats = append(stats, st)
+	}
+	sched.funcLocker.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Namespace != stats[j].Namespace {
+			return stats[i].Namespace < stats[j].Namespace
+		}
+		return stats[i].Name < stats[j].Name
+	})
+
+	var gauges = []struct {
+		name, typ, help string
+		value           func(*stat.FuncStat) *stat.Counter
+	}{
+		{"periodic_jobs", "gauge", "The jobs of the func.", func(st *stat.FuncStat) *stat.Counter { return st.Job }},
+		{"periodic_processing_jobs", "gauge", "The processing jobs of the func.", func(st *stat.FuncStat) *stat.Counter { return st.Processing }},
+		{"periodic_workers", "gauge", "The workers can do the func.", func(st *stat.FuncStat) *stat.Counter { return st.Worker }},
+		{"periodic_jobs_submitted_total", "counter", "The submitted jobs of the func.", func(st *stat.FuncStat) *stat.Counter { return st.Submitted }},
+		{"periodic_jobs_done_total", "counter", "The done jobs of the func.", func(st *stat.FuncStat) *stat.Counter { return st.Done }},
+		{"periodic_jobs_failed_total", "counter", "The failed jobs of the func.", func(st *stat.FuncStat) *stat.Counter { return st.Failed }},
+		{"periodic_jobs_retried_total", "counter", "The failed jobs of the func will be retried.", func(st *stat.FuncStat) *stat.Counter { return st.Retried }},
+		{"periodic_jobs_timeout_total", "counter", "The timeout jobs of the func.", func(st *stat.FuncStat) *stat.Counter { return st.Timeout }},
+		{"periodic_jobs_expired_total", "counter", "The expired jobs of the func.", func(st *stat.FuncStat) *stat.Counter { return st.Expired }},
+	}
+	for _, g := range gauges {
+		w.header(g.name, g.typ, g.help)
+		for _, st := range stats {
+			w.sample(g.name, funcLabels(st), float64(g.value(st).Int()))
+		}
+	}
+
+	w.header("periodic_dispatch_lag_seconds", "histogram", "The seconds between the job sched at and assigned.")
+	for _, st := range stats {
+		w.histogram("periodic_dispatch_lag_seconds", funcLabels(st), st.DispatchLag)
+	}
+	w.header("periodic_run_duration_seconds", "histogram", "The seconds between the job assigned and finished.")
+	for _, st := range stats {
+		w.histogram("periodic_run_duration_seconds", funcLabels(st), st.RunDuration)
+	}
+
+	w.header("periodic_connections", "gauge", "The open connections.")
+	for _, typ := range connTypes {
+		w.sample("periodic_connections", label("type", typ), float64(sched.conns[typ].Int()))
+	}
+
+	if store, ok := sched.driver.(*metricsDriver); ok {
+		store.locker.Lock()
+		ops := make([]string, 0, len(store.latency))
+		for op := range store.latency {
+			ops = append(ops, op)
+		}
+		store.locker.Unlock()
+		sort.Strings(ops)
+		w.header("periodic_store_operation_duration_seconds", "histogram", "The latency of the store operations.")
+		for _, op := range ops {
+			store.locker.Lock()
+			h := store.latency[op]
+			store.locker.Unlock()
+			w.histogram("periodic_store_operation_duration_seconds", label("op", op), h)
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	w.header("go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	w.sample("go_goroutines", "", float64(runtime.NumGoroutine()))
+	w.header("go_memstats_heap_alloc_bytes", "gauge", "Number of heap bytes allocated and still in use.")
+	w.sample("go_memstats_heap_alloc_bytes", "", float64(mem.HeapAlloc))
+	w.header("go_memstats_heap_inuse_bytes", "gauge", "Number of heap bytes that are in use.")
+	w.sample("go_memstats_heap_inuse_bytes", "", float64(mem.HeapInuse))
+	w.header("go_memstats_heap_sys_bytes", "gauge", "Number of heap bytes obtained from system.")
+	w.sample("go_memstats_heap_sys_bytes", "", float64(mem.HeapSys))
+	w.header("go_memstats_heap_objects", "gauge", "Number of allocated objects.")
+	w.sample("go_memstats_heap_objects", "", float64(mem.HeapObjects))
+	return w.buf.Bytes()
+}
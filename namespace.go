@@ -0,0 +1,218 @@
+package periodic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/jmuyuyang/periodic/driver"
+)
+
+// ErrInvalidNamespace the namespace is not 1 to 64 letters, digits, "_", "."
+// or "-"
+var ErrInvalidNamespace = validationError{errors.New("Invalid namespace.")}
+
+// validNamespace check the namespace is 1 to 64 letters, digits, "_", "." or "-"
+func validNamespace(ns string) bool {
+	if len(ns) == 0 || len(ns) > 64 {
+		return false
+	}
+	for _, c := range ns {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			continue
+		case c == '_' || c == '.' || c == '-':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// namespaceOf the namespace of a record, the records stored before the
+// namespaces are in the default one.
+func namespaceOf(ns string) string {
+	if ns == "" {
+		return driver.DefaultNamespace
+	}
+	return ns
+}
+
+// nsFunc the key of a func in the namespace
+func nsFunc(ns, Func string) string {
+	return ns + ":" + Func
+}
+
+// quota defined the limits of a namespace, a zero value is unlimited.
+type quota struct {
+	MaxJobs       int64   `json:"max_jobs"`       // The max jobs stored
+	SubmitRate    float64 `json:"submit_rate"`    // The max jobs submitted per second
+	MaxProcessing int64   `json:"max_processing"` // The max jobs processing at once
+}
+
+// quotaError the namespace reached a limit of the quota
+type quotaError struct {
+	namespace string
+	limit     string
+	value     interface{}
+}
+
+func (e quotaError) Error() string {
+	return fmt.Sprintf("Quota exceeded: namespace %q reached %s %v.", e.namespace, e.limit, e.value)
+}
+
+// SetQuotas load the quotas of the namespaces from a json file, eg:
+//
+//	{"billing": {"max_jobs": 10000, "submit_rate": 100, "max_processing": 20},
+//	 "*": {"max_jobs": 1000}}
+//
+// The quota "*" apply to the namespaces without one. Everything is unlimited
+// when no quota is set.
+func (sched *Sched) SetQuotas(quotaFile string) error {
+	data, err := ioutil.ReadFile(quotaFile)
+	if err != nil {
+		return err
+	}
+	var quotas map[string]quota
+	if err = json.Unmarshal(data, &quotas); err != nil {
+		return err
+	}
+	defer sched.quotaLocker.Unlock()
+	sched.quotaLocker.Lock()
+	sched.quotas = quotas
+	sched.limiters = make(map[string]*rateLimiter)
+	return nil
+}
+
+// getQuota get the quota of the namespace, the caller must hold the
+// quotaLocker.
+func (sched *Sched) getQuota(ns string) (q quota, ok bool) {
+	if sched.quotas == nil {
+		return
+	}
+	if q, ok = sched.quotas[ns]; ok {
+		return
+	}
+	q, ok = sched.quotas["*"]
+	return
+}
+
+// allowSubmit take n jobs from the submit rate of the namespace.
+func (sched *Sched) allowSubmit(ns string, n int) error {
+	defer sched.quotaLocker.Unlock()
+	sched.quotaLocker.Lock()
+	q, ok := sched.getQuota(ns)
+	if !ok || q.SubmitRate <= 0 {
+		return nil
+	}
+	limiter, ok := sched.limiters[ns]
+	if !ok {
+		limiter = newRateLimiter(q.SubmitRate)
+		sched.limiters[ns] = limiter
+	}
+	if !limiter.take(float64(n), time.Now()) {
+		return quotaError{namespace: ns, limit: "submit_rate", value: q.SubmitRate}
+	}
+	return nil
+}
+
+// checkMaxJobs check the namespace can store n more jobs.
+func (sched *Sched) checkMaxJobs(ns string, n int64) error {
+	sched.quotaLocker.Lock()
+	q, ok := sched.getQuota(ns)
+	sched.quotaLocker.Unlock()
+	if !ok || q.MaxJobs <= 0 {
+		return nil
+	}
+	if sched.namespaceJobs(ns)+n > q.MaxJobs {
+		return quotaError{namespace: ns, limit: "max_jobs", value: q.MaxJobs}
+	}
+	return nil
+}
+
+// namespaceJobs count the jobs stored in the namespace
+func (sched *Sched) namespaceJobs(ns string) (jobs int64) {
+	defer sched.funcLocker.Unlock()
+	sched.funcLocker.Lock()
+	for _, st := range sched.stats {
+		if st.Namespace == ns {
+			jobs = jobs + st.Job.Int()
+		}
+	}
+	return
+}
+
+// processingRoom the jobs the namespace can process more, -1 is unlimited.
+func (sched *Sched) processingRoom(ns string) int64 {
+	sched.quotaLocker.Lock()
+	q, ok := sched.getQuota(ns)
+	sched.quotaLocker.Unlock()
+	if !ok || q.MaxProcessing <= 0 {
+		return -1
+	}
+	var processing int64
+	sched.funcLocker.Lock()
+	for _, st := range sched.stats {
+		if st.Namespace == ns {
+			processing = processing + st.Processing.Int()
+		}
+	}
+	sched.funcLocker.Unlock()
+	return q.MaxProcessing - processing
+}
+
+// busyNamespaces the namespaces reached the max processing jobs, the caller
+// must hold the funcLocker.
+func (sched *Sched) busyNamespaces() map[string]bool {
+	defer sched.quotaLocker.Unlock()
+	sched.quotaLocker.Lock()
+	if sched.quotas == nil {
+		return nil
+	}
+	var processing = make(map[string]int64)
+	for _, st := range sched.stats {
+		processing[st.Namespace] = processing[st.Namespace] + st.Processing.Int()
+	}
+	var busy = make(map[string]bool)
+	for ns, n := range processing {
+		q, ok := sched.getQuota(ns)
+		if ok && q.MaxProcessing > 0 && n >= q.MaxProcessing {
+			busy[ns] = true
+		}
+	}
+	return busy
+}
+
+// rateLimiter a token bucket refilled rate tokens per second, hold at most
+// one second of tokens and at least one token.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// take n tokens at now, returns false when there are not enough.
+func (l *rateLimiter) take(n float64, now time.Time) bool {
+	l.tokens = l.tokens + now.Sub(l.last).Seconds()*l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < n {
+		return false
+	}
+	l.tokens = l.tokens - n
+	return true
+}
@@ -0,0 +1,48 @@
+package periodic
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidNamespace(t *testing.T) {
+	for _, ns := range []string{"default", "billing-eu.v2_1", strings.Repeat("a", 64)} {
+		if !validNamespace(ns) {
+			t.Fatalf("validNamespace(%q): except: true", ns)
+		}
+	}
+	for _, ns := range []string{"", strings.Repeat("a", 65), "a:b", "a b", "a/b", "é"} {
+		if validNamespace(ns) {
+			t.Fatalf("validNamespace(%q): except: false", ns)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	var l = newRateLimiter(10)
+	var now = l.last
+	// the bucket start full of one second of tokens
+	if !l.take(10, now) {
+		t.Fatalf("take: except the burst allowed")
+	}
+	if l.take(1, now) {
+		t.Fatalf("take: except the empty bucket denied")
+	}
+	now = now.Add(100 * time.Millisecond)
+	if !l.take(1, now) || l.take(1, now) {
+		t.Fatalf("take: except one token refilled in 100ms")
+	}
+	// the bucket hold at most the burst
+	now = now.Add(time.Minute)
+	if l.take(11, now) || !l.take(10, now) {
+		t.Fatalf("take: except the refill capped at the burst")
+	}
+
+	// the rate below one still hold one token
+	l = newRateLimiter(0.5)
+	now = l.last
+	if !l.take(1, now) || l.take(1, now.Add(time.Second)) || !l.take(1, now.Add(2*time.Second)) {
+		t.Fatalf("take: except one token every two seconds")
+	}
+}
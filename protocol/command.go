@@ -49,6 +49,42 @@ const (
 	DUMP // client
 	// LOAD load data to database
 	LOAD // client
+	// SUBMITJOBS submit a batch of jobs for server
+	SUBMITJOBS // client
+	// REMOVEJOBS remove a batch of jobs
+	REMOVEJOBS // client
+	// UPDATEJOB update some fields of a job
+	UPDATEJOB // client
+	// HISTORY ask the execution records of a job or func
+	HISTORY // client
+	// SUBSCRIBE subscribe the scheduler events
+	SUBSCRIBE // client
+	// UNSUBSCRIBE stop the scheduler events
+	UNSUBSCRIBE // client
+	// EVENT push a scheduler event to client
+	EVENT // server
+	// SETWEBHOOK set the webhook of a func
+	SETWEBHOOK // client
+	// REMOVEWEBHOOK remove the webhook of a func
+	REMOVEWEBHOOK // client
+	// WEBHOOK ask the webhook and the deliveries of a func
+	WEBHOOK // client
+	// LOGLEVEL ask or change the log levels
+	LOGLEVEL // client
+	// GETJOB ask a job by job_id or by func and name
+	GETJOB // client
+	// LISTJOBS list the jobs page by page
+	LISTJOBS // client
+	// AUTH authenticate the connection by a token
+	AUTH // client
+	// HELLO negotiate the protocol version and the capabilities
+	HELLO // client
+	// ERROR reply the error of a request
+	ERROR // server
+	// GRABJOBS client ask a batch of jobs
+	GRABJOBS // client
+	// JOBASSIGNS assign a batch of jobs for client
+	JOBASSIGNS // server
 )
 
 // Bytes convert command to byte
@@ -98,6 +134,44 @@ func (c Command) String() string {
 		return "REMOVEJOB"
 	case DUMP:
 		return "DUMP"
+	case LOAD:
+		return "LOAD"
+	case SUBMITJOBS:
+		return "SUBMITJOBS"
+	case REMOVEJOBS:
+		return "REMOVEJOBS"
+	case UPDATEJOB:
+		return "UPDATEJOB"
+	case HISTORY:
+		return "HISTORY"
+	case SUBSCRIBE:
+		return "SUBSCRIBE"
+	case UNSUBSCRIBE:
+		return "UNSUBSCRIBE"
+	case EVENT:
+		return "EVENT"
+	case SETWEBHOOK:
+		return "SETWEBHOOK"
+	case REMOVEWEBHOOK:
+		return "REMOVEWEBHOOK"
+	case WEBHOOK:
+		return "WEBHOOK"
+	case LOGLEVEL:
+		return "LOGLEVEL"
+	case GETJOB:
+		return "GETJOB"
+	case LISTJOBS:
+		return "LISTJOBS"
+	case AUTH:
+		return "AUTH"
+	case HELLO:
+		return "HELLO"
+	case ERROR:
+		return "ERROR"
+	case GRABJOBS:
+		return "GRABJOBS"
+	case JOBASSIGNS:
+		return "JOBASSIGNS"
 	}
 	panic("Unknow Command " + strconv.Itoa(int(c)))
 }
@@ -0,0 +1,77 @@
+package protocol
+
+import (
+	"errors"
+
+	"github.com/golang/snappy"
+)
+
+// CompressionSnappy compress the frames by snappy
+const CompressionSnappy = "snappy"
+
+// Compressions the compression algorithms supported, negotiated by HELLO
+var Compressions = []string{CompressionSnappy}
+
+var (
+	// ErrUnsupportedCompression the compression algorithm is not supported
+	ErrUnsupportedCompression = errors.New("Unsupported compression.")
+	// ErrCompressionNotEnabled a compressed frame is received before the
+	// compression is negotiated
+	ErrCompressionNotEnabled = errors.New("Compression not enabled.")
+	// ErrInvalidCompressed the compressed frame is corrupt
+	ErrInvalidCompressed = errors.New("Invalid compressed frame.")
+)
+
+// compressThreshold the smaller frames are not worth compressing
+const compressThreshold = 1024
+
+// flagCompressed the top bit of the header mark the data is compressed
+const flagCompressed = 0x80
+
+// compressor compress the frames of a connection, shared by the copies of
+// the Conn.
+type compressor struct {
+	name string
+}
+
+func (c *compressor) enabled() bool {
+	return c.name != ""
+}
+
+// encode compress the data, returns false when it is not worth it.
+func (c *compressor) encode(data []byte) ([]byte, bool) {
+	if len(data) < compressThreshold {
+		return data, false
+	}
+	compressed := snappy.Encode(nil, data)
+	if len(compressed) >= len(data) {
+		return data, false
+	}
+	return compressed, true
+}
+
+// decode decompress the data, the data larger than max is rejected before
+// decompressing.
+func (c *compressor) decode(data []byte, max uint32) ([]byte, error) {
+	length, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, ErrInvalidCompressed
+	}
+	if uint64(length) > uint64(max) {
+		return nil, ErrFrameTooLarge
+	}
+	if data, err = snappy.Decode(nil, data); err != nil {
+		return nil, ErrInvalidCompressed
+	}
+	return data, nil
+}
+
+// SupportCompression check the compression algorithm is supported
+func SupportCompression(name string) bool {
+	for _, c := range Compressions {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
@@ -16,6 +16,13 @@ var (
 	MagicResponse = []byte("\x00RES")
 )
 
+const (
+	// MaxFrameSize the largest frame the header can carry
+	MaxFrameSize = 0x7fffffff
+	// DefaultMaxFrameSize the max frame size received by default
+	DefaultMaxFrameSize = 64 << 20
+)
+
 // Conn a custom connect
 type Conn struct {
 	net.Conn
@@ -23,13 +30,16 @@ type Conn struct {
 	ResponseMagic []byte
 	wlocker       *sync.RWMutex
 	rlocker       *sync.RWMutex
+	maxFrameSize  uint32
+	compressor    *compressor
 }
 
 // NewConn create a connection
 func NewConn(conn net.Conn, reqMagic, resMagic []byte) Conn {
 	var wlocker = new(sync.RWMutex)
 	var rlocker = new(sync.RWMutex)
-	return Conn{Conn: conn, RequestMagic: reqMagic, ResponseMagic: resMagic, wlocker: wlocker, rlocker: rlocker}
+	return Conn{Conn: conn, RequestMagic: reqMagic, ResponseMagic: resMagic, wlocker: wlocker, rlocker: rlocker,
+		maxFrameSize: DefaultMaxFrameSize, compressor: new(compressor)}
 }
 
 // NewServerConn create a server connection
@@ -42,6 +52,28 @@ func NewClientConn(conn net.Conn) Conn {
 	return NewConn(conn, MagicResponse, MagicRequest)
 }
 
+// SetMaxFrameSize set the max frame size received, a larger frame is rejected
+// before the payload is read.
+func (conn *Conn) SetMaxFrameSize(size uint32) {
+	if size == 0 || size > MaxFrameSize {
+		size = MaxFrameSize
+	}
+	conn.maxFrameSize = size
+}
+
+// SetCompression compress the frames sent by the algorithm negotiated by
+// HELLO, an empty name disable it. The frames received with the compressed
+// flag of the header are decompressed.
+func (conn *Conn) SetCompression(name string) error {
+	if name != "" && !SupportCompression(name) {
+		return ErrUnsupportedCompression
+	}
+	conn.wlocker.Lock()
+	defer conn.wlocker.Unlock()
+	conn.compressor.name = name
+	return nil
+}
+
 // Receive waits for a new message on conn, and receives its payload.
 func (conn *Conn) Receive() (rdata []byte, rerr error) {
 	conn.rlocker.RLock()
@@ -63,9 +95,21 @@ func (conn *Conn) Receive() (rdata []byte, rerr error) {
 		return nil, err
 	}
 
-	length := ParseHeader(header)
+	length, err := ParseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	if length > conn.maxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
 
 	rdata, rerr = conn.receive(length)
+	if rerr == nil && header[0]&flagCompressed != 0 {
+		if !conn.compressor.enabled() {
+			return nil, ErrCompressionNotEnabled
+		}
+		rdata, rerr = conn.compressor.decode(rdata, conn.maxFrameSize)
+	}
 
 	return
 }
@@ -87,10 +131,17 @@ func (conn *Conn) receive(length uint32) ([]byte, error) {
 func (conn *Conn) Send(data []byte) error {
 	conn.wlocker.Lock()
 	defer conn.wlocker.Unlock()
+	var compressed bool
+	if conn.compressor.enabled() {
+		data, compressed = conn.compressor.encode(data)
+	}
 	header, err := MakeHeader(data)
 	if err != nil {
 		return err
 	}
+	if compressed {
+		header[0] |= flagCompressed
+	}
 
 	if err := conn.write(conn.ResponseMagic); err != nil {
 		return err
@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestReceiveFrameTooLarge(t *testing.T) {
+	var server, client = net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	var conn = NewServerConn(server)
+	conn.SetMaxFrameSize(4)
+	go client.Write([]byte("\x00REQ\x7f\xff\xff\xff"))
+	if _, err := conn.Receive(); err != ErrFrameTooLarge {
+		t.Fatalf("Receive: except: %v, got: %v", ErrFrameTooLarge, err)
+	}
+}
+
+// sendFrame capture the frame sent by a client connection
+func sendFrame(data []byte, compression string) []byte {
+	var server, client = net.Pipe()
+	defer server.Close()
+	var conn = NewClientConn(client)
+	conn.SetCompression(compression)
+	go func() {
+		conn.Send(data)
+		client.Close()
+	}()
+	var frame, _ = ioutil.ReadAll(server)
+	return frame
+}
+
+// receiveFrame receive the frame by a server connection
+func receiveFrame(frame []byte, compression string) ([]byte, error) {
+	var server, client = net.Pipe()
+	defer server.Close()
+	var conn = NewServerConn(server)
+	conn.SetCompression(compression)
+	go func() {
+		client.Write(frame)
+		client.Close()
+	}()
+	return conn.Receive()
+}
+
+func TestCompression(t *testing.T) {
+	var data = bytes.Repeat([]byte(`{"workload":"args"}`), 1000)
+	var frame = sendFrame(data, CompressionSnappy)
+	if frame[4]&flagCompressed == 0 || len(frame) >= len(data) {
+		t.Fatalf("Send: the frame is not compressed, got: %d bytes", len(frame))
+	}
+	var got, err = receiveFrame(frame, CompressionSnappy)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Receive: except: %d bytes, got: %d bytes %v", len(data), len(got), err)
+	}
+	if _, err = receiveFrame(frame, ""); err != ErrCompressionNotEnabled {
+		t.Fatalf("Receive: except: %v, got: %v", ErrCompressionNotEnabled, err)
+	}
+
+	if frame = sendFrame([]byte("small"), CompressionSnappy); frame[4]&flagCompressed != 0 {
+		t.Fatalf("Send: the small frame is compressed")
+	}
+	var conn = NewClientConn(nil)
+	if err = conn.SetCompression("gzip"); err != ErrUnsupportedCompression {
+		t.Fatalf("SetCompression: except: %v, got: %v", ErrUnsupportedCompression, err)
+	}
+}
+
+func FuzzReceive(f *testing.F) {
+	f.Add([]byte("\x00REQ\x00\x00\x00\x04data"))
+	f.Add([]byte("\x00REQ\x7f\xff\xff\xff"))
+	f.Add([]byte("\x00RES\x00\x00\x00\x00"))
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		var server, client = net.Pipe()
+		defer server.Close()
+		var conn = NewServerConn(server)
+		conn.SetMaxFrameSize(1024)
+		conn.SetCompression(CompressionSnappy)
+		go func() {
+			client.Write(frame)
+			client.Close()
+		}()
+		data, err := conn.Receive()
+		if err != nil {
+			return
+		}
+		if len(data) > 1024 {
+			t.Fatalf("Receive %q: got: %q", frame, data)
+		}
+		if frame[4]&flagCompressed == 0 && !bytes.HasSuffix(frame[:8+len(data)], data) {
+			t.Fatalf("Receive %q: got: %q", frame, data)
+		}
+	})
+}
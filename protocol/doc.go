@@ -46,7 +46,12 @@ header is:
                           for responses.
 
     4 byte size         - A big-endian (network-order) integer containing
-                          the size of the data being sent.
+                          the size of the data being sent. The server reject
+                          the data larger than the max frame size (default
+                          64MB, periodic --max-frame-size) before reading it.
+                          The top bit is set when the data is compressed by
+                          the compression negotiated by HELLO, the size is
+                          the one of the compressed data.
 
     ? byte  message id  - A client unique message id.
     1 byte  command     - A big-endian (network-order) integer containing
@@ -71,11 +76,90 @@ header is:
                         15  DROP_FUNC     Client
                         16  SUCCESS       Client/Worker
                         17  REMOVE_JOB    Client
+                        18  DUMP          Client
+                        19  LOAD          Client
+                        20  SUBMIT_JOBS   Client
+                        21  REMOVE_JOBS   Client
+                        22  UPDATE_JOB    Client
+                        23  HISTORY       Client
+                        24  SUBSCRIBE     Client
+                        25  UNSUBSCRIBE   Client
+                        26  EVENT         Client
+                        27  SET_WEBHOOK   Client
+                        28  REMOVE_WEBHOOK Client
+                        29  WEBHOOK       Client
+                        30  LOG_LEVEL     Client
+                        31  GET_JOB       Client
+                        32  LIST_JOBS     Client
+                        33  AUTH          Client/Worker
+                        34  HELLO         Client/Worker
+                        35  ERROR         Client/Worker
+                        36  GRAB_JOBS     Worker
+                        37  JOB_ASSIGNS   Worker
 
 
 Arguments given in the data part are separated by a NULL byte.
 
 
+## Handshake
+
+The first packet of a connection holds the client type byte, 1 for a
+client and 2 for a worker, optionally followed by the namespace of the
+connection, 1 to 64 letters, digits, "_", "." or "-". The jobs, the funcs and
+the events of the other namespaces are invisible to the connection. Without
+the namespace the connection is in the "default" namespace, the server reply
+an error and close the connection on an invalid one. When the server requires the authentication, the
+next packet must be an AUTH request, the server close the connection on any
+other packet or on a rejected token. On a TLS listener, a client certificate
+verified by the server CAs authenticate the connection and the AUTH is not
+required.
+
+A client may then send a HELLO to negotiate the protocol version and the
+capabilities of the connection. The capabilities are:
+
+    results     - The WORK_DONE and WORK_FAIL carry the result data, the
+                  data is ignored without it.
+    heartbeats  - The client send a packet, eg: PING, at least every
+                  heartbeat, the server close the connection silent for
+                  three heartbeats.
+    batch       - The SUBMIT_JOBS, REMOVE_JOBS and GRAB_JOBS, they are UNKNOWN
+                  without it.
+    errors      - The failed requests are replied with an ERROR, see below.
+
+A connection without HELLO is protocol version 1 with the capabilities
+results and batch, so the older clients keep working.
+
+The HELLO may ask the compression of the frames too, the server choose the
+first one of the client supported. The only one is "snappy". The HELLO
+response is sent plain, the frames after it of both sides larger than 1KB may
+be compressed and have the top bit of the size set. A compressed frame on a
+connection without the compression is an error.
+
+With errors negotiated, a failed request is replied with an ERROR carrying
+the message id of the request, the error code and the message, and the
+connection is kept unless told otherwise. A malformed packet is a BAD_REQUEST
+with an empty message id, and a bad frame, eg: a wrong magic code or a frame
+too large, close the connection after the ERROR as the stream can not be read
+on. Without errors, the legacy connections get the error message alone as the
+reply of a client request or a GRAB_JOB, no reply for the worker requests
+without a response, eg: a WORK_DONE of a job not assigned to the worker, and
+no reply for a bad frame. The errors of the handshake, eg: a rejected AUTH or
+an invalid namespace, are sent before HELLO and are the error message alone.
+The codes follow the HTTP status codes of the REST API:
+
+    Code  Name             Meaning
+    400   BAD_REQUEST      The request is invalid, eg: a malformed payload.
+    401   UNAUTHORIZED     The token is missing or rejected.
+    403   FORBIDDEN        The identity is not granted the role on the func.
+    404   NOT_FOUND        The job or the func is not exists.
+    409   CONFLICT         The request conflict with the state of the job or
+                           the func, eg: the job is processing or the revision
+                           is changed.
+    413   FRAME_TOO_LARGE  The frame is larger than the max frame size.
+    429   QUOTA_EXCEEDED   The namespace reached a limit of the quota.
+    500   INTERNAL         The server failed to handle the request.
+
+
 ## Client/Worker Requests
 
 These request types may be sent by either a client or a worker:
@@ -89,6 +173,38 @@ These request types may be sent by either a client or a worker:
         Arguments:
         - None.
 
+    AUTH
+
+        Authenticate the connection right after the client type byte. The
+        token is a static token or a signed token
+        "identity.expires_at.signature", the signature is the hex HMAC-SHA256
+        of "identity.expires_at" by the server secret, expires_at 0 never
+        expire. The server respond with SUCCESS, or an error and close the
+        connection. An AUTH on a server without the authentication is a
+        SUCCESS too.
+
+        Arguments:
+        - The token.
+
+    HELLO
+
+        Negotiate the protocol version and the capabilities, once per
+        connection. The server respond with HELLO and the lower version of
+        both sides, the capabilities supported by both sides, and the
+        heartbeat interval accepted in seconds (default 30, max 300) when
+        heartbeats is negotiated, and the compression chosen:
+
+        {"version": 1, "agent": "periodic/0.1.7",
+         "capabilities": ["results", "heartbeats", "errors"], "heartbeat": 30,
+         "compression": ["snappy"]}
+
+        Arguments:
+        - JSON byte object: {"version": 1, "agent": "aio_periodic/0.2.0",
+          "capabilities": ["results", "heartbeats", "batch", "errors"],
+          "heartbeat": 30, "compression": ["zstd", "snappy"]}. The agent is
+          the library name/version, the compression is in the order of
+          preference.
+
 
 ## Client/Worker Responses
 
@@ -101,6 +217,15 @@ These response types may be sent to either a client or a worker:
         Arguments:
         - None.
 
+    ERROR
+
+        This is sent in response to a failed request when errors is
+        negotiated.
+
+        Arguments:
+        - The error code.
+        - NULL byte terminated message.
+
 ## Client Requests
 
 These request types may only be sent by a client:
@@ -109,7 +234,9 @@ These request types may only be sent by a client:
 
         A client issues one of these when a job needs to be run. The
         server will then assign a job handle and respond with a SUCCESS
-        packet.
+        packet. The job can carry the W3C trace context of the submitter
+        in traceparent and tracestate, then the server record the
+        enqueue wait, dispatch and execution spans of every run.
 
         Arguments:
         - JSON byte job object.
@@ -122,8 +249,17 @@ These request types may only be sent by a client:
 
         FUNCTION,TOTAL_WORKER,TOTAL_JOB,PROCESSING_JOB
 
+        With the argument "extended", the rolling p50, p95 and p99 of the
+        schedule lag and the execution time in seconds over the last 5
+        minutes, and the done and failure jobs per minute over the last 1, 5
+        and 15 minutes are appended:
+
+        FUNCTION,TOTAL_WORKER,TOTAL_JOB,PROCESSING_JOB,
+        LAG_P50,LAG_P95,LAG_P99,RUN_P50,RUN_P95,RUN_P99,
+        DONE_1M,DONE_5M,DONE_15M,FAILURE_1M,FAILURE_5M,FAILURE_15M
+
         Arguments:
-        - None.
+        - "extended". Optional, only the counters when it is empty.
 
     DROP_FUNC
 
@@ -155,6 +291,141 @@ These request types may only be sent by a client:
         Arguments:
         - None.
 
+    SUBMIT_JOBS
+
+        Submit a batch of jobs at once. The server respond with a JSON
+        object holding the result of each job in the same order:
+
+        {"results": [{"job_id": 1}, {"err": "..."}]}
+
+        Arguments:
+        - JSON byte object: {"jobs": [job object, ...]}.
+
+    REMOVE_JOBS
+
+        Remove a batch of jobs at once. The server respond with the same
+        JSON results as SUBMIT_JOBS.
+
+        Arguments:
+        - JSON byte object: {"jobs": [job object, ...]}.
+
+    UPDATE_JOB
+
+        Change only the supplied fields of an exists job, the job is found
+        by job_id or by func and name. The status and the schedule of the
+        job is kept, unless sched_at or period is supplied. When revision
+        is supplied, it must equal the stored revision of the job, otherwise
+        the update is rejected with a conflict error. The server respond
+        with the updated JSON byte job object holding the new revision.
+
+        Arguments:
+        - JSON byte object: {"job_id": 1, "revision": 2, "timeout": 10}.
+
+    HISTORY
+
+        Ask the execution records of a job by job_id or by func and name, or
+        the execution records of a func, newest first. Each record holds the
+        job_id, func, name, attempt, worker, assigned_at, finished_at,
+        outcome (done, fail, sched_later or timeout), duration in
+        milliseconds, and the result or error. The server respond with:
+
+        {"history": [record, ...]}
+
+        Arguments:
+        - JSON byte object: {"func": "f", "name": "n", "limit": 20}.
+
+    SUBSCRIBE
+
+        Subscribe the live scheduler events, the server respond with a
+        SUCCESS packet, then push an EVENT packet with the same message id
+        for every matched event. An empty funcs or types match all. The
+        event types are: submitted, assigned, done, failed, timeout,
+        rescheduled, removed, paused, resumed, expired, dead_lettered,
+        worker_connected and worker_disconnected. A new SUBSCRIBE replace
+        the old one.
+
+        Arguments:
+        - JSON byte object: {"funcs": ["f"], "types": ["done", "failed"]}.
+          Optional.
+
+    UNSUBSCRIBE
+
+        Stop the live scheduler events, and respond with a SUCCESS packet.
+
+        Arguments:
+        - None.
+
+    SET_WEBHOOK
+
+        Set the webhook of a function, and respond with a SUCCESS packet.
+        The server POST a JSON body {"id": delivery id, "event": event
+        object} to the url when a job of the function is done, failed
+        without retry, timeout or dead_lettered. The events can be limited
+        by events. The body is signed with HMAC-SHA256 by the secret, or by
+        the default secret of the server, and the hex digest is sent in the
+        X-Periodic-Signature header as "sha256=<digest>". A failed delivery
+        is retried with exponential backoff. A job can also hold its own
+        webhook url in the webhook field, which is signed by the default
+        secret.
+
+        Arguments:
+        - JSON byte object: {"func": "f", "url": "http://...",
+          "secret": "s", "events": ["failed", "dead_lettered"]}.
+
+    REMOVE_WEBHOOK
+
+        Remove the webhook of a function, and respond with a SUCCESS packet.
+
+        Arguments:
+        - Function name.
+
+    WEBHOOK
+
+        Ask the webhook of a function and the delivery log, newest first.
+        The server respond with:
+
+        {"webhook": webhook object, "deliveries": [delivery, ...]}
+
+        Arguments:
+        - JSON byte object: {"func": "f", "limit": 20}.
+
+    LOG_LEVEL
+
+        Change the log level of a subsystem (sched, protocol, driver, http
+        or trace) at runtime, an empty subsystem change all subsystems. The
+        levels are: debug, info, warn and error. The server respond with
+        the current levels:
+
+        {"levels": {"sched": "debug", "driver": "info"}}
+
+        Arguments:
+        - JSON byte object: {"subsystem": "sched", "level": "debug"}.
+          Optional, only ask the levels when it is empty.
+
+    GET_JOB
+
+        Ask a job by job_id or by func and name. The server respond with the
+        job object, or an error when the job is not exists.
+
+        Arguments:
+        - JSON byte object: {"job_id": 1} or {"func": "f", "name": "n"}.
+
+    LIST_JOBS
+
+        List the jobs ordered by job_id, filtered by func, status (ready,
+        processing or paused) and name prefix. A page holds at most limit
+        (default 100, max 1000) jobs after the cursor job_id. The server
+        respond with:
+
+        {"jobs": [job, ...], "next_cursor": 100}
+
+        The next_cursor is the cursor of the next page, it is omitted on the
+        last page.
+
+        Arguments:
+        - JSON byte object: {"func": "f", "status": "processing",
+          "prefix": "n", "cursor": 0, "limit": 100}. Optional.
+
 
 
 ## Client Responses
@@ -170,6 +441,14 @@ These response types may only be sent to a client:
         Arguments:
         - None.
 
+    EVENT
+
+        This is pushed to a client subscribed the scheduler events.
+
+        Arguments:
+        - JSON byte event object: {"type": "done", "job_id": 1,
+          "func": "f", "name": "n", "worker": "worker#1", "at": 1}.
+
 
 ## Worker Requests
 
@@ -196,7 +475,9 @@ These request types may only be sent by a worker:
 
         This is sent to notify the server that the worker is about to
         sleep, and that it should be woken up with a NOOP packet if a
-        job comes in for a function the worker is able to perform.
+        job comes in for a function the worker is able to perform. The
+        NOOP carry the message id of the SLEEP, it is sent at once when a
+        job is already waiting.
 
         Arguments:
         - None.
@@ -204,11 +485,27 @@ These request types may only be sent by a worker:
     GRAB_JOB
 
         This is sent to the server to request any available jobs on the
-        queue. The server will respond with either NO_JOB or JOB_ASSIGN,
-        depending on whether a job is available.
+        queue. The server will respond with JOB_ASSIGN when a job is
+        available. Without the wait timeout the request wait for a job
+        forever, with it the server respond with NO_JOB when no job is
+        assigned in the timeout, so the worker can tell a dead server from
+        an empty queue.
 
         Arguments:
-        - None.
+        - Optional wait timeout in seconds.
+
+    GRAB_JOBS
+
+        Like GRAB_JOB, but request at most size jobs of the functions the
+        worker is able to perform in one JOB_ASSIGNS. The server wait for
+        one job at least, and assign the other jobs already due, at most
+        100 jobs. The jobs are either all assigned or none. The server
+        started with --max-in-flight assign a worker at most the max jobs
+        processing at once, for GRAB_JOB and GRAB_JOBS alike.
+
+        Arguments:
+        - The size.
+        - Optional wait timeout in seconds.
 
     WORK_DONE
 
@@ -217,13 +514,16 @@ These request types may only be sent by a worker:
         Arguments:
         - NULL byte terminated job handle.
         - Opaque data that is returned to the client as a response.
+          Optional, kept as the result of the execution record.
 
     WORK_FAIL
 
         This is to notify the server that the job failed.
 
         Arguments:
-        - Job handle.
+        - NULL byte terminated job handle.
+        - The error message. Optional, kept as the error of the execution
+          record.
 
     SCHED_LATER
 
@@ -248,8 +548,9 @@ These response types may only be sent to a worker:
 
     NO_JOB
 
-        This is given in response to a GRAB_JOB request to notify the
-        worker there are no pending jobs that need to run.
+        This is given in response to a GRAB_JOB request with the wait
+        timeout to notify the worker there are no pending jobs that need to
+        run in the timeout.
 
         Arguments:
         - None.
@@ -260,10 +561,21 @@ These response types may only be sent to a worker:
         information needed to run the job. All communication about the
         job (such as status updates and completion response) should use
         the handle, and the worker should run the given function with
-        the argument.
+        the argument. The traceparent of a traced job is the execution
+        span of the run, the worker should use it as the parent of its
+        spans.
 
         Arguments:
         - JSON byte job object.
 
+    JOB_ASSIGNS
+
+        This is given in response to a GRAB_JOBS request to give the worker
+        the jobs, each job is like the one of JOB_ASSIGN and the job_id is
+        the handle.
+
+        Arguments:
+        - JSON byte object: {"jobs": [job object, ...]}.
+
 */
 package protocol
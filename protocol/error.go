@@ -0,0 +1,59 @@
+package protocol
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// ErrorCode defined the code of an ERROR response, the codes follow the HTTP
+// status codes of the REST API.
+type ErrorCode int
+
+const (
+	// CodeBadRequest the request is invalid
+	CodeBadRequest ErrorCode = 400
+	// CodeUnauthorized the token is missing or rejected
+	CodeUnauthorized ErrorCode = 401
+	// CodeForbidden the identity is not granted the role
+	CodeForbidden ErrorCode = 403
+	// CodeNotFound the job or the func is not exists
+	CodeNotFound ErrorCode = 404
+	// CodeConflict the request conflict with the state of the job or the func
+	CodeConflict ErrorCode = 409
+	// CodeFrameTooLarge the frame is larger than the max frame size
+	CodeFrameTooLarge ErrorCode = 413
+	// CodeQuotaExceeded the namespace reached a limit of the quota
+	CodeQuotaExceeded ErrorCode = 429
+	// CodeInternal the server failed to handle the request
+	CodeInternal ErrorCode = 500
+)
+
+// Error defined the data of an ERROR response
+type Error struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// Bytes encode the error to the code and the message separated by NullChar
+func (e Error) Bytes() []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(strconv.Itoa(int(e.Code)))
+	buf.Write(NullChar)
+	buf.WriteString(e.Message)
+	return buf.Bytes()
+}
+
+// ParseError parse the data of an ERROR response
+func ParseError(data []byte) (e Error) {
+	parts := bytes.SplitN(data, NullChar, 2)
+	code, _ := strconv.Atoi(string(parts[0]))
+	e.Code = ErrorCode(code)
+	if len(parts) == 2 {
+		e.Message = string(parts[1])
+	}
+	return
+}
@@ -0,0 +1,17 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	var e = Error{Code: CodeNotFound, Message: "Job not exists."}
+	var data = e.Bytes()
+	if string(data) != "404\x00\x01Job not exists." {
+		t.Fatalf("Error: got: %q", data)
+	}
+	var got = ParseError(data)
+	if got != e {
+		t.Fatalf("ParseError: except: %+v, got: %+v", e, got)
+	}
+}
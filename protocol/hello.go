@@ -0,0 +1,95 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Version the protocol version, negotiated by HELLO
+const Version = 1
+
+// ErrUnsupportedVersion the HELLO ask a protocol version not supported
+var ErrUnsupportedVersion = errors.New("Unsupported protocol version.")
+
+// Capability defined an optional feature of a connection, negotiated by HELLO.
+type Capability string
+
+const (
+	// CapResults the WORK_DONE and WORK_FAIL carry the result data
+	CapResults Capability = "results"
+	// CapHeartbeats the connection is closed when it is silent for three heartbeats
+	CapHeartbeats Capability = "heartbeats"
+	// CapBatch the SUBMIT_JOBS, REMOVE_JOBS and GRAB_JOBS
+	CapBatch Capability = "batch"
+	// CapErrors the errors are replied by ERROR with a code, the legacy
+	// connections get the error message alone
+	CapErrors Capability = "errors"
+)
+
+// LegacyCapabilities the capabilities of the connections without HELLO
+var LegacyCapabilities = []Capability{CapResults, CapBatch}
+
+// Hello defined the HELLO request and response
+type Hello struct {
+	Version      int          `json:"version"`             // The protocol version
+	Agent        string       `json:"agent,omitempty"`     // The library name/version, eg: aio_periodic/0.2.0
+	Capabilities []Capability `json:"capabilities"`        // The capabilities supported
+	Heartbeat    int          `json:"heartbeat,omitempty"` // The heartbeat interval in seconds
+
+	// The compression algorithms supported in the order of preference, the
+	// response hold the one chosen.
+	Compression []string `json:"compression,omitempty"`
+}
+
+// NewHello create a Hello from json bytes
+func NewHello(payload []byte) (hello Hello, err error) {
+	if err = json.Unmarshal(payload, &hello); err != nil {
+		return
+	}
+	if hello.Version < 1 {
+		err = ErrUnsupportedVersion
+	}
+	return
+}
+
+// Bytes encode hello to json bytes
+func (h Hello) Bytes() (data []byte) {
+	data, _ = json.Marshal(h)
+	return
+}
+
+// Has check the capability is in the hello
+func (h Hello) Has(c Capability) bool {
+	for _, c1 := range h.Capabilities {
+		if c1 == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate the features of a connection by the supported ones, the result
+// hold the lower version, the capabilities supported by both sides and the
+// first compression of h supported.
+func (h Hello) Negotiate(supported Hello) (result Hello) {
+	result.Version = supported.Version
+	if h.Version < result.Version {
+		result.Version = h.Version
+	}
+	result.Agent = supported.Agent
+	result.Capabilities = make([]Capability, 0, len(supported.Capabilities))
+	for _, c := range supported.Capabilities {
+		if h.Has(c) {
+			result.Capabilities = append(result.Capabilities, c)
+		}
+	}
+	for _, c := range h.Compression {
+		for _, c1 := range supported.Compression {
+			if c == c1 {
+				result.Compression = []string{c}
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestNewHello(t *testing.T) {
+	var hello, err = NewHello([]byte(`{"version":2,"agent":"aio_periodic/0.2.0","capabilities":["batch","results"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hello.Version != 2 || hello.Agent != "aio_periodic/0.2.0" || !hello.Has(CapBatch) || hello.Has(CapHeartbeats) {
+		t.Fatalf("NewHello: got: %+v", hello)
+	}
+
+	if _, err = NewHello([]byte(`{"capabilities":["batch"]}`)); err != ErrUnsupportedVersion {
+		t.Fatalf("NewHello: except: %v, got: %v", ErrUnsupportedVersion, err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	var supported = Hello{
+		Version:      1,
+		Agent:        "periodic/0.1.7",
+		Capabilities: []Capability{CapResults, CapHeartbeats, CapBatch},
+	}
+	var hello = Hello{Version: 2, Capabilities: []Capability{"compression", CapBatch, CapResults}}
+	var result = hello.Negotiate(supported)
+	if result.Version != 1 || result.Agent != supported.Agent {
+		t.Fatalf("Negotiate: got: %+v", result)
+	}
+	if len(result.Capabilities) != 2 || result.Capabilities[0] != CapResults || result.Capabilities[1] != CapBatch {
+		t.Fatalf("Negotiate: except: [results batch], got: %v", result.Capabilities)
+	}
+	if len(result.Compression) != 0 {
+		t.Fatalf("Negotiate: except no compression, got: %v", result.Compression)
+	}
+
+	supported.Compression = Compressions
+	hello.Compression = []string{"zstd", CompressionSnappy}
+	result = hello.Negotiate(supported)
+	if len(result.Compression) != 1 || result.Compression[0] != CompressionSnappy {
+		t.Fatalf("Negotiate: except: [snappy], got: %v", result.Compression)
+	}
+}
@@ -3,25 +3,38 @@ package protocol
 import (
 	"bytes"
 	"errors"
-	"fmt"
 )
 
 // Split the message payload
 var NullChar = []byte("\x00\x01")
 
+var (
+	// ErrInvalidCommand the payload is not msgID, cmd and data separated by NullChar
+	ErrInvalidCommand = errors.New("Invalid command.")
+	// ErrInvalidHeader the header is not 4 bytes
+	ErrInvalidHeader = errors.New("Invalid header.")
+	// ErrFrameTooLarge the frame is larger than the max frame size
+	ErrFrameTooLarge = errors.New("Frame too large.")
+)
+
 // ParseCommand payload to extract msgID cmd and data
-func ParseCommand(payload []byte) (msgID []byte, cmd Command, data []byte) {
+func ParseCommand(payload []byte) (msgID []byte, cmd Command, data []byte, err error) {
 	parts := bytes.SplitN(payload, NullChar, 3)
 	partSize := len(parts)
-	var err = fmt.Errorf("InvalID %v\n", payload)
 	if partSize <= 1 {
-		panic(err)
+		err = ErrInvalidCommand
+		return
 	}
 	msgID = parts[0]
 	if partSize == 2 && len(parts[1]) != 1 {
 		cmd = UNKNOWN
 		data = parts[1]
 	} else {
+		if len(parts[1]) == 0 {
+			msgID = nil
+			err = ErrInvalidCommand
+			return
+		}
 		cmd = Command(parts[1][0])
 		if partSize == 3 && len(parts[2]) > 0 {
 			data = parts[2]
@@ -37,8 +50,8 @@ func MakeHeader(data []byte) ([]byte, error) {
 
 	length := uint32(len(data))
 
-	if length > 0x7fffffff {
-		return nil, errors.New("Data too large")
+	if length > MaxFrameSize {
+		return nil, ErrFrameTooLarge
 	}
 
 	header[0] = byte((length >> 24) & 0xff)
@@ -50,9 +63,12 @@ func MakeHeader(data []byte) ([]byte, error) {
 }
 
 // ParseHeader extract the pack header by MakeHeader
-func ParseHeader(header []byte) uint32 {
+func ParseHeader(header []byte) (uint32, error) {
+	if len(header) != 4 {
+		return 0, ErrInvalidHeader
+	}
 	length := uint32(header[0])<<24 | uint32(header[1])<<16 | uint32(header[2])<<8 | uint32(header[3])
 	length = length & ^uint32(0x80000000)
 
-	return length
+	return length, nil
 }
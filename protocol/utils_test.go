@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 )
@@ -13,34 +14,68 @@ func TestHeader(t *testing.T) {
 		t.Fatal(err)
 	}
 	fmt.Printf("%v\n", header)
-	var lengthGot = ParseHeader(header)
+	var lengthGot, _ = ParseHeader(header)
 
 	if lengthGot != length {
 		t.Fatalf("Header: except: %d, got: %d", length, lengthGot)
 	}
-}
 
-func testPanic() {
-	x := recover()
-	if x == nil {
-		panic("there no panic")
+	if _, err = ParseHeader([]byte("abc")); err != ErrInvalidHeader {
+		t.Fatalf("ParseHeader: except: %v, got: %v", ErrInvalidHeader, err)
 	}
-	fmt.Printf("panic %s\n", x)
 }
 
 func TestParseCommand(t *testing.T) {
 	var pack = []byte("100\x00\x01\x01\x00\x01hhcc")
-	var msgID, cmd, data = ParseCommand(pack)
+	var msgID, cmd, data, err = ParseCommand(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Printf("%d, %d, %s\n", msgID, cmd, data)
 }
 
-func TestParseCommandPanic1(t *testing.T) {
+func TestParseCommandUnknown(t *testing.T) {
 	var pack = []byte("100\x00\x01")
-	ParseCommand(pack)
+	var _, cmd, _, err = ParseCommand(pack)
+	if err != nil || cmd != UNKNOWN {
+		t.Fatalf("ParseCommand: except: UNKNOWN, got: %v %v", cmd, err)
+	}
+}
+
+func TestParseCommandInvalid(t *testing.T) {
+	for _, pack := range [][]byte{[]byte("100"), []byte("100\x00\x01\x00\x01hhcc"), nil} {
+		if _, _, _, err := ParseCommand(pack); err != ErrInvalidCommand {
+			t.Fatalf("ParseCommand %q: except: %v, got: %v", pack, ErrInvalidCommand, err)
+		}
+	}
+}
+
+func FuzzParseCommand(f *testing.F) {
+	f.Add([]byte("100\x00\x01\x01\x00\x01hhcc"))
+	f.Add([]byte("100\x00\x01"))
+	f.Add([]byte("100\x00\x01\x00\x01"))
+	f.Fuzz(func(t *testing.T, pack []byte) {
+		msgID, cmd, data, err := ParseCommand(pack)
+		if err != nil {
+			return
+		}
+		if !bytes.HasPrefix(pack, append(msgID, NullChar...)) || !bytes.HasSuffix(pack, data) {
+			t.Fatalf("ParseCommand %q: got: %q %v %q", pack, msgID, cmd, data)
+		}
+	})
 }
 
-func TestParseCommandPanic2(t *testing.T) {
-	defer testPanic()
-	var pack = []byte("100")
-	ParseCommand(pack)
+func FuzzParseHeader(f *testing.F) {
+	f.Add(uint32(4))
+	f.Add(uint32(MaxFrameSize))
+	f.Fuzz(func(t *testing.T, length uint32) {
+		var header = []byte{byte(length >> 24), byte(length >> 16), byte(length >> 8), byte(length)}
+		var got, err = ParseHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != length&MaxFrameSize {
+			t.Fatalf("ParseHeader: except: %d, got: %d", length&MaxFrameSize, got)
+		}
+	})
 }
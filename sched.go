@@ -1,11 +1,11 @@
 package periodic
 
 import (
-	"bytes"
 	"container/heap"
+	"crypto/tls"
 	"io"
-	"log"
 	"net"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +15,7 @@ import (
 	"github.com/jmuyuyang/periodic/protocol"
 	"github.com/jmuyuyang/periodic/queue"
 	"github.com/jmuyuyang/periodic/stat"
+	"github.com/jmuyuyang/periodic/trace"
 )
 
 // Sched defined periodic schedule
@@ -33,9 +34,48 @@ type Sched struct {
 	driver       driver.StoreDriver
 	jobPQ        map[string]*queue.PriorityQueue
 	PQLocker     *sync.Mutex
+	// expirePQ the ready jobs by the expire time, expireItems index it by
+	// job id, they are guarded by PQLocker.
+	expirePQ     queue.PriorityQueue
+	expireItems  map[int64]*queue.Item
 	timeout      time.Duration
 	alive        bool
 	cacheItem    *queue.Item
+	events       *eventBus
+	assigns      map[int64]assignment
+	webhooks     *webhookNotifier
+	tracer       *trace.Exporter
+	conns        map[string]*stat.Counter
+	workers      map[string]*worker
+	workerLocker *sync.Mutex
+	// auth authenticate the connections, nil when it is disabled
+	auth *authenticator
+	// tlsConfig serve the TCP listeners over TLS, nil when it is disabled
+	tlsConfig *tls.Config
+	tlsCerts  *tlsCerts
+	// acl authorize the identities, nil allow everything
+	acl acl
+	// quotas limit the namespaces, nil is unlimited
+	quotas      map[string]quota
+	limiters    map[string]*rateLimiter
+	quotaLocker *sync.Mutex
+	// httpEntryPoint the listen address of the REST API
+	httpEntryPoint string
+	httpServer     *http.Server
+	// retentionInterval how often the retention sweeper run
+	retentionInterval time.Duration
+	historyJobLimit   int
+	historyFuncLimit  int
+	// archiveRetention how long the archived jobs are kept, zero is forever
+	archiveRetention time.Duration
+	// maxFrameSize the max frame size received from the connections
+	maxFrameSize uint32
+	// workerMaxInFlight the max jobs processing at once per worker, zero is unlimited
+	workerMaxInFlight int
+	// blobs store the large args offloaded from the jobs, nil when disabled
+	blobs driver.BlobStore
+	// blobThreshold the args larger than it are offloaded, zero is never
+	blobThreshold int
 }
 
 // NewSched create an instance of periodic schedule
@@ -54,14 +94,100 @@ func NewSched(entryPoint string, store driver.StoreDriver, timeout time.Duration
 	sched.funcLocker = new(sync.Mutex)
 	sched.timerLocker = new(sync.Mutex)
 	sched.stats = make(map[string]*stat.FuncStat)
-	sched.driver = store
+	sched.driver = newMetricsDriver(store)
 	sched.jobPQ = make(map[string]*queue.PriorityQueue)
+	sched.expirePQ = make(queue.PriorityQueue, 0)
+	heap.Init(&sched.expirePQ)
+	sched.expireItems = make(map[int64]*queue.Item)
 	sched.timeout = timeout
 	sched.alive = true
 	sched.cacheItem = nil
+	sched.events = newEventBus()
+	sched.retentionInterval = time.Minute
+	sched.assigns = make(map[int64]assignment)
+	sched.historyJobLimit = 100
+	sched.historyFuncLimit = 1000
+	sched.webhooks = newWebhookNotifier(sched)
+	sched.conns = make(map[string]*stat.Counter)
+	sched.workers = make(map[string]*worker)
+	sched.workerLocker = new(sync.Mutex)
+	sched.limiters = make(map[string]*rateLimiter)
+	sched.quotaLocker = new(sync.Mutex)
+	sched.maxFrameSize = protocol.DefaultMaxFrameSize
+	for _, typ := range connTypes {
+		sched.conns[typ] = stat.NewCounter(0)
+	}
 	return sched
 }
 
+// SetRetentionInterval set how often the overdue jobs are expired
+func (sched *Sched) SetRetentionInterval(d time.Duration) {
+	sched.retentionInterval = d
+}
+
+// SetArchiveRetention set how long the archived jobs are kept, zero keep them
+// forever.
+func (sched *Sched) SetArchiveRetention(d time.Duration) {
+	sched.archiveRetention = d
+}
+
+// SetWorkerMaxInFlight set the max jobs processing at once per worker, zero
+// is unlimited.
+func (sched *Sched) SetWorkerMaxInFlight(max int) {
+	sched.workerMaxInFlight = max
+}
+
+// SetMaxFrameSize set the max frame size in bytes received from the
+// connections, zero is the largest frame of the protocol.
+func (sched *Sched) SetMaxFrameSize(size uint32) {
+	sched.maxFrameSize = size
+}
+
+// SetBlobStore read the args offloaded to the blobs and remove them with the
+// jobs, the args larger than threshold bytes are offloaded, zero offload
+// nothing. It must be called before Serve.
+func (sched *Sched) SetBlobStore(blobs driver.BlobStore, threshold int) {
+	sched.blobs = blobs
+	sched.blobThreshold = threshold
+	if store, ok := sched.driver.(*metricsDriver); ok {
+		store.StoreDriver = driver.NewBlobDriver(store.StoreDriver, blobs, threshold)
+	} else {
+		sched.driver = driver.NewBlobDriver(sched.driver, blobs, threshold)
+	}
+}
+
+// loadArgs fetch the args of the job offloaded to the blob store
+func (sched *Sched) loadArgs(job driver.Job) (driver.Job, error) {
+	return driver.LoadArgs(sched.blobs, job)
+}
+
+// offloadArgs move the large args of the job to a new blob before the
+// jobLocker is held, the blob may be large. The blob returned is removed by
+// removeBlob when the job is not saved.
+func (sched *Sched) offloadArgs(job *driver.Job) (string, error) {
+	if sched.blobs == nil || sched.blobThreshold <= 0 || len(job.Args) <= sched.blobThreshold {
+		return "", nil
+	}
+	if err := driver.OffloadArgs(sched.blobs, job); err != nil {
+		return "", err
+	}
+	return job.Blob, nil
+}
+
+// removeBlob remove the blob offloaded by offloadArgs for a job not saved
+func (sched *Sched) removeBlob(blob string) {
+	if blob != "" {
+		sched.blobs.DeleteBlob(blob)
+	}
+}
+
+// argsChanged check the job is updated or removed since its args is loaded,
+// the caller must hold the jobLocker.
+func (sched *Sched) argsChanged(job driver.Job) bool {
+	current, err := sched.driver.Get(job.ID)
+	return err != nil || current.Revision != job.Revision || current.Blob != job.Blob
+}
+
 // Serve of periodic
 func (sched *Sched) Serve() {
 	parts := strings.SplitN(sched.entryPoint, "://", 2)
@@ -73,19 +199,24 @@ func (sched *Sched) Serve() {
 	sched.loadJobQueue()
 	go sched.handleJobPQ()
 	go sched.handleRevertPQ()
+	go sched.handleRetention()
+	go sched.webhooks.run()
+	if sched.httpEntryPoint != "" {
+		go sched.serveHTTP()
+	}
 	listen, err := net.Listen(parts[0], parts[1])
 	if err != nil {
-		log.Fatal(err)
+		schedLog.Fatal("Listen failed", "entry_point", sched.entryPoint, "err", err)
 	}
 	defer listen.Close()
-	log.Printf("Periodic task system started on %s\n", sched.entryPoint)
+	schedLog.Info("Periodic task system started", "entry_point", sched.entryPoint)
 	for {
 		if !sched.alive {
 			break
 		}
 		conn, err := listen.Accept()
 		if err != nil {
-			log.Fatal(err)
+			schedLog.Fatal("Accept failed", "err", err)
 		}
 		if sched.timeout > 0 {
 			conn.SetDeadline(time.Now().Add(sched.timeout * time.Second))
@@ -95,6 +226,9 @@ func (sched *Sched) Serve() {
 			kaConn.SetKeepAliveIdle(30 * time.Second)
 			kaConn.SetKeepAliveCount(4)
 			kaConn.SetKeepAliveInterval(5 * time.Second)
+			if sched.tlsConfig != nil {
+				conn = tls.Server(conn, sched.tlsConfig)
+			}
 		}
 		go sched.handleConnection(conn)
 	}
@@ -121,42 +255,91 @@ func (sched *Sched) resetRevertTimer(d time.Duration) {
 }
 
 func (sched *Sched) handleConnection(conn net.Conn) {
+	// identity the verified client certificate authenticate the connection
+	var identity string
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if sched.timeout == 0 {
+			tlsConn.SetDeadline(time.Now().Add(authTimeout))
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			protoLog.Warn("TLS handshake failed", "remote", conn.RemoteAddr().String(), "err", err)
+			conn.Close()
+			return
+		}
+		if sched.timeout == 0 {
+			tlsConn.SetDeadline(time.Time{})
+		}
+		state := tlsConn.ConnectionState()
+		identity = certIdentity(&state)
+	}
 	c := protocol.NewServerConn(conn)
+	c.SetMaxFrameSize(sched.maxFrameSize)
+	// the client type and the AUTH packet are read in the authTimeout
+	authDeadline := sched.auth != nil && sched.timeout == 0
+	if authDeadline {
+		c.SetReadDeadline(time.Now().Add(authTimeout))
+	}
 	payload, err := c.Receive()
-	if len(payload) == 4 {
-		if bytes.Contains([]byte("GET ,POST,DELETE,PUT "), payload) {
-			httpclient := newHTTPClient(sched, c)
-			httpclient.handle(payload)
-		} else {
-			log.Printf("Unsupport protocol %v\n", payload)
-			c.Close()
-		}
-		return
+	if err == nil && len(payload) == 0 {
+		err = protocol.ErrInvalidCommand
 	}
 	if err != nil {
 		if err != io.EOF {
-			log.Printf("Connection Error: %v, %v\n", err, payload)
+			protoLog.Warn("Connection error", "err", err)
 			c.Close()
 		}
 		return
 	}
+	if sched.auth != nil && identity == "" {
+		identity, err = sched.authenticateConn(c)
+		if err != nil {
+			protoLog.Warn("Authentication failed", "remote", conn.RemoteAddr().String(), "err", err)
+			return
+		}
+	}
+	if authDeadline {
+		c.SetReadDeadline(time.Time{})
+	}
+	if identity != "" {
+		protoLog.Debug("Authenticated", "identity", identity)
+	}
+	ns := driver.DefaultNamespace
+	if len(payload) > 1 {
+		ns = string(payload[1:])
+	}
+	if !validNamespace(ns) {
+		protoLog.Warn("Invalid namespace", "remote", conn.RemoteAddr().String(), "namespace", ns)
+		c.Send([]byte(ErrInvalidNamespace.Error()))
+		c.Close()
+		return
+	}
 	switch protocol.ClientType(payload[0]) {
 	case protocol.TYPECLIENT:
+		sched.conns["client"].Incr()
+		defer sched.conns["client"].Decr()
 		client := newClient(sched, c)
+		client.identity = identity
+		client.namespace = ns
 		client.handle()
 		break
 	case protocol.TYPEWORKER:
+		sched.conns["worker"].Incr()
+		defer sched.conns["worker"].Decr()
 		w := newWorker(sched, c)
+		w.identity = identity
+		w.namespace = ns
+		sched.addWorker(w)
+		sched.emit(newWorkerEvent(EventWorkerConnected, w))
 		w.handle()
 		break
 	default:
-		log.Printf("Unsupport client %d\n", payload[0])
+		protoLog.Warn("Unsupport client", "type", int(payload[0]))
 		c.Close()
 		break
 	}
 }
 
-func (sched *Sched) done(jobID int64) {
+func (sched *Sched) done(jobID int64, result []byte) {
 	defer sched.notifyJobTimer()
 	defer sched.notifyRevertTimer()
 	defer sched.jobLocker.Unlock()
@@ -169,6 +352,8 @@ func (sched *Sched) done(jobID int64) {
 	}
 	job, err := sched.driver.Get(jobID)
 	if err == nil {
+		worker := sched.addHistory(job, driver.OutcomeDone, result)
+		sched.emit(newRunEvent(EventDone, job, worker))
 		sched.decrStatProc(job)
 		sched.removeRevertPQ(job)
 		if job.IsPeriod() {
@@ -184,45 +369,260 @@ func (sched *Sched) done(jobID int64) {
 	return
 }
 
-func (sched *Sched) submitJob(item grabItem, job driver.Job) bool {
+func (sched *Sched) submitJob(item grabItem, job driver.Job) (bool, error) {
+	// fetch the offloaded args before the jobLocker, the blob may be large.
+	assigned, loadErr := sched.loadArgs(job)
 	defer sched.jobLocker.Unlock()
 	sched.jobLocker.Lock()
 	if job.Name == "" {
 		sched.driver.Delete(job.ID)
-		return true
+		return true, nil
 	}
 
 	if _, ok := sched.procQueue[job.ID]; ok {
-		return true
+		return true, nil
 	}
 
 	now := time.Now()
 	current := int64(now.Unix())
-	if job.Retention > 0 && current-job.SchedAt > job.Retention {
-		sched.driver.Delete(job.ID)
+	if job.IsExpired(current) {
 		//job存活时间超过限定时间
-		return true
+		sched.expireJob(job)
+		return true, nil
 	}
 
 	if !item.w.alive {
-		return false
+		return false, nil
+	}
+	if job.Blob != "" {
+		// the job may be changed while the args is loading
+		if sched.argsChanged(job) {
+			return false, nil
+		}
+		if loadErr != nil {
+			sched.loseArgs(job, loadErr)
+			return true, nil
+		}
+	}
+	// hand the run span to the worker as the traceparent.
+	parent, span, traced := newRunSpan(job)
+	if traced {
+		assigned.TraceParent = span.TraceParent()
+	}
+	// save the processing state before the job is sent
+	procJobs, err := sched.saveProcJobs([]driver.Job{job}, now)
+	if err != nil {
+		return false, err
+	}
+	// claim the item, it may be timeout
+	if !sched.grabQueue.remove(item) {
+		sched.revertProcJobs([]driver.Job{job})
+		return false, nil
 	}
-	if err := item.w.handleJobAssign(item.msgID, job); err != nil {
+	item.stop()
+	if err := item.w.handleJobAssign(item.msgID, assigned); err != nil {
 		item.w.alive = false
-		return false
+		sched.revertProcJobs([]driver.Job{job})
+		return false, nil
 	}
-	job.SetProc()
-	job.RunAt = current
-	sched.driver.Save(&job)
+	sched.startJob(item.w, procJobs[0], now, parent, span)
+	return true, nil
+}
+
+// saveProcJobs save the jobs in the processing state at once, it return the
+// jobs saved. The jobs are reverted to ready when any of them is failed.
+func (sched *Sched) saveProcJobs(jobs []driver.Job, now time.Time) ([]driver.Job, error) {
+	var procJobs = make([]driver.Job, len(jobs))
+	var saving = make([]*driver.Job, len(jobs))
+	for i, job := range jobs {
+		job.SetProc()
+		job.RunAt = now.Unix()
+		procJobs[i] = job
+		saving[i] = &procJobs[i]
+	}
+	var saved = make([]driver.Job, 0, len(jobs))
+	var failed error
+	for i, err := range sched.driver.SaveBatch(saving) {
+		if err != nil {
+			withJob(schedLog, jobs[i]).Error("Save job failed", "err", err)
+			failed = err
+			continue
+		}
+		saved = append(saved, jobs[i])
+	}
+	if failed != nil {
+		sched.revertProcJobs(saved)
+		return nil, failed
+	}
+	return procJobs, nil
+}
+
+// revertProcJobs save the jobs back in the state before saveProcJobs
+func (sched *Sched) revertProcJobs(jobs []driver.Job) {
+	var saving = make([]*driver.Job, len(jobs))
+	for i := range jobs {
+		saving[i] = &jobs[i]
+	}
+	for i, err := range sched.driver.SaveBatch(saving) {
+		if err != nil {
+			withJob(schedLog, jobs[i]).Error("Revert job failed", "err", err)
+		}
+	}
+}
+
+// startJob mark the job assigned to the worker processing, the job is saved
+// in the processing state by saveProcJobs. The caller must hold the
+// jobLocker.
+func (sched *Sched) startJob(w *worker, job driver.Job, now time.Time, parent, span trace.SpanContext) {
 	sched.incrStatProc(job)
+	sched.removeExpirePQ(job.ID)
+	a := sched.assignJob(job, w, now, parent, span)
+	sched.traceDispatch(job, a, time.Now())
+	e := newJobEvent(EventAssigned, job)
+	e.Worker = w.id
+	sched.emit(e)
 	if !job.IsPeriod() {
 		//周期性任务不支持timeout处理
 		sched.pushRevertPQ(job)
 		sched.notifyRevertTimer()
 	}
 	sched.procQueue[job.ID] = job
-	sched.grabQueue.remove(item)
-	return true
+}
+
+// submitJobs assign the job and the other ready jobs of the worker funcs, up
+// to the size of the GRAB_JOBS, by one JOB_ASSIGNS. The jobs are either all
+// assigned or all requeued.
+func (sched *Sched) submitJobs(item grabItem, job driver.Job) (bool, error) {
+	size := item.size
+	if max := sched.workerMaxInFlight; max > 0 && max-item.w.inFlight() < size {
+		size = max - item.w.inFlight()
+	}
+	if room := sched.processingRoom(job.Namespace); room >= 0 && room < int64(size) {
+		size = int(room)
+	}
+	jobs := append([]driver.Job{job}, sched.popReadyJobs(item.w, size-1, job.ID)...)
+	// fetch the offloaded args before the jobLocker, the blobs may be large.
+	var withArgs = make([]driver.Job, len(jobs))
+	var loadErrs = make([]error, len(jobs))
+	for i, job := range jobs {
+		withArgs[i], loadErrs[i] = sched.loadArgs(job)
+	}
+
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	now := time.Now()
+	current := int64(now.Unix())
+	var pending, loaded []driver.Job
+	for i, job := range jobs {
+		if job.Name == "" {
+			sched.driver.Delete(job.ID)
+			continue
+		}
+		if _, ok := sched.procQueue[job.ID]; ok {
+			continue
+		}
+		if job.IsExpired(current) {
+			sched.expireJob(job)
+			continue
+		}
+		if job.Blob != "" {
+			// the job may be changed while the args is loading
+			if sched.argsChanged(job) {
+				sched.pushJobPQ(job)
+				continue
+			}
+			if loadErrs[i] != nil {
+				sched.loseArgs(job, loadErrs[i])
+				continue
+			}
+		}
+		pending = append(pending, job)
+		loaded = append(loaded, withArgs[i])
+	}
+	if len(pending) == 0 {
+		return true, nil
+	}
+	requeue := func() {
+		for _, job := range pending {
+			sched.pushJobPQ(job)
+		}
+	}
+
+	if !item.w.alive {
+		requeue()
+		return true, nil
+	}
+	var assigned = make([]driver.Job, len(pending))
+	var parents = make([]trace.SpanContext, len(pending))
+	var spans = make([]trace.SpanContext, len(pending))
+	for i, job := range pending {
+		assigned[i] = loaded[i]
+		var traced bool
+		parents[i], spans[i], traced = newRunSpan(job)
+		if traced {
+			assigned[i].TraceParent = spans[i].TraceParent()
+		}
+	}
+	// save the processing state before the jobs are sent
+	procJobs, err := sched.saveProcJobs(pending, now)
+	if err != nil {
+		requeue()
+		return true, err
+	}
+	// claim the item, it may be timeout
+	if !sched.grabQueue.remove(item) {
+		sched.revertProcJobs(pending)
+		requeue()
+		return true, nil
+	}
+	item.stop()
+	if err := item.w.handleJobAssigns(item.msgID, assigned); err != nil {
+		item.w.alive = false
+		sched.revertProcJobs(pending)
+		requeue()
+		return true, nil
+	}
+	for i, job := range procJobs {
+		sched.startJob(item.w, job, now, parents[i], spans[i])
+	}
+	return true, nil
+}
+
+// popReadyJobs pop at most n ready jobs of the worker funcs in the order of
+// sched_at except the job being assigned, the cached job may be in the queue
+// too. The caller must requeue the jobs not assigned.
+func (sched *Sched) popReadyJobs(w *worker, n int, except int64) (jobs []driver.Job) {
+	if n <= 0 {
+		return
+	}
+	current := time.Now().Unix()
+	defer sched.PQLocker.Unlock()
+	sched.PQLocker.Lock()
+	for len(jobs) < n {
+		var pq *queue.PriorityQueue
+		for _, Func := range w.funcs {
+			pq1, ok := sched.jobPQ[nsFunc(w.namespace, Func)]
+			if !ok || pq1.Len() == 0 {
+				continue
+			}
+			if pq == nil || (*pq1)[0].Priority < (*pq)[0].Priority {
+				pq = pq1
+			}
+		}
+		if pq == nil || (*pq)[0].Priority > current {
+			break
+		}
+		item := heap.Pop(pq).(*queue.Item)
+		if item.Value == except {
+			continue
+		}
+		job, err := sched.driver.Get(item.Value)
+		if err != nil || !job.IsReady() {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return
 }
 
 func (sched *Sched) clearCacheItem() {
@@ -239,18 +639,19 @@ func (sched *Sched) lessItem() (lessItem *queue.Item) {
 	}
 	maybeItem := make(map[string]*queue.Item)
 	sched.funcLocker.Lock()
-	for Func, stat := range sched.stats {
-		if stat.Worker.Int() == 0 {
+	busy := sched.busyNamespaces()
+	for key, stat := range sched.stats {
+		if stat.Worker.Int() == 0 || busy[stat.Namespace] {
 			continue
 		}
-		pq, ok := sched.jobPQ[Func]
+		pq, ok := sched.jobPQ[key]
 		if !ok || pq.Len() == 0 {
 			continue
 		}
 
 		item := heap.Pop(pq).(*queue.Item)
 
-		maybeItem[Func] = item
+		maybeItem[key] = item
 	}
 	sched.funcLocker.Unlock()
 
@@ -258,25 +659,25 @@ func (sched *Sched) lessItem() (lessItem *queue.Item) {
 		return nil
 	}
 
-	var lessFunc string
+	var lessKey string
 
-	for Func, item := range maybeItem {
+	for key, item := range maybeItem {
 		if lessItem == nil {
 			lessItem = item
-			lessFunc = Func
+			lessKey = key
 			continue
 		}
 		if lessItem.Priority > item.Priority {
 			lessItem = item
-			lessFunc = Func
+			lessKey = key
 		}
 	}
 
-	for Func, item := range maybeItem {
-		if Func == lessFunc {
+	for key, item := range maybeItem {
+		if key == lessKey {
 			continue
 		}
-		pq := sched.jobPQ[Func]
+		pq := sched.jobPQ[key]
 		old := pq.Get(item.Value)
 		if old != nil {
 			heap.Remove(pq, old.Index)
@@ -307,7 +708,7 @@ func (sched *Sched) handleJobPQ() {
 			continue
 		}
 		schedJob, err := sched.driver.Get(lessItem.Value)
-		if err != nil {
+		if err != nil || schedJob.IsPaused() {
 			sched.clearCacheItem()
 			continue
 		}
@@ -323,19 +724,41 @@ func (sched *Sched) handleJobPQ() {
 			}
 		}
 
-		grabItem, err := sched.grabQueue.get(schedJob.Func)
+		grabItem, err := sched.grabQueue.get(schedJob.Namespace, schedJob.Func)
 		if err == nil {
-			if sched.submitJob(grabItem, schedJob) {
+			var submitted bool
+			if grabItem.size > 0 {
+				submitted, err = sched.submitJobs(grabItem, schedJob)
+			} else {
+				submitted, err = sched.submitJob(grabItem, schedJob)
+			}
+			if submitted {
 				sched.clearCacheItem()
 			} else {
 				sched.pushJobPQ(schedJob)
 			}
+			if err != nil {
+				// the store is failed, retry a while later
+				sched.resetJobTimer(time.Second)
+				current = <-sched.jobTimer.C
+			}
 		} else {
 			sched.pushJobPQ(schedJob)
+			sched.wakeWorkers(schedJob.Namespace, schedJob.Func)
+			// wait for a worker to grab the job
+			sched.resetJobTimer(time.Minute)
+			current = <-sched.jobTimer.C
 		}
 	}
 }
 
+// wakeWorkers send NOOP to the sleeping workers able to perform the func
+func (sched *Sched) wakeWorkers(ns, Func string) {
+	for _, item := range sched.grabQueue.wake(ns, Func) {
+		item.w.handleCommand(item.msgID, protocol.NOOP)
+	}
+}
+
 func (sched *Sched) handleRevertPQ() {
 	var current time.Time
 	var timestamp int64
@@ -386,11 +809,80 @@ func (sched *Sched) handleRevertPQ() {
 		if _, ok := sched.procQueue[revertJob.ID]; ok {
 			delete(sched.procQueue, revertJob.ID)
 		}
+		worker := sched.addHistory(revertJob, driver.OutcomeTimeout, []byte("timeout"))
+		sched.emit(newRunEvent(EventTimeout, revertJob, worker))
 		sched.jobLocker.Unlock()
 	}
 }
 
-func (sched *Sched) fail(jobID int64) {
+func (sched *Sched) handleRetention() {
+	ticker := time.NewTicker(sched.retentionInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !sched.alive {
+			break
+		}
+		sched.expireJobs()
+		sched.purgeArchived()
+	}
+}
+
+// expireJobs archive the ready jobs overdue the retention, they are popped
+// from the expirePQ by the expire time.
+func (sched *Sched) expireJobs() {
+	current := int64(time.Now().Unix())
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	var expired bool
+	for {
+		jobID, ok := sched.popExpirePQ(current)
+		if !ok {
+			break
+		}
+		job, err := sched.driver.Get(jobID)
+		// the job running is pushed again when it is ready
+		if err != nil || !job.IsReady() {
+			continue
+		}
+		if _, ok := sched.procQueue[job.ID]; ok {
+			continue
+		}
+		if !job.IsExpired(current) {
+			sched.pushExpirePQ(job)
+			continue
+		}
+		sched.expireJob(job)
+		expired = true
+	}
+	if expired {
+		sched.notifyJobTimer()
+	}
+}
+
+// purgeArchived remove the jobs archived longer than the archive retention.
+func (sched *Sched) purgeArchived() {
+	if sched.archiveRetention <= 0 {
+		return
+	}
+	before := time.Now().Add(-sched.archiveRetention).Unix()
+	if _, err := sched.driver.PurgeArchived(before); err != nil {
+		schedLog.Error("Purge archived jobs failed", "err", err)
+	}
+}
+
+// expireJob archive the job and update the stats, the caller must hold the
+// jobLocker.
+func (sched *Sched) expireJob(job driver.Job) {
+	if err := sched.driver.Archive(job.ID, string(EventExpired)); err != nil {
+		withJob(schedLog, job).Error("Archive job failed", "err", err)
+		return
+	}
+	sched.removeJobPQ(job)
+	sched.decrStatJob(job)
+	sched.emit(newJobEvent(EventExpired, job))
+}
+
+func (sched *Sched) fail(jobID int64, reason []byte) {
 	defer sched.notifyJobTimer()
 	defer sched.notifyRevertTimer()
 	defer sched.jobLocker.Unlock()
@@ -399,6 +891,7 @@ func (sched *Sched) fail(jobID int64) {
 		delete(sched.procQueue, jobID)
 	}
 	job, _ := sched.driver.Get(jobID)
+	worker := sched.addHistory(job, driver.OutcomeFail, reason)
 	if job.FailRetry > 0 {
 		//没有设置重试次数则不进行重试
 		if _, ok := sched.retryCounter[job.ID]; ok {
@@ -411,6 +904,7 @@ func (sched *Sched) fail(jobID int64) {
 				job.SetReady()
 				sched.driver.Save(&job)
 				sched.pushJobPQ(job)
+				sched.emit(newFailEvent(job, worker, true))
 				return
 			}
 		} else {
@@ -420,9 +914,15 @@ func (sched *Sched) fail(jobID int64) {
 			job.SetReady()
 			sched.driver.Save(&job)
 			sched.pushJobPQ(job)
+			sched.emit(newFailEvent(job, worker, true))
 			return
 		}
 	}
+	if job.ID > 0 {
+		e := newFailEvent(job, worker, false)
+		e.deadLettered = !job.IsPeriod()
+		sched.emit(e)
+	}
 	delete(sched.retryCounter, job.ID)
 	sched.decrStatProc(job)
 	sched.removeRevertPQ(job)
@@ -431,53 +931,88 @@ func (sched *Sched) fail(jobID int64) {
 		job.SetReady()
 		sched.driver.Save(&job)
 		sched.pushJobPQ(job)
-	} else {
+	} else if job.ID > 0 {
+		// keep the failed job in the archive as dead letter.
 		sched.decrStatJob(job)
-		sched.driver.Delete(job.ID)
+		if err := sched.driver.Archive(job.ID, string(EventDeadLettered)); err != nil {
+			withJob(schedLog, job).Error("Archive job failed", "err", err)
+			sched.driver.Delete(job.ID)
+		}
+		sched.emit(newRunEvent(EventDeadLettered, job, worker))
 	}
 	return
 }
 
-func (sched *Sched) getFuncStat(Func string) *stat.FuncStat {
+// loseArgs dead letter the ready job whose args is lost from the blob store,
+// it can never run. The caller must hold the jobLocker.
+func (sched *Sched) loseArgs(job driver.Job, err error) {
+	withJob(schedLog, job).Error("Load job args failed", "err", err)
+	now := time.Now().Unix()
+	record := driver.History{
+		JobID:      job.ID,
+		Namespace:  job.Namespace,
+		Func:       job.Func,
+		Name:       job.Name,
+		AssignedAt: now,
+		FinishedAt: now,
+		Outcome:    driver.OutcomeFail,
+		Error:      "Load job args failed: " + err.Error(),
+	}
+	if e := sched.driver.AddHistory(record, sched.historyJobLimit, sched.historyFuncLimit); e != nil {
+		withJob(schedLog, job).Error("AddHistory failed", "err", e)
+	}
+	delete(sched.retryCounter, job.ID)
+	sched.removeJobPQ(job)
+	sched.decrStatJob(job)
+	if e := sched.driver.Archive(job.ID, string(EventDeadLettered)); e != nil {
+		withJob(schedLog, job).Error("Archive job failed", "err", e)
+		sched.driver.Delete(job.ID)
+	}
+	sched.emit(newJobEvent(EventDeadLettered, job))
+}
+
+func (sched *Sched) getFuncStat(ns, Func string) *stat.FuncStat {
 	defer sched.funcLocker.Unlock()
 	sched.funcLocker.Lock()
-	st, ok := sched.stats[Func]
+	key := nsFunc(ns, Func)
+	st, ok := sched.stats[key]
 	if !ok {
 		st = stat.NewFuncStat(Func)
-		sched.stats[Func] = st
+		st.Namespace = ns
+		sched.stats[key] = st
 	}
 	return st
 }
 
-func (sched *Sched) incrStatFunc(Func string) {
-	stat := sched.getFuncStat(Func)
+func (sched *Sched) incrStatFunc(ns, Func string) {
+	stat := sched.getFuncStat(ns, Func)
 	stat.Worker.Incr()
 }
 
-func (sched *Sched) decrStatFunc(Func string) {
-	stat := sched.getFuncStat(Func)
+func (sched *Sched) decrStatFunc(ns, Func string) {
+	stat := sched.getFuncStat(ns, Func)
 	stat.Worker.Decr()
 }
 
 func (sched *Sched) incrStatJob(job driver.Job) {
-	stat := sched.getFuncStat(job.Func)
+	stat := sched.getFuncStat(job.Namespace, job.Func)
 	stat.Job.Incr()
 }
 
 func (sched *Sched) decrStatJob(job driver.Job) {
-	stat := sched.getFuncStat(job.Func)
+	stat := sched.getFuncStat(job.Namespace, job.Func)
 	stat.Job.Decr()
 }
 
 func (sched *Sched) incrStatProc(job driver.Job) {
-	stat := sched.getFuncStat(job.Func)
+	stat := sched.getFuncStat(job.Namespace, job.Func)
 	if job.IsProc() {
 		stat.Processing.Incr()
 	}
 }
 
 func (sched *Sched) decrStatProc(job driver.Job) {
-	stat := sched.getFuncStat(job.Func)
+	stat := sched.getFuncStat(job.Namespace, job.Func)
 	if job.IsProc() {
 		stat.Processing.Decr()
 	}
@@ -492,6 +1027,8 @@ func (sched *Sched) schedLater(jobID, delay, counter int64) {
 		delete(sched.procQueue, jobID)
 	}
 	job, _ := sched.driver.Get(jobID)
+	worker := sched.addHistory(job, driver.OutcomeSchedLater, nil)
+	sched.emit(newRunEvent(EventRescheduled, job, worker))
 	sched.decrStatProc(job)
 	sched.removeRevertPQ(job)
 	job.SetReady()
@@ -507,6 +1044,7 @@ func (sched *Sched) pushJobPQ(job driver.Job) bool {
 	defer sched.PQLocker.Unlock()
 	sched.PQLocker.Lock()
 	if job.IsReady() {
+		sched.pushExpireItem(job)
 		item := &queue.Item{
 			Value:    job.ID,
 			Priority: job.SchedAt,
@@ -521,11 +1059,12 @@ func (sched *Sched) pushJobPQ(job driver.Job) bool {
 				return false
 			}
 		}
-		pq, ok := sched.jobPQ[job.Func]
+		key := nsFunc(job.Namespace, job.Func)
+		pq, ok := sched.jobPQ[key]
 		if !ok {
 			pq1 := make(queue.PriorityQueue, 0)
 			pq = &pq1
-			sched.jobPQ[job.Func] = pq
+			sched.jobPQ[key] = pq
 			heap.Init(pq)
 		}
 		old := pq.Get(item.Value)
@@ -538,6 +1077,75 @@ func (sched *Sched) pushJobPQ(job driver.Job) bool {
 	return false
 }
 
+func (sched *Sched) removeJobPQ(job driver.Job) {
+	defer sched.PQLocker.Unlock()
+	sched.PQLocker.Lock()
+	if sched.cacheItem != nil && sched.cacheItem.Value == job.ID {
+		sched.cacheItem = nil
+	}
+	sched.removeExpireItem(job.ID)
+	pq, ok := sched.jobPQ[nsFunc(job.Namespace, job.Func)]
+	if !ok {
+		return
+	}
+	old := pq.Get(job.ID)
+	if old != nil {
+		heap.Remove(pq, old.Index)
+	}
+}
+
+// pushExpirePQ index the ready job by the expire time
+func (sched *Sched) pushExpirePQ(job driver.Job) {
+	defer sched.PQLocker.Unlock()
+	sched.PQLocker.Lock()
+	sched.pushExpireItem(job)
+}
+
+func (sched *Sched) pushExpireItem(job driver.Job) {
+	if job.Retention <= 0 || job.SchedAt <= 0 {
+		sched.removeExpireItem(job.ID)
+		return
+	}
+	priority := job.SchedAt + job.Retention
+	if item, ok := sched.expireItems[job.ID]; ok {
+		item.Priority = priority
+		heap.Fix(&sched.expirePQ, item.Index)
+		return
+	}
+	item := &queue.Item{
+		Value:    job.ID,
+		Priority: priority,
+	}
+	heap.Push(&sched.expirePQ, item)
+	sched.expireItems[job.ID] = item
+}
+
+// removeExpirePQ drop the job out of the expire index
+func (sched *Sched) removeExpirePQ(jobID int64) {
+	defer sched.PQLocker.Unlock()
+	sched.PQLocker.Lock()
+	sched.removeExpireItem(jobID)
+}
+
+func (sched *Sched) removeExpireItem(jobID int64) {
+	if item, ok := sched.expireItems[jobID]; ok {
+		heap.Remove(&sched.expirePQ, item.Index)
+		delete(sched.expireItems, jobID)
+	}
+}
+
+// popExpirePQ pop a job expired at current out of the expire index
+func (sched *Sched) popExpirePQ(current int64) (int64, bool) {
+	defer sched.PQLocker.Unlock()
+	sched.PQLocker.Lock()
+	if sched.expirePQ.Len() == 0 || sched.expirePQ[0].Priority >= current {
+		return 0, false
+	}
+	item := heap.Pop(&sched.expirePQ).(*queue.Item)
+	delete(sched.expireItems, item.Value)
+	return item.Value, true
+}
+
 func (sched *Sched) pushRevertPQ(job driver.Job) {
 	defer sched.PQLocker.Unlock()
 	sched.PQLocker.Lock()
@@ -577,7 +1185,7 @@ func (sched *Sched) loadJobQueue() {
 	var now = time.Now()
 	current := int64(now.Unix())
 
-	iter := sched.driver.NewIterator(nil)
+	iter := sched.driver.NewIterator("", nil)
 	for {
 		if !iter.Next() {
 			break
@@ -588,6 +1196,9 @@ func (sched *Sched) loadJobQueue() {
 			continue
 		}
 		sched.incrStatJob(job)
+		if job.IsPaused() {
+			continue
+		}
 		sched.pushJobPQ(job)
 		runAt := job.RunAt
 		if runAt < job.SchedAt {
@@ -619,6 +1230,13 @@ func (sched *Sched) loadJobQueue() {
 // Close the schedule
 func (sched *Sched) Close() {
 	sched.alive = false
+	sched.webhooks.close()
+	if sched.httpServer != nil {
+		sched.httpServer.Close()
+	}
+	if sched.tracer != nil {
+		sched.tracer.Close()
+	}
 	sched.driver.Close()
-	log.Printf("Periodic task system shutdown\n")
+	schedLog.Info("Periodic task system shutdown")
 }
@@ -0,0 +1,60 @@
+package stat
+
+import (
+	"sort"
+	"sync"
+)
+
+// LagBuckets the default buckets of the dispatch lag in seconds
+var LagBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 300, 900, 3600}
+
+// DurationBuckets the default buckets of the run duration in seconds
+var DurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 600}
+
+// LatencyBuckets the default buckets of the store latency in seconds
+var LatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// Histogram defined a histogram with fixed buckets
+type Histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+	locker  *sync.Mutex
+}
+
+// NewHistogram create a histogram, the buckets are the sorted upper bounds
+func NewHistogram(buckets []float64) *Histogram {
+	var h = new(Histogram)
+	h.buckets = buckets
+	h.counts = make([]uint64, len(buckets))
+	h.locker = new(sync.Mutex)
+	return h
+}
+
+// Observe add a value to the histogram
+func (h *Histogram) Observe(v float64) {
+	idx := sort.SearchFloat64s(h.buckets, v)
+	defer h.locker.Unlock()
+	h.locker.Lock()
+	if idx < len(h.counts) {
+		h.counts[idx]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Snapshot return the upper bounds, the cumulative counts of each bucket,
+// the sum and the count of the observed values.
+func (h *Histogram) Snapshot() (buckets []float64, counts []uint64, sum float64, count uint64) {
+	defer h.locker.Unlock()
+	h.locker.Lock()
+	buckets = h.buckets
+	counts = make([]uint64, len(h.counts))
+	var total uint64
+	for i, c := range h.counts {
+		total += c
+		counts[i] = total
+	}
+	return buckets, counts, h.sum, h.count
+}
@@ -0,0 +1,26 @@
+package stat
+
+import (
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	var h = NewHistogram([]float64{1, 5, 10})
+	h.Observe(0.5)
+	h.Observe(1)
+	h.Observe(3)
+	h.Observe(20)
+	buckets, counts, sum, count := h.Snapshot()
+	if len(buckets) != 3 {
+		t.Fatalf("Histogram: except: 3 buckets, got: %d\n", len(buckets))
+	}
+	var except = []uint64{2, 3, 3}
+	for i, c := range counts {
+		if c != except[i] {
+			t.Fatalf("Histogram: bucket %v except: %d, got: %d\n", buckets[i], except[i], c)
+		}
+	}
+	if sum != 24.5 || count != 4 {
+		t.Fatalf("Histogram: except: 24.5 4, got: %v %d\n", sum, count)
+	}
+}
@@ -2,14 +2,54 @@ package stat
 
 import (
 	"fmt"
+	"time"
 )
 
+// percentileWindow the window of the rolling percentiles
+var percentileWindow = 5 * time.Minute
+
+// percentileSize the max samples kept for the rolling percentiles
+var percentileSize = 1024
+
 // FuncStat defined func stat
 type FuncStat struct {
 	Name       string
+	Namespace  string
 	Worker     *Counter
 	Job        *Counter
 	Processing *Counter
+	Submitted  *Counter
+	Done       *Counter
+	Failed     *Counter
+	Retried    *Counter
+	Timeout    *Counter
+	Expired    *Counter
+	// DispatchLag the seconds between the job sched at and assigned
+	DispatchLag *Histogram
+	// RunDuration the seconds between the job assigned and finished
+	RunDuration *Histogram
+
+	lag     *Sampler
+	run     *Sampler
+	done    *Meter
+	failure *Meter
+}
+
+// Report defined the rolling statistics of a func, the lag and run are in
+// seconds, the rates are the jobs per minute.
+type Report struct {
+	LagP50     float64 `json:"lag_p50"`
+	LagP95     float64 `json:"lag_p95"`
+	LagP99     float64 `json:"lag_p99"`
+	RunP50     float64 `json:"run_p50"`
+	RunP95     float64 `json:"run_p95"`
+	RunP99     float64 `json:"run_p99"`
+	Done1m     float64 `json:"done_1m"`
+	Done5m     float64 `json:"done_5m"`
+	Done15m    float64 `json:"done_15m"`
+	Failure1m  float64 `json:"failure_1m"`
+	Failure5m  float64 `json:"failure_5m"`
+	Failure15m float64 `json:"failure_15m"`
 }
 
 // NewFuncStat create a func stat
@@ -19,9 +59,65 @@ func NewFuncStat(name string) *FuncStat {
 	stat.Worker = NewCounter(0)
 	stat.Job = NewCounter(0)
 	stat.Processing = NewCounter(0)
+	stat.Submitted = NewCounter(0)
+	stat.Done = NewCounter(0)
+	stat.Failed = NewCounter(0)
+	stat.Retried = NewCounter(0)
+	stat.Timeout = NewCounter(0)
+	stat.Expired = NewCounter(0)
+	stat.DispatchLag = NewHistogram(LagBuckets)
+	stat.RunDuration = NewHistogram(DurationBuckets)
+	stat.lag = NewSampler(percentileSize, percentileWindow)
+	stat.run = NewSampler(percentileSize, percentileWindow)
+	stat.done = NewMeter(15 * time.Minute)
+	stat.failure = NewMeter(15 * time.Minute)
 	return stat
 }
 
+// ObserveLag add a dispatch lag in seconds
+func (stat *FuncStat) ObserveLag(v float64) {
+	stat.DispatchLag.Observe(v)
+	stat.lag.Add(time.Now(), v)
+}
+
+// ObserveRun add a run duration in seconds
+func (stat *FuncStat) ObserveRun(v float64) {
+	stat.RunDuration.Observe(v)
+	stat.run.Add(time.Now(), v)
+}
+
+// MarkDone mark a job is done
+func (stat *FuncStat) MarkDone() {
+	stat.Done.Incr()
+	stat.done.Mark(time.Now())
+}
+
+// MarkFailure mark a job is failed or timeout
+func (stat *FuncStat) MarkFailure() {
+	stat.failure.Mark(time.Now())
+}
+
+// Report the rolling statistics
+func (stat *FuncStat) Report(now time.Time) (r Report) {
+	lag := stat.lag.Percentiles(now, 50, 95, 99)
+	run := stat.run.Percentiles(now, 50, 95, 99)
+	r.LagP50, r.LagP95, r.LagP99 = lag[0], lag[1], lag[2]
+	r.RunP50, r.RunP95, r.RunP99 = run[0], run[1], run[2]
+	r.Done1m = stat.done.Rate(now, time.Minute)
+	r.Done5m = stat.done.Rate(now, 5*time.Minute)
+	r.Done15m = stat.done.Rate(now, 15*time.Minute)
+	r.Failure1m = stat.failure.Rate(now, time.Minute)
+	r.Failure5m = stat.failure.Rate(now, 5*time.Minute)
+	r.Failure15m = stat.failure.Rate(now, 15*time.Minute)
+	return
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%.3f,%.3f,%.3f,%.3f,%.3f,%.3f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f",
+		r.LagP50, r.LagP95, r.LagP99, r.RunP50, r.RunP95, r.RunP99,
+		r.Done1m, r.Done5m, r.Done15m, r.Failure1m, r.Failure5m, r.Failure15m)
+}
+
 func (stat FuncStat) String() string {
 	return fmt.Sprintf("%s,%s,%s,%s", stat.Name, stat.Worker, stat.Job, stat.Processing)
 }
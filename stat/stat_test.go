@@ -2,6 +2,7 @@ package stat
 
 import (
 	"testing"
+	"time"
 )
 
 func TestFuncStat(t *testing.T) {
@@ -11,3 +12,18 @@ func TestFuncStat(t *testing.T) {
 		t.Fatalf("FuncStat: except: test,1,0,0, got: %s\n", stat)
 	}
 }
+
+func TestFuncStatReport(t *testing.T) {
+	var stat = NewFuncStat("test")
+	stat.ObserveLag(2)
+	stat.ObserveRun(0.5)
+	stat.MarkDone()
+	stat.MarkFailure()
+	r := stat.Report(time.Now())
+	if r.String() != "2.000,2.000,2.000,0.500,0.500,0.500,1.00,0.20,0.07,1.00,0.20,0.07" {
+		t.Fatalf("FuncStat: unexcept report: %s\n", r)
+	}
+	if stat.Done.Int() != 1 {
+		t.Fatalf("FuncStat: except: 1 done, got: %s\n", stat.Done)
+	}
+}
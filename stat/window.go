@@ -0,0 +1,120 @@
+package stat
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sampler keep the recent samples to compute the rolling percentiles
+type Sampler struct {
+	window time.Duration
+	values []float64
+	stamps []int64
+	next   int
+	locker *sync.Mutex
+}
+
+// NewSampler create a sampler keep at most size samples in the window
+func NewSampler(size int, window time.Duration) *Sampler {
+	var s = new(Sampler)
+	s.window = window
+	s.values = make([]float64, 0, size)
+	s.stamps = make([]int64, 0, size)
+	s.locker = new(sync.Mutex)
+	return s
+}
+
+// Add a sample, the oldest sample is replaced when the sampler is full
+func (s *Sampler) Add(now time.Time, v float64) {
+	defer s.locker.Unlock()
+	s.locker.Lock()
+	if len(s.values) < cap(s.values) {
+		s.values = append(s.values, v)
+		s.stamps = append(s.stamps, now.UnixNano())
+		return
+	}
+	s.values[s.next] = v
+	s.stamps[s.next] = now.UnixNano()
+	s.next = (s.next + 1) % len(s.values)
+}
+
+// Percentiles compute the percentiles (0-100) of the samples in the window,
+// returns zero when there is no sample.
+func (s *Sampler) Percentiles(now time.Time, ps ...float64) []float64 {
+	since := now.Add(-s.window).UnixNano()
+	s.locker.Lock()
+	values := make([]float64, 0, len(s.values))
+	for i, v := range s.values {
+		if s.stamps[i] > since {
+			values = append(values, v)
+		}
+	}
+	s.locker.Unlock()
+
+	result := make([]float64, len(ps))
+	if len(values) == 0 {
+		return result
+	}
+	sort.Float64s(values)
+	for i, p := range ps {
+		rank := int(math.Ceil(p / 100 * float64(len(values))))
+		if rank < 1 {
+			rank = 1
+		}
+		if rank > len(values) {
+			rank = len(values)
+		}
+		result[i] = values[rank-1]
+	}
+	return result
+}
+
+// meterSlot the seconds counted in one slot of the meter
+const meterSlot = 10
+
+// Meter count the events in the slots to compute the rolling rates
+type Meter struct {
+	counts []int64
+	stamps []int64
+	locker *sync.Mutex
+}
+
+// NewMeter create a meter can compute the rates in the window
+func NewMeter(window time.Duration) *Meter {
+	var m = new(Meter)
+	size := int(window/time.Second)/meterSlot + 1
+	m.counts = make([]int64, size)
+	m.stamps = make([]int64, size)
+	m.locker = new(sync.Mutex)
+	return m
+}
+
+// Mark an event
+func (m *Meter) Mark(now time.Time) {
+	slot := now.Unix() / meterSlot
+	idx := int(slot % int64(len(m.counts)))
+	defer m.locker.Unlock()
+	m.locker.Lock()
+	if m.stamps[idx] != slot {
+		m.stamps[idx] = slot
+		m.counts[idx] = 0
+	}
+	m.counts[idx]++
+}
+
+// Rate compute the events per minute in the recent window
+func (m *Meter) Rate(now time.Time, window time.Duration) float64 {
+	slot := now.Unix() / meterSlot
+	since := slot - int64(window/time.Second)/meterSlot
+	var total int64
+	m.locker.Lock()
+	for i, stamp := range m.stamps {
+		if stamp > since && stamp <= slot {
+			total += m.counts[i]
+		}
+	}
+	m.locker.Unlock()
+	return float64(total) / window.Minutes()
+}
@@ -0,0 +1,41 @@
+package stat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSampler(t *testing.T) {
+	var s = NewSampler(100, time.Minute)
+	var now = time.Now()
+	s.Add(now.Add(-2*time.Minute), 1000)
+	for i := 1; i <= 100; i++ {
+		s.Add(now, float64(i))
+	}
+	ps := s.Percentiles(now, 50, 95, 99)
+	if ps[0] != 50 || ps[1] != 95 || ps[2] != 99 {
+		t.Fatalf("Sampler: except: [50 95 99], got: %v\n", ps)
+	}
+	ps = s.Percentiles(now.Add(2*time.Minute), 50)
+	if ps[0] != 0 {
+		t.Fatalf("Sampler: except: [0], got: %v\n", ps)
+	}
+}
+
+func TestMeter(t *testing.T) {
+	var m = NewMeter(15 * time.Minute)
+	var now = time.Unix(1500000000, 0)
+	m.Mark(now.Add(-10 * time.Minute))
+	for i := 0; i < 5; i++ {
+		m.Mark(now)
+	}
+	if rate := m.Rate(now, time.Minute); rate != 5 {
+		t.Fatalf("Meter: 1m except: 5, got: %v\n", rate)
+	}
+	if rate := m.Rate(now, 15*time.Minute); rate != 0.4 {
+		t.Fatalf("Meter: 15m except: 0.4, got: %v\n", rate)
+	}
+	if rate := m.Rate(now.Add(20*time.Minute), 15*time.Minute); rate != 0 {
+		t.Fatalf("Meter: 15m except: 0, got: %v\n", rate)
+	}
+}
@@ -0,0 +1,114 @@
+package periodic
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+// tlsCerts hold the server certificate and the client CAs, the new
+// connections use the reloaded certificates and the existing connections are
+// kept.
+type tlsCerts struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	clientAuth tls.ClientAuthType
+	cert       *tls.Certificate
+	pool       *x509.CertPool
+	locker     *sync.RWMutex
+}
+
+// SetTLS serve the TCP listeners of the binary protocol and the REST API over
+// TLS. The client certificates are verified by the CAs of caFile when it is
+// set, and required when requireClientCert is true.
+func (sched *Sched) SetTLS(certFile, keyFile, caFile string, requireClientCert bool) error {
+	certs := &tlsCerts{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		locker:   new(sync.RWMutex),
+	}
+	if caFile != "" {
+		certs.clientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			certs.clientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if requireClientCert {
+		return errors.New("the client CA is required to verify the client certificates")
+	}
+	if err := certs.load(); err != nil {
+		return err
+	}
+	sched.tlsCerts = certs
+	sched.tlsConfig = certs.config()
+	return nil
+}
+
+// ReloadTLS reload the certificate and the client CAs from the files.
+func (sched *Sched) ReloadTLS() error {
+	if sched.tlsCerts == nil {
+		return nil
+	}
+	return sched.tlsCerts.load()
+}
+
+func (certs *tlsCerts) load() error {
+	cert, err := tls.LoadX509KeyPair(certs.certFile, certs.keyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if certs.caFile != "" {
+		data, err := ioutil.ReadFile(certs.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.New("no certificate found in " + certs.caFile)
+		}
+	}
+	defer certs.locker.Unlock()
+	certs.locker.Lock()
+	certs.cert = &cert
+	certs.pool = pool
+	return nil
+}
+
+// config create the tls config which pick the current certificates on every
+// handshake.
+func (certs *tlsCerts) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			defer certs.locker.RUnlock()
+			certs.locker.RLock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*certs.cert},
+				ClientCAs:    certs.pool,
+				ClientAuth:   certs.clientAuth,
+			}, nil
+		},
+	}
+}
+
+// certIdentity get the identity of the verified client certificate, the
+// common name or the first DNS name. It is empty when no certificate is
+// verified.
+func certIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := state.VerifiedChains[0][0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
@@ -0,0 +1,226 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmuyuyang/periodic/logger"
+)
+
+var traceLog = logger.New("trace")
+
+// SpanKind defined the OTLP span kind
+type SpanKind int
+
+const (
+	// KindInternal an internal operation
+	KindInternal SpanKind = 1
+	// KindProducer create a job consumed by a worker
+	KindProducer SpanKind = 4
+	// KindConsumer process a job
+	KindConsumer SpanKind = 5
+)
+
+// Span defined a finished span
+type Span struct {
+	Context    SpanContext
+	Parent     [8]byte
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Error      string // The span is failed with the error
+}
+
+// Exporter export the spans in batch to an OTLP/HTTP collector
+type Exporter struct {
+	endpoint    string
+	serviceName string
+	version     string
+	client      *http.Client
+	queue       chan Span
+	batchSize   int
+	interval    time.Duration
+	done        chan struct{}
+	closed      bool
+	locker      *sync.RWMutex
+}
+
+// NewExporter create an exporter, the endpoint is the collector address eg:
+// http://127.0.0.1:4318, the spans are posted to endpoint/v1/traces.
+func NewExporter(endpoint, serviceName, version string) *Exporter {
+	e := new(Exporter)
+	e.endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(e.endpoint, "/v1/traces") {
+		e.endpoint = e.endpoint + "/v1/traces"
+	}
+	e.serviceName = serviceName
+	e.version = version
+	e.client = &http.Client{Timeout: 10 * time.Second}
+	e.queue = make(chan Span, 2048)
+	e.batchSize = 256
+	e.interval = 5 * time.Second
+	e.done = make(chan struct{})
+	e.locker = new(sync.RWMutex)
+	go e.run()
+	return e
+}
+
+// Export queue a span, the span is dropped when the queue is full
+func (e *Exporter) Export(span Span) {
+	defer e.locker.RUnlock()
+	e.locker.RLock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- span:
+	default:
+		traceLog.Warn("Trace queue is full, drop the span", "span", span.Name)
+	}
+}
+
+// Close flush the queued spans and stop the exporter
+func (e *Exporter) Close() {
+	e.locker.Lock()
+	if e.closed {
+		e.locker.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.queue)
+	e.locker.Unlock()
+	<-e.done
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	batch := make([]Span, 0, e.batchSize)
+	for {
+		select {
+		case span, ok := <-e.queue:
+			if !ok {
+				e.flush(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= e.batchSize {
+				e.flush(batch)
+				batch = batch[:0]
+			}
+			break
+		case <-ticker.C:
+			e.flush(batch)
+			batch = batch[:0]
+			break
+		}
+	}
+}
+
+func (e *Exporter) flush(batch []Span) {
+	if len(batch) == 0 {
+		return
+	}
+	body, _ := json.Marshal(e.encode(batch))
+	rsp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err == nil {
+		rsp.Body.Close()
+		if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+			err = errors.New("unexpected status " + strconv.Itoa(rsp.StatusCode))
+		}
+	}
+	if err != nil {
+		traceLog.Warn("Export spans failed", "endpoint", e.endpoint, "spans", len(batch), "err", err)
+	}
+}
+
+type otlpValue map[string]interface{}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         SpanKind        `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       otlpValue       `json:"status"`
+}
+
+func attributes(attrs map[string]interface{}) []otlpAttribute {
+	var result = make([]otlpAttribute, 0, len(attrs))
+	for key, v := range attrs {
+		var value otlpValue
+		switch val := v.(type) {
+		case string:
+			value = otlpValue{"stringValue": val}
+		case bool:
+			value = otlpValue{"boolValue": val}
+		case int:
+			value = otlpValue{"intValue": strconv.Itoa(val)}
+		case int64:
+			value = otlpValue{"intValue": strconv.FormatInt(val, 10)}
+		case float64:
+			value = otlpValue{"doubleValue": val}
+		default:
+			continue
+		}
+		result = append(result, otlpAttribute{Key: key, Value: value})
+	}
+	return result
+}
+
+// encode the spans to the OTLP ExportTraceServiceRequest
+func (e *Exporter) encode(batch []Span) map[string]interface{} {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		s := otlpSpan{
+			TraceID:    hex.EncodeToString(span.Context.TraceID[:]),
+			SpanID:     hex.EncodeToString(span.Context.SpanID[:]),
+			Name:       span.Name,
+			Kind:       span.Kind,
+			Start:      strconv.FormatInt(span.Start.UnixNano(), 10),
+			End:        strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes: attributes(span.Attributes),
+			Status:     otlpValue{"code": 1},
+		}
+		if span.Parent != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(span.Parent[:])
+		}
+		if span.Error != "" {
+			s.Status = otlpValue{"code": 2, "message": span.Error}
+		}
+		spans = append(spans, s)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": attributes(map[string]interface{}{"service.name": e.serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "periodic", "version": e.version},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,80 @@
+// Package trace defined the W3C trace context and a span exporter speak the
+// OTLP/HTTP JSON protocol.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidTraceParent the traceparent is not a valid W3C traceparent
+var ErrInvalidTraceParent = errors.New("Invalid traceparent")
+
+// SpanContext defined the W3C trace context of a span
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// ParseTraceParent parse the traceparent header, eg:
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceParent(traceParent string) (sc SpanContext, err error) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		err = ErrInvalidTraceParent
+		return
+	}
+	// the future versions may append fields, the version 00 must not.
+	if parts[0] == "00" && len(parts) != 4 {
+		err = ErrInvalidTraceParent
+		return
+	}
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) {
+		err = ErrInvalidTraceParent
+		return
+	}
+	var flags [1]byte
+	if !decodeHex(flags[:], parts[3]) {
+		err = ErrInvalidTraceParent
+		return
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		err = ErrInvalidTraceParent
+	}
+	return
+}
+
+func decodeHex(dst []byte, src string) bool {
+	if len(src) != len(dst)*2 || strings.ToLower(src) != src {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(src))
+	return err == nil
+}
+
+// IsValid check the trace id and span id are not all zero
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// IsSampled check the sampled flag
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&0x01 == 0x01
+}
+
+// TraceParent format the span context as traceparent header
+func (sc SpanContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" +
+		hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// NewChild create a child span context in the same trace
+func (sc SpanContext) NewChild() SpanContext {
+	child := sc
+	rand.Read(child.SpanID[:])
+	return child
+}
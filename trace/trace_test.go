@@ -0,0 +1,81 @@
+package trace
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	var traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceParent(traceParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.IsSampled() || sc.TraceParent() != traceParent {
+		t.Fatalf("ParseTraceParent: except: %s, got: %s\n", traceParent, sc.TraceParent())
+	}
+	child := sc.NewChild()
+	if child.TraceID != sc.TraceID || child.SpanID == sc.SpanID {
+		t.Fatalf("NewChild: unexcept child: %s\n", child.TraceParent())
+	}
+	var invalids = []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, v := range invalids {
+		if _, err := ParseTraceParent(v); err == nil {
+			t.Fatalf("ParseTraceParent: except error for: %s\n", v)
+		}
+	}
+}
+
+func TestExporter(t *testing.T) {
+	var got = make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Exporter: unexcept path: %s\n", r.URL.Path)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var req map[string]interface{}
+		json.Unmarshal(body, &req)
+		got <- req
+	}))
+	defer srv.Close()
+
+	sc, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e := NewExporter(srv.URL, "periodic", "test")
+	now := time.Now()
+	e.Export(Span{
+		Context:    sc.NewChild(),
+		Parent:     sc.SpanID,
+		Name:       "periodic.execute",
+		Kind:       KindConsumer,
+		Start:      now,
+		End:        now.Add(time.Second),
+		Attributes: map[string]interface{}{"periodic.func": "f"},
+		Error:      "fail",
+	})
+	e.Close()
+	req := <-got
+	data, _ := json.Marshal(req)
+	for _, except := range []string{
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"parentSpanId":"00f067aa0ba902b7"`,
+		`"name":"periodic.execute"`,
+		`"status":{"code":2,"message":"fail"}`,
+		`"stringValue":"periodic"`,
+	} {
+		if !strings.Contains(string(data), except) {
+			t.Fatalf("Exporter: except %s in: %s\n", except, data)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package periodic
+
+import (
+	"time"
+
+	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/trace"
+)
+
+// SetTraceEndpoint export the spans of the traced jobs to the OTLP/HTTP
+// collector endpoint, eg: http://127.0.0.1:4318
+func (sched *Sched) SetTraceEndpoint(endpoint string) {
+	if endpoint == "" {
+		return
+	}
+	sched.tracer = trace.NewExporter(endpoint, "periodic", Version)
+}
+
+// newRunSpan create the span context of the job run, it is the child of the
+// job traceparent. A job without valid traceparent is not traced.
+func newRunSpan(job driver.Job) (parent, span trace.SpanContext, ok bool) {
+	if job.TraceParent == "" {
+		return
+	}
+	var err error
+	if parent, err = trace.ParseTraceParent(job.TraceParent); err != nil {
+		return
+	}
+	return parent, parent.NewChild(), true
+}
+
+func (sched *Sched) exportSpan(a assignment, name string, kind trace.SpanKind, ctx trace.SpanContext,
+	start, end time.Time, attrs map[string]interface{}, errMsg string) {
+	if sched.tracer == nil || !a.parent.IsSampled() {
+		return
+	}
+	sched.tracer.Export(trace.Span{
+		Context:    ctx,
+		Parent:     a.parent.SpanID,
+		Name:       name,
+		Kind:       kind,
+		Start:      start,
+		End:        end,
+		Attributes: attrs,
+		Error:      errMsg,
+	})
+}
+
+func jobAttributes(job driver.Job, a assignment) map[string]interface{} {
+	return map[string]interface{}{
+		"periodic.job_id":  job.ID,
+		"periodic.func":    job.Func,
+		"periodic.name":    job.Name,
+		"periodic.worker":  a.worker,
+		"periodic.attempt": a.attempt,
+	}
+}
+
+// traceDispatch record the enqueue wait span from the job sched at to the
+// dispatch start, and the dispatch span.
+func (sched *Sched) traceDispatch(job driver.Job, a assignment, end time.Time) {
+	if !a.span.IsValid() {
+		return
+	}
+	schedAt := time.Unix(job.SchedAt, 0)
+	if job.SchedAt > 0 && schedAt.Before(a.at) {
+		sched.exportSpan(a, "periodic.enqueue_wait", trace.KindInternal, a.parent.NewChild(),
+			schedAt, a.at, jobAttributes(job, a), "")
+	}
+	sched.exportSpan(a, "periodic.dispatch", trace.KindProducer, a.parent.NewChild(),
+		a.at, end, jobAttributes(job, a), "")
+}
+
+// traceRun record the execution span of the job run finished with outcome.
+func (sched *Sched) traceRun(job driver.Job, a assignment, outcome string, result []byte, end time.Time) {
+	if !a.span.IsValid() {
+		return
+	}
+	attrs := jobAttributes(job, a)
+	attrs["periodic.outcome"] = outcome
+	errMsg := ""
+	if outcome == driver.OutcomeFail || outcome == driver.OutcomeTimeout {
+		errMsg = outcome
+		if len(result) > 0 {
+			errMsg = string(result)
+		}
+	}
+	sched.exportSpan(a, "periodic.execute", trace.KindConsumer, a.span, a.at, end, attrs, errMsg)
+}
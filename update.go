@@ -0,0 +1,124 @@
+package periodic
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/jmuyuyang/periodic/driver"
+)
+
+// ErrRevisionConflict the job was changed by someone else since the given revision
+var ErrRevisionConflict = errors.New("Job revision conflict")
+
+type updateRequest struct {
+	ID       int64  `json:"job_id"`
+	Func     string `json:"func"`
+	Name     string `json:"name"`
+	Revision *int64 `json:"revision"`
+}
+
+// updateJob change only the fields supplied in payload of an exists job of
+// the namespace.
+// The job is found by job_id or by func and name. When revision is supplied
+// it must match the stored one, otherwise ErrRevisionConflict is returned.
+// The status and the schedule of the job is kept, unless sched_at or period
+// is supplied.
+func (sched *Sched) updateJob(ns string, payload []byte) (job driver.Job, err error) {
+	var req updateRequest
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(payload, &req); err != nil {
+		err = validationError{err}
+		return
+	}
+	if err = json.Unmarshal(payload, &fields); err != nil {
+		err = validationError{err}
+		return
+	}
+	// offload the large args before the jobLocker, the blob may be large.
+	var blob string
+	_, hasArgs := fields["workload"]
+	if hasArgs {
+		var args driver.Job
+		if err = json.Unmarshal(payload, &args); err != nil {
+			err = validationError{err}
+			return
+		}
+		if blob, err = sched.offloadArgs(&args); err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				sched.removeBlob(blob)
+			}
+		}()
+	}
+
+	defer sched.jobLocker.Unlock()
+	sched.jobLocker.Lock()
+	var old driver.Job
+	if old, err = sched.findJob(ns, req.ID, req.Func, req.Name); err != nil {
+		return
+	}
+	if req.Revision != nil && *req.Revision != old.Revision {
+		err = ErrRevisionConflict
+		return
+	}
+
+	job = old
+	if err = json.Unmarshal(payload, &job); err != nil {
+		err = validationError{err}
+		return
+	}
+	if hasArgs {
+		// the new args replace the offloaded one
+		if blob != "" {
+			job.Args = ""
+		}
+		job.Blob = blob
+	}
+	// the identity and the state of the job can not be changed by update.
+	job.ID = old.ID
+	job.Namespace = old.Namespace
+	job.Func = old.Func
+	job.Name = old.Name
+	job.Status = old.Status
+	job.RunAt = old.RunAt
+	job.Counter = old.Counter
+	job.Revision = old.Revision + 1
+	if err = job.Init(); err != nil {
+		err = validationError{err}
+		return
+	}
+
+	_, hasSchedAt := fields["sched_at"]
+	_, hasPeriod := fields["period"]
+	reschedule := hasSchedAt || (hasPeriod && job.Period != old.Period)
+	if reschedule && !hasSchedAt && job.IsPeriod() {
+		job.SchedAt = 0
+		job.ResetPeriod()
+	}
+
+	if err = sched.driver.Save(&job); err != nil {
+		return
+	}
+
+	if _, ok := sched.procQueue[job.ID]; ok {
+		sched.procQueue[job.ID] = job
+	}
+	if job.IsProc() && job.Timeout != old.Timeout {
+		sched.removeRevertPQ(old)
+		// the periodic jobs are not reverted by timeout
+		if !job.IsPeriod() {
+			sched.pushRevertPQ(job)
+			sched.notifyRevertTimer()
+		}
+	}
+	if job.IsReady() && reschedule {
+		// the expire index is updated with the job queue
+		sched.pushJobPQ(job)
+		sched.notifyJobTimer()
+	} else if job.IsReady() && job.Retention != old.Retention {
+		sched.pushExpirePQ(job)
+	}
+	return
+}
@@ -1,19 +1,68 @@
 package periodic
 
 import (
-	"log"
+	"bytes"
 	"net"
 	"os"
+
+	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/logger"
+	"github.com/jmuyuyang/periodic/protocol"
+)
+
+var (
+	schedLog = logger.New("sched")
+	protoLog = logger.New("protocol")
+	httpLog  = logger.New("http")
 )
 
+// withJob create a logger carry the job fields
+func withJob(l *logger.Logger, job driver.Job) *logger.Logger {
+	return l.With("job_id", job.ID, "func", job.Func, "name", job.Name)
+}
+
 func sockCheck(sockFile string) {
 	_, err := os.Stat(sockFile)
 	if err == nil || os.IsExist(err) {
 		conn, err := net.Dial("unix", sockFile)
 		if err == nil {
 			conn.Close()
-			log.Fatal("Periodic task system is already started.")
+			schedLog.Fatal("Periodic task system is already started", "sock", sockFile)
 		}
 		os.Remove(sockFile)
 	}
 }
+
+// errorCode map the error to the protocol error code
+func errorCode(err error) protocol.ErrorCode {
+	return protocol.ErrorCode(errorStatus(err))
+}
+
+// sendError reply the error of the request msgID by an ERROR response
+func sendError(conn protocol.Conn, msgID []byte, e error) error {
+	code := errorCode(e)
+	if code == protocol.CodeInternal {
+		protoLog.Error("Request failed", "err", e)
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.Write(msgID)
+	buf.Write(protocol.NullChar)
+	buf.Write(protocol.ERROR.Bytes())
+	buf.Write(protocol.NullChar)
+	buf.Write(protocol.Error{Code: code, Message: e.Error()}.Bytes())
+	return conn.Send(buf.Bytes())
+}
+
+// sendFrameError reply an ERROR when the peer sent a bad frame, the caller
+// must close the connection as the stream is out of sync.
+func sendFrameError(conn protocol.Conn, err error) {
+	switch err {
+	case protocol.ErrFrameTooLarge:
+		sendError(conn, nil, err)
+		break
+	case protocol.ErrMagicNotMatch, protocol.ErrInvalidHeader, protocol.ErrInvalidCommand,
+		protocol.ErrCompressionNotEnabled, protocol.ErrInvalidCompressed:
+		sendError(conn, nil, validationError{err})
+		break
+	}
+}
@@ -0,0 +1,266 @@
+package periodic
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/logger"
+)
+
+// webhookEvents the events notified by webhook, a failed event is notified
+// only when the job will not be retried and is not dead lettered, the job is
+// notified once by the dead_lettered event then.
+var webhookEvents = []EventType{EventDone, EventFailed, EventTimeout, EventDeadLettered}
+
+// webhookDelivery a delivery waiting to be sent
+type webhookDelivery struct {
+	driver.Delivery
+	secret string
+	body   []byte
+}
+
+type webhookNotifier struct {
+	sched       *Sched
+	secret      string
+	client      *http.Client
+	queue       chan *webhookDelivery
+	senders     int
+	maxAttempts int
+	backoff     time.Duration
+	logLimit    int
+
+	// events the job outcomes waiting for the webhooks resolved, it is not
+	// bounded, an outcome is never dropped nor block the scheduler.
+	events []Event
+	locker *sync.Mutex
+	cond   *sync.Cond
+	closed bool
+}
+
+func newWebhookNotifier(sched *Sched) *webhookNotifier {
+	n := new(webhookNotifier)
+	n.sched = sched
+	n.client = &http.Client{Timeout: 10 * time.Second}
+	n.queue = make(chan *webhookDelivery, 1000)
+	n.senders = 4
+	n.maxAttempts = 5
+	n.backoff = time.Second
+	n.logLimit = 100
+	n.locker = new(sync.Mutex)
+	n.cond = sync.NewCond(n.locker)
+	return n
+}
+
+// SetWebhookSecret set the default HMAC secret to sign the webhook deliveries
+func (sched *Sched) SetWebhookSecret(secret string) {
+	sched.webhooks.secret = secret
+}
+
+// SetWebhookRetry set the max attempts of a webhook delivery and the first
+// backoff, the backoff is doubled on every retry.
+func (sched *Sched) SetWebhookRetry(maxAttempts int, backoff time.Duration) {
+	sched.webhooks.maxAttempts = maxAttempts
+	sched.webhooks.backoff = backoff
+}
+
+// notify queue the job outcome for the webhooks, it is called by emit.
+func (n *webhookNotifier) notify(e Event) {
+	n.locker.Lock()
+	n.events = append(n.events, e)
+	n.locker.Unlock()
+	n.cond.Signal()
+}
+
+// next wait for the next job outcome, false when the notifier is closed.
+func (n *webhookNotifier) next() (e Event, ok bool) {
+	defer n.locker.Unlock()
+	n.locker.Lock()
+	for len(n.events) == 0 && !n.closed {
+		n.cond.Wait()
+	}
+	if len(n.events) == 0 {
+		return
+	}
+	e = n.events[0]
+	n.events[0] = Event{}
+	n.events = n.events[1:]
+	return e, true
+}
+
+func (n *webhookNotifier) close() {
+	n.locker.Lock()
+	n.closed = true
+	n.locker.Unlock()
+	n.cond.Broadcast()
+}
+
+func (n *webhookNotifier) run() {
+	for i := 0; i < n.senders; i++ {
+		go n.handleQueue()
+	}
+	for {
+		e, ok := n.next()
+		if !ok {
+			break
+		}
+		if e.webhook != "" {
+			n.push(e, e.webhook, n.secret)
+		}
+		hook, err := n.sched.driver.GetWebhook(e.Namespace, e.Func)
+		if err != nil || hook.URL == "" || !hook.Wants(string(e.Type)) {
+			continue
+		}
+		secret := hook.Secret
+		if secret == "" {
+			secret = n.secret
+		}
+		n.push(e, hook.URL, secret)
+	}
+}
+
+func isWebhookEvent(e Event) bool {
+	if e.Type == EventFailed && (e.Retry || e.deadLettered) {
+		return false
+	}
+	for _, t := range webhookEvents {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *webhookNotifier) push(e Event, url, secret string) {
+	d := new(webhookDelivery)
+	d.ID = newDeliveryID()
+	d.Namespace = e.Namespace
+	d.Func = e.Func
+	d.JobID = e.JobID
+	d.Event = string(e.Type)
+	d.URL = url
+	d.secret = secret
+	d.body, _ = json.Marshal(map[string]interface{}{
+		"id":    d.ID,
+		"event": e,
+	})
+	// wait for the senders, the outcomes queue up in the events meanwhile.
+	n.queue <- d
+}
+
+func (n *webhookNotifier) handleQueue() {
+	for d := range n.queue {
+		n.send(d)
+	}
+}
+
+func (n *webhookNotifier) send(d *webhookDelivery) {
+	d.Attempt = d.Attempt + 1
+	d.At = time.Now().Unix()
+	d.StatusCode = 0
+	d.Error = ""
+	d.Success = false
+
+	req, err := http.NewRequest("POST", d.URL, bytes.NewReader(d.body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "periodic/"+Version)
+		req.Header.Set("X-Periodic-Event", d.Event)
+		req.Header.Set("X-Periodic-Delivery", d.ID)
+		if d.secret != "" {
+			req.Header.Set("X-Periodic-Signature", "sha256="+signPayload(d.secret, d.body))
+		}
+		var rsp *http.Response
+		if rsp, err = n.client.Do(req); err == nil {
+			rsp.Body.Close()
+			d.StatusCode = rsp.StatusCode
+			if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+				err = errors.New("unexpected status " + strconv.Itoa(rsp.StatusCode))
+			}
+		}
+	}
+	if err != nil {
+		d.Error = err.Error()
+	} else {
+		d.Success = true
+	}
+	if err != nil {
+		d.log().Warn("Webhook delivery failed", "attempt", d.Attempt, "status", d.StatusCode, "err", err)
+	} else {
+		d.log().Debug("Webhook delivered", "attempt", d.Attempt, "status", d.StatusCode)
+	}
+	if e := n.sched.driver.AddDelivery(d.Delivery, n.logLimit); e != nil {
+		d.log().Error("AddDelivery failed", "err", e)
+	}
+	if d.Success || d.Attempt >= n.maxAttempts || !n.sched.alive {
+		return
+	}
+	backoff := n.backoff << uint(d.Attempt-1)
+	time.AfterFunc(backoff, func() {
+		n.queue <- d
+	})
+}
+
+func (d *webhookDelivery) log() *logger.Logger {
+	return schedLog.With("delivery", d.ID, "job_id", d.JobID, "namespace", d.Namespace, "func", d.Func, "url", d.URL)
+}
+
+// signPayload sign the payload with HMAC-SHA256, returns the hex digest.
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDeliveryID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return strconv.FormatInt(time.Now().Unix(), 10) + "-" + hex.EncodeToString(buf)
+}
+
+type webhookRequest struct {
+	Func  string `json:"func"`
+	Limit int    `json:"limit"`
+}
+
+// setWebhook save the webhook of a func of the namespace, an empty url remove it.
+func (sched *Sched) setWebhook(ns string, hook driver.Webhook) error {
+	if hook.Func == "" {
+		return validationError{errors.New("func is required")}
+	}
+	if hook.URL == "" {
+		return sched.driver.DeleteWebhook(ns, hook.Func)
+	}
+	hook.Namespace = ns
+	return sched.driver.SaveWebhook(hook)
+}
+
+// getWebhook get the webhook of a func of the namespace and the newest
+// deliveries.
+func (sched *Sched) getWebhook(ns string, req webhookRequest) (map[string]interface{}, error) {
+	if req.Func == "" {
+		return nil, validationError{errors.New("func is required")}
+	}
+	if req.Limit <= 0 {
+		req.Limit = 20
+	}
+	var result = make(map[string]interface{})
+	if hook, err := sched.driver.GetWebhook(ns, req.Func); err == nil {
+		result["webhook"] = hook
+	}
+	deliveries, err := sched.driver.GetDeliveries(ns, req.Func, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	result["deliveries"] = deliveries
+	return result, nil
+}
@@ -2,22 +2,38 @@ package periodic
 
 import (
 	"bytes"
+	"errors"
 	"io"
-	"log"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jmuyuyang/periodic/driver"
+	"github.com/jmuyuyang/periodic/logger"
 	"github.com/jmuyuyang/periodic/protocol"
 )
 
+// workerSequence the last worker sequence number
+var workerSequence int64
+
 type worker struct {
+	id       string
 	jobQueue map[int64]driver.Job
 	conn     protocol.Conn
 	sched    *Sched
 	alive    bool
 	funcs    []string
 	locker   *sync.Mutex
+	log      *logger.Logger
+	// connectedAt when the worker is connected
+	connectedAt time.Time
+	// identity the authenticated identity, empty when anonymous
+	identity string
+	// namespace the namespace of the connection
+	namespace string
+	session
 }
 
 func newWorker(sched *Sched, conn protocol.Conn) (w *worker) {
@@ -28,6 +44,14 @@ func newWorker(sched *Sched, conn protocol.Conn) (w *worker) {
 	w.funcs = make([]string, 0)
 	w.alive = true
 	w.locker = new(sync.Mutex)
+	w.connectedAt = time.Now()
+	w.namespace = driver.DefaultNamespace
+	w.session = newSession()
+	w.id = "worker#" + strconv.FormatInt(atomic.AddInt64(&workerSequence, 1), 10)
+	if addr := conn.RemoteAddr(); addr != nil && addr.Network() != "unix" {
+		w.id = w.id + "@" + addr.String()
+	}
+	w.log = protoLog.With("worker", w.id)
 	return
 }
 
@@ -51,18 +75,61 @@ func (w *worker) handleJobAssign(msgID []byte, job driver.Job) (err error) {
 	return
 }
 
+// handleJobAssigns assign the jobs by one JOB_ASSIGNS
+func (w *worker) handleJobAssigns(msgID []byte, jobs []driver.Job) (err error) {
+	defer w.locker.Unlock()
+	w.locker.Lock()
+	buf := bytes.NewBuffer(nil)
+	buf.Write(msgID)
+	buf.Write(protocol.NullChar)
+	buf.Write(protocol.JOBASSIGNS.Bytes())
+	buf.Write(protocol.NullChar)
+	buf.WriteString(`{"jobs":[`)
+	for i, job := range jobs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(job.Bytes())
+		w.jobQueue[job.ID] = job
+	}
+	buf.WriteString(`]}`)
+	if err = w.conn.Send(buf.Bytes()); err != nil {
+		for _, job := range jobs {
+			delete(w.jobQueue, job.ID)
+		}
+	}
+	return
+}
+
+// inFlight the count of the jobs assigned and not finished
+func (w *worker) inFlight() int {
+	defer w.locker.Unlock()
+	w.locker.Lock()
+	return len(w.jobQueue)
+}
+
+// full check the worker reached the max in-flight jobs
+func (w *worker) full() bool {
+	max := w.sched.workerMaxInFlight
+	return max > 0 && w.inFlight() >= max
+}
+
 func (w *worker) handleCanDo(Func string) error {
+	defer w.locker.Unlock()
+	w.locker.Lock()
 	for _, f := range w.funcs {
 		if f == Func {
 			return nil
 		}
 	}
 	w.funcs = append(w.funcs, Func)
-	w.sched.incrStatFunc(Func)
+	w.sched.incrStatFunc(w.namespace, Func)
 	return nil
 }
 
 func (w *worker) handleCanNoDo(Func string) error {
+	defer w.locker.Unlock()
+	w.locker.Lock()
 	var newFuncs = make([]string, 0)
 	for _, f := range w.funcs {
 		if f == Func {
@@ -74,8 +141,10 @@ func (w *worker) handleCanNoDo(Func string) error {
 	return nil
 }
 
-func (w *worker) handleDone(jobID int64) (err error) {
-	w.sched.done(jobID)
+func (w *worker) handleDone(jobID int64, result []byte) (err error) {
+	// the worker may grab again when it reached the max in-flight jobs
+	defer w.sched.notifyJobTimer()
+	w.sched.done(jobID, result)
 	defer w.locker.Unlock()
 	w.locker.Lock()
 	if _, ok := w.jobQueue[jobID]; ok {
@@ -84,8 +153,9 @@ func (w *worker) handleDone(jobID int64) (err error) {
 	return nil
 }
 
-func (w *worker) handleFail(jobID int64) (err error) {
-	w.sched.fail(jobID)
+func (w *worker) handleFail(jobID int64, reason []byte) (err error) {
+	defer w.sched.notifyJobTimer()
+	w.sched.fail(jobID, reason)
 	defer w.locker.Unlock()
 	w.locker.Lock()
 	if _, ok := w.jobQueue[jobID]; ok {
@@ -103,7 +173,24 @@ func (w *worker) handleCommand(msgID []byte, cmd protocol.Command) (err error) {
 	return
 }
 
+// handleError reply the error, by an ERROR response when the errors is
+// negotiated.
+func (w *worker) handleError(msgID []byte, e error) error {
+	return w.replyError(w.conn, msgID, e)
+}
+
+// handleReject reply the error of a command without a response by an ERROR,
+// the legacy connections get no reply and the error is logged.
+func (w *worker) handleReject(msgID []byte, e error) error {
+	if !w.enabled(protocol.CapErrors) {
+		w.log.Warn("Command rejected", "err", e)
+		return nil
+	}
+	return sendError(w.conn, msgID, e)
+}
+
 func (w *worker) handleSchedLater(jobID, delay, counter int64) (err error) {
+	defer w.sched.notifyJobTimer()
 	w.sched.schedLater(jobID, delay, counter)
 	defer w.locker.Unlock()
 	w.locker.Lock()
@@ -113,11 +200,71 @@ func (w *worker) handleSchedLater(jobID, delay, counter int64) (err error) {
 	return nil
 }
 
-func (w *worker) handleGrabJob(msgID []byte) (err error) {
-	item := grabItem{
-		w:     w,
-		msgID: msgID,
+// foreignJob check the job is of the other namespace, the job of the other
+// namespace can not be touched.
+func (w *worker) foreignJob(jobID int64) bool {
+	job, err := w.sched.driver.Get(jobID)
+	if err != nil || job.ID <= 0 || job.Namespace == w.namespace {
+		return false
 	}
+	w.log.Warn("Job of the other namespace is ignored", "job_id", jobID)
+	return true
+}
+
+func (w *worker) handleHello(msgID, payload []byte) error {
+	defer w.locker.Unlock()
+	w.locker.Lock()
+	return w.session.handleHello(w.conn, msgID, payload)
+}
+
+// handleGrabJob wait for a job, the payload is the optional wait timeout in
+// seconds, NO_JOB is replied when it expires.
+func (w *worker) handleGrabJob(msgID, payload []byte) (err error) {
+	return w.grab(msgID, 0, payload)
+}
+
+// handleGrabJobs wait for at most size jobs, the payload is the size and the
+// optional wait timeout in seconds.
+func (w *worker) handleGrabJobs(msgID, payload []byte) (err error) {
+	parts := bytes.SplitN(payload, protocol.NullChar, 2)
+	size, e := strconv.Atoi(string(parts[0]))
+	if e != nil || size <= 0 {
+		return w.handleError(msgID, validationError{errors.New("Invalid GRAB_JOBS size")})
+	}
+	if size > maxGrabJobs {
+		size = maxGrabJobs
+	}
+	var timeout []byte
+	if len(parts) == 2 {
+		timeout = parts[1]
+	}
+	return w.grab(msgID, size, timeout)
+}
+
+func (w *worker) grab(msgID []byte, size int, payload []byte) (err error) {
+	item := newGrabItem(w, msgID)
+	item.size = size
+	if len(payload) > 0 {
+		timeout, e := strconv.ParseInt(string(payload), 10, 64)
+		if e != nil || timeout <= 0 {
+			return w.handleError(msgID, validationError{errors.New("Invalid wait timeout")})
+		}
+		stale := item
+		item.timer = time.AfterFunc(time.Duration(timeout)*time.Second, func() {
+			if w.sched.grabQueue.remove(stale) {
+				w.handleCommand(stale.msgID, protocol.NOJOB)
+			}
+		})
+	}
+	w.sched.grabQueue.push(item)
+	w.sched.notifyJobTimer()
+	return nil
+}
+
+// handleSleep wait for a NOOP when a job comes in for the funcs
+func (w *worker) handleSleep(msgID []byte) (err error) {
+	item := newGrabItem(w, msgID)
+	item.sleep = true
 	w.sched.grabQueue.push(item)
 	w.sched.notifyJobTimer()
 	return nil
@@ -131,37 +278,73 @@ func (w *worker) handle() {
 	var cmd protocol.Command
 	defer func() {
 		if x := recover(); x != nil {
-			log.Printf("[worker] painc: %v\n", x)
+			w.log.Error("Worker panic", "panic", x)
 		}
 	}()
 	defer w.Close()
 	for {
-		payload, err = conn.Receive()
+		payload, err = w.receive(conn)
 		if err != nil {
 			if err != io.EOF {
-				log.Printf("workerError: %s\n", err.Error())
+				w.log.Warn("Worker error", "err", err)
 			}
 			break
 		}
 
-		msgID, cmd, payload = protocol.ParseCommand(payload)
+		msgID, cmd, payload, err = protocol.ParseCommand(payload)
+		if err != nil {
+			// the frame is intact, reply the error and keep the connection
+			if err = w.handleReject(nil, validationError{err}); err != nil {
+				break
+			}
+			continue
+		}
 
 		switch cmd {
 		case protocol.GRABJOB:
-			err = w.handleGrabJob(msgID)
+			err = w.handleGrabJob(msgID, payload)
+			break
+		case protocol.GRABJOBS:
+			if !w.enabled(protocol.CapBatch) {
+				err = w.handleCommand(msgID, protocol.UNKNOWN)
+				break
+			}
+			err = w.handleGrabJobs(msgID, payload)
 			break
 		case protocol.WORKDONE:
-			jobID, _ := strconv.ParseInt(string(payload), 10, 0)
-			err = w.handleDone(jobID)
+			jobID, result := parseJobHandle(payload)
+			if !w.enabled(protocol.CapResults) {
+				result = nil
+			}
+			if w.foreignJob(jobID) {
+				err = w.handleReject(msgID, ErrJobNotExists)
+				break
+			}
+			if e := w.sched.authorizeJob(w.identity, w.namespace, RoleWork, jobID, ""); e != nil {
+				err = w.handleReject(msgID, e)
+				break
+			}
+			err = w.handleDone(jobID, result)
 			break
 		case protocol.WORKFAIL:
-			jobID, _ := strconv.ParseInt(string(payload), 10, 0)
-			err = w.handleFail(jobID)
+			jobID, reason := parseJobHandle(payload)
+			if !w.enabled(protocol.CapResults) {
+				reason = nil
+			}
+			if w.foreignJob(jobID) {
+				err = w.handleReject(msgID, ErrJobNotExists)
+				break
+			}
+			if e := w.sched.authorizeJob(w.identity, w.namespace, RoleWork, jobID, ""); e != nil {
+				err = w.handleReject(msgID, e)
+				break
+			}
+			err = w.handleFail(jobID, reason)
 			break
 		case protocol.SCHEDLATER:
 			parts := bytes.SplitN(payload, protocol.NullChar, 3)
 			if len(parts) < 2 {
-				log.Printf("Error: invalid format.")
+				err = w.handleReject(msgID, validationError{errors.New("Invalid SCHED_LATER format")})
 				break
 			}
 			jobID, _ := strconv.ParseInt(string(parts[0]), 10, 0)
@@ -170,15 +353,35 @@ func (w *worker) handle() {
 			if len(parts) == 3 {
 				counter, _ = strconv.ParseInt(string(parts[2]), 10, 0)
 			}
+			if w.foreignJob(jobID) {
+				err = w.handleReject(msgID, ErrJobNotExists)
+				break
+			}
+			if e := w.sched.authorizeJob(w.identity, w.namespace, RoleWork, jobID, ""); e != nil {
+				err = w.handleReject(msgID, e)
+				break
+			}
 			err = w.handleSchedLater(jobID, delay, counter)
 			break
 		case protocol.SLEEP:
-			err = w.handleCommand(msgID, protocol.NOOP)
+			err = w.handleSleep(msgID)
 			break
 		case protocol.PING:
 			err = w.handleCommand(msgID, protocol.PONG)
 			break
+		case protocol.AUTH:
+			// authenticated on the handshake or the authentication is disabled
+			err = w.handleCommand(msgID, protocol.SUCCESS)
+			break
+		case protocol.HELLO:
+			err = w.handleHello(msgID, payload)
+			break
 		case protocol.CANDO:
+			// the worker only grab the jobs of the funcs it can do
+			if e := w.sched.authorize(w.identity, w.namespace, RoleWork, string(payload)); e != nil {
+				err = w.handleReject(msgID, e)
+				break
+			}
 			err = w.handleCanDo(string(payload))
 			break
 		case protocol.CANTDO:
@@ -190,7 +393,7 @@ func (w *worker) handle() {
 		}
 		if err != nil {
 			if err != io.EOF {
-				log.Printf("workerError: %s\n", err.Error())
+				w.log.Warn("Worker error", "err", err)
 			}
 			break
 		}
@@ -205,13 +408,84 @@ func (w *worker) Close() {
 	defer w.sched.notifyJobTimer()
 	defer w.conn.Close()
 	w.sched.grabQueue.removeWorker(w)
+	w.sched.removeWorker(w)
 	w.alive = false
 	for k := range w.jobQueue {
-		w.sched.fail(k)
+		w.sched.fail(k, []byte("worker disconnected"))
 	}
 	w.jobQueue = nil
 	for _, Func := range w.funcs {
-		w.sched.decrStatFunc(Func)
+		w.sched.decrStatFunc(w.namespace, Func)
 	}
+	w.sched.emit(newWorkerEvent(EventWorkerDisconnected, w))
 	w = nil
 }
+
+// workerInfo defined a connected worker
+type workerInfo struct {
+	ID          string   `json:"id"`
+	Namespace   string   `json:"namespace"`
+	Agent       string   `json:"agent,omitempty"` // The library name/version negotiated by HELLO
+	Funcs       []string `json:"funcs"`
+	Jobs        []int64  `json:"jobs"` // The processing jobs
+	ConnectedAt int64    `json:"connected_at"`
+}
+
+func (w *worker) info() workerInfo {
+	defer w.locker.Unlock()
+	w.locker.Lock()
+	info := workerInfo{
+		ID:          w.id,
+		Namespace:   w.namespace,
+		Agent:       w.agent,
+		Funcs:       append([]string{}, w.funcs...),
+		Jobs:        make([]int64, 0, len(w.jobQueue)),
+		ConnectedAt: w.connectedAt.Unix(),
+	}
+	for jobID := range w.jobQueue {
+		info.Jobs = append(info.Jobs, jobID)
+	}
+	sort.Slice(info.Jobs, func(i, j int) bool { return info.Jobs[i] < info.Jobs[j] })
+	return info
+}
+
+func (sched *Sched) addWorker(w *worker) {
+	defer sched.workerLocker.Unlock()
+	sched.workerLocker.Lock()
+	sched.workers[w.id] = w
+}
+
+func (sched *Sched) removeWorker(w *worker) {
+	defer sched.workerLocker.Unlock()
+	sched.workerLocker.Lock()
+	delete(sched.workers, w.id)
+}
+
+// listWorkers list the connected workers of the namespace ordered by id
+func (sched *Sched) listWorkers(ns string) []workerInfo {
+	sched.workerLocker.Lock()
+	var workers = make([]*worker, 0, len(sched.workers))
+	for _, w := range sched.workers {
+		if w.namespace != ns {
+			continue
+		}
+		workers = append(workers, w)
+	}
+	sched.workerLocker.Unlock()
+	var infos = make([]workerInfo, 0, len(workers))
+	for _, w := range workers {
+		infos = append(infos, w.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// parseJobHandle split the job handle and the opaque data follow it.
+func parseJobHandle(payload []byte) (jobID int64, data []byte) {
+	parts := bytes.SplitN(payload, protocol.NullChar, 2)
+	jobID, _ = strconv.ParseInt(string(parts[0]), 10, 0)
+	if len(parts) == 2 {
+		data = parts[1]
+	}
+	return
+}